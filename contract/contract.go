@@ -0,0 +1,120 @@
+package contract
+
+import (
+	"context"
+	"encoding/binary"
+	"sensibled/model"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+// ZIndex utxo所在的redis有序集合
+type ZIndex struct {
+	Key   string
+	Score float64
+}
+
+// ZCounter utxo对redis有序集合计数的贡献，花费时减去
+type ZCounter struct {
+	Key    string
+	Member string
+	Delta  float64
+}
+
+// Contract 合约类型的处理方式。新增合约类型时实现此接口，并在init中Register
+type Contract interface {
+	// DataValue 写入txin/txout表的data_value
+	DataValue(data *scriptDecoder.TxoData) uint64
+
+	// TokenSummary 区块代币统计的nft编号、精度，以及计入in/out_data_value的数值
+	TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64)
+
+	// UtxoIndexes utxo在redis中的有序集合索引和计数，score为默认的utxo排序值。
+	// utxo花费和区块重组回滚时按相反操作撤销
+	UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter)
+
+	// UpdateInfo 更新代币信息，区块重组回滚时无需撤销
+	UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData)
+}
+
+var contracts = make(map[uint32]Contract, 0)
+
+// Register 注册合约类型的处理方式
+func Register(codeType uint32, c Contract) {
+	if _, ok := contracts[codeType]; ok {
+		panic("contract code type registered twice")
+	}
+	contracts[codeType] = c
+}
+
+// Get 返回合约类型的处理方式，未注册的合约类型使用默认处理
+func Get(codeType uint32) Contract {
+	if c, ok := contracts[codeType]; ok {
+		return c
+	}
+	return defaultContract{}
+}
+
+// IsToken 是否为需要记录codehash/genesis和代币统计的合约
+func IsToken(data *scriptDecoder.TxoData) bool {
+	return data.CodeType != scriptDecoder.CodeType_NONE && data.CodeType != scriptDecoder.CodeType_SENSIBLE
+}
+
+// TokenSummaryKey 区块代币统计的key: codeType + tokenIndex + codehash + genesis
+func TokenSummaryKey(data *scriptDecoder.TxoData, tokenIndex uint64) string {
+	buf := make([]byte, 12, 12+20+40)
+	binary.LittleEndian.PutUint32(buf, data.CodeType)
+	binary.LittleEndian.PutUint64(buf[4:], tokenIndex)
+	buf = append(buf, data.CodeHash[:]...)
+	buf = append(buf, data.GenesisId[:data.GenesisIdLen]...)
+	return string(buf)
+}
+
+// AddUtxoIndexes 将utxo加入各有序集合，计数按sign增减，返回涉及的key
+func AddUtxoIndexes(ctx context.Context, pipe redis.Pipeliner, outpointKey string, data *model.TxoData, score float64,
+	setPrefix, counterPrefix string, sign float64) (setKeys, counterKeys []string) {
+	sets, counters := Get(data.Data.CodeType).UtxoIndexes(data, score)
+	for _, set := range sets {
+		pipe.ZAdd(ctx, setPrefix+set.Key, &redis.Z{Score: set.Score, Member: outpointKey})
+		setKeys = append(setKeys, setPrefix+set.Key)
+	}
+	for _, counter := range counters {
+		pipe.ZIncrBy(ctx, counterPrefix+counter.Key, sign*counter.Delta, counter.Member)
+		counterKeys = append(counterKeys, counterPrefix+counter.Key)
+	}
+	return setKeys, counterKeys
+}
+
+// RemoveUtxoIndexes 将utxo移出各有序集合，计数按sign增减，返回涉及的key
+func RemoveUtxoIndexes(ctx context.Context, pipe redis.Pipeliner, outpointKey string, data *model.TxoData,
+	setPrefix, counterPrefix string, sign float64) (setKeys, counterKeys []string) {
+	sets, counters := Get(data.Data.CodeType).UtxoIndexes(data, 0)
+	for _, set := range sets {
+		pipe.ZRem(ctx, setPrefix+set.Key, outpointKey)
+		setKeys = append(setKeys, setPrefix+set.Key)
+	}
+	for _, counter := range counters {
+		pipe.ZIncrBy(ctx, counterPrefix+counter.Key, sign*counter.Delta, counter.Member)
+		counterKeys = append(counterKeys, counterPrefix+counter.Key)
+	}
+	return setKeys, counterKeys
+}
+
+// defaultContract 未注册的合约类型，只记录codehash/genesis和输出计数
+type defaultContract struct{}
+
+func (defaultContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return 0
+}
+
+func (defaultContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return 0, 0, 1
+}
+
+func (defaultContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	return nil, nil
+}
+
+func (defaultContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+}
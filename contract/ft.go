@@ -0,0 +1,48 @@
+package contract
+
+import (
+	"context"
+	"sensibled/model"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func init() {
+	Register(scriptDecoder.CodeType_FT, ftContract{})
+}
+
+type ftContract struct{}
+
+func (ftContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return data.FT.Amount
+}
+
+func (ftContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return 0, data.FT.Decimal, data.FT.Amount
+}
+
+func (ftContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+	strCodeHash := string(data.Data.CodeHash[:])
+	strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
+	amount := float64(data.Data.FT.Amount)
+
+	sets = []ZIndex{
+		{"{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId, score}, // ft:utxo
+	}
+	counters = []ZCounter{
+		{"{fb" + strGenesisId + strCodeHash + "}", strAddressPkh, amount}, // ft:balance
+		{"{fs" + strAddressPkh + "}", strCodeHash + strGenesisId, amount}, // ft:summary
+	}
+	return sets, counters
+}
+
+// UpdateInfo 未登记的ft先记录utxo中读到的信息，不覆盖登记信息
+func (ftContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+	key := "fi" + string(data.CodeHash[:]) + string(data.GenesisId[:data.GenesisIdLen])
+	pipe.HSetNX(ctx, key, "decimal", data.FT.Decimal)
+	pipe.HSetNX(ctx, key, "name", data.FT.Name)
+	pipe.HSetNX(ctx, key, "symbol", data.FT.Symbol)
+	pipe.HSetNX(ctx, key, "sensibleid", data.FT.SensibleId)
+}
@@ -0,0 +1,63 @@
+package contract
+
+import (
+	"context"
+	"encoding/binary"
+	"sensibled/model"
+	"strconv"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func init() {
+	Register(scriptDecoder.CodeType_NFT, nftContract{})
+}
+
+type nftContract struct{}
+
+func (nftContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return data.NFT.TokenIndex
+}
+
+func (nftContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return data.NFT.TokenIndex, 0, 1
+}
+
+func (nftContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+	strCodeHash := string(data.Data.CodeHash[:])
+	strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
+
+	// nftIdx as score
+	score = float64(data.Data.NFT.TokenIndex)
+	sets = []ZIndex{
+		{"{nu" + strAddressPkh + "}" + strCodeHash + strGenesisId, score}, // nft:utxo
+		{"nd" + strCodeHash + strGenesisId, score},                        // nft:utxo-detail
+	}
+	counters = []ZCounter{
+		{"{no" + strGenesisId + strCodeHash + "}", strAddressPkh, 1}, // nft:owners
+		{"{ns" + strAddressPkh + "}", strCodeHash + strGenesisId, 1}, // nft:summary
+	}
+	return sets, counters
+}
+
+func (nftContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+	strCodeHash := string(data.CodeHash[:])
+	strGenesisId := string(data.GenesisId[:data.GenesisIdLen])
+	pipe.HSet(ctx, "nI"+strCodeHash+strGenesisId+strconv.Itoa(int(data.NFT.TokenIndex)),
+		"metatxid", data.NFT.MetaTxId[:],
+		"metavout", data.NFT.MetaOutputIndex,
+		"supply", data.NFT.TokenSupply,
+		"sensibleid", data.NFT.SensibleId,
+	)
+	// 等待解析元数据, member: tokenIndex(8 bytes LE) + codehash + genesis
+	buf := make([]byte, 8, 8+20+40)
+	binary.LittleEndian.PutUint64(buf, data.NFT.TokenIndex)
+	pipe.SAdd(ctx, "nmq", string(buf)+strCodeHash+strGenesisId)
+
+	pipe.HSet(ctx, "ni"+strCodeHash+strGenesisId,
+		"supply", data.NFT.TokenSupply,
+		"sensibleid", data.NFT.SensibleId,
+	)
+}
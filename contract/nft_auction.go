@@ -0,0 +1,41 @@
+package contract
+
+import (
+	"context"
+	"sensibled/model"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func init() {
+	Register(scriptDecoder.CodeType_NFT_AUCTION, nftAuctionContract{})
+}
+
+type nftAuctionContract struct{}
+
+func (nftAuctionContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return 0
+}
+
+func (nftAuctionContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return 0, 0, 1
+}
+
+func (nftAuctionContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+	strCodeHash := string(data.Data.CodeHash[:])
+	strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
+
+	sets = []ZIndex{
+		{"{nau" + strAddressPkh + "}" + strCodeHash, score}, // nft:auction:utxo
+		{"nad" + strCodeHash + strGenesisId, score},         // nft:auction:utxo-detail
+	}
+	counters = []ZCounter{
+		{"{nas" + strAddressPkh + "}", strCodeHash, 1}, // nft:auction:sender-summary
+	}
+	return sets, counters
+}
+
+func (nftAuctionContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+}
@@ -0,0 +1,49 @@
+package contract
+
+import (
+	"context"
+	"sensibled/model"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func init() {
+	Register(scriptDecoder.CodeType_NFT_SELL, nftSellContract{})
+}
+
+type nftSellContract struct{}
+
+func (nftSellContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return data.NFTSell.TokenIndex
+}
+
+func (nftSellContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return data.NFTSell.TokenIndex, 0, 1
+}
+
+func (nftSellContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+	strCodeHash := string(data.Data.CodeHash[:])
+	strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
+	price := float64(data.Data.NFTSell.Price)
+	tokenIndex := float64(data.Data.NFTSell.TokenIndex)
+
+	sets = []ZIndex{
+		{"{sut}", score},                                    // nft:sell:all:utxo, sort by time
+		{"{suta" + strAddressPkh + "}", score},              // nft:sell:seller-address:utxo
+		{"{sutc" + strGenesisId + strCodeHash + "}", score}, // nft:sell
+
+		{"{sup}", price},                                    // nft:sell:all:utxo, sort by price
+		{"{supa" + strAddressPkh + "}", price},              // nft:sell:seller-address:utxo
+		{"{supc" + strGenesisId + strCodeHash + "}", price}, // nft:sell
+
+		{"{sui}", tokenIndex},                                    // nft:sell:all:utxo, sort by token index
+		{"{suia" + strAddressPkh + "}", tokenIndex},              // nft:sell:seller-address:utxo
+		{"{suic" + strGenesisId + strCodeHash + "}", tokenIndex}, // nft:sell
+	}
+	return sets, nil
+}
+
+func (nftSellContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+}
@@ -0,0 +1,40 @@
+package contract
+
+import (
+	"context"
+	"sensibled/model"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func init() {
+	Register(scriptDecoder.CodeType_UNIQUE, uniqueContract{})
+}
+
+type uniqueContract struct{}
+
+func (uniqueContract) DataValue(data *scriptDecoder.TxoData) uint64 {
+	return 0
+}
+
+func (uniqueContract) TokenSummary(data *scriptDecoder.TxoData) (tokenIndex uint64, decimal uint8, dataValue uint64) {
+	return 0, 0, 1
+}
+
+func (uniqueContract) UtxoIndexes(data *model.TxoData, score float64) (sets []ZIndex, counters []ZCounter) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+	strCodeHash := string(data.Data.CodeHash[:])
+	strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
+
+	sets = []ZIndex{
+		{"{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId, score}, // uniq:utxo
+	}
+	return sets, nil
+}
+
+func (uniqueContract) UpdateInfo(ctx context.Context, pipe redis.Pipeliner, data *scriptDecoder.TxoData) {
+	pipe.HSet(ctx, "fi"+string(data.CodeHash[:])+string(data.GenesisId[:data.GenesisIdLen]),
+		"sensibleid", data.Uniq.SensibleId,
+	)
+}
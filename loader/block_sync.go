@@ -10,6 +10,7 @@ import (
 	"sensibled/logger"
 	"sensibled/model"
 	"sensibled/rdb"
+	"sensibled/store"
 	"sensibled/utils"
 
 	redis "github.com/go-redis/redis/v8"
@@ -27,7 +28,7 @@ func blockResultSRF(rows *sql.Rows) (interface{}, error) {
 }
 
 func GetLatestBlockFromDB() (blkRsp *model.BlockDO, err error) {
-	psql := "SELECT height, blkid FROM blk_height ORDER BY height DESC LIMIT 1"
+	psql := "SELECT height, blkid FROM blk_height WHERE " + store.SqlNotOrphan + " ORDER BY height DESC LIMIT 1"
 
 	blkRet, err := clickhouse.ScanOne(psql, blockResultSRF)
 	if err != nil {
@@ -78,7 +79,8 @@ func GetSpentUTXOAfterBlockHeight(start, end int) (utxosMapRsp map[string]*model
 SELECT utxid, vout, satoshi, script_type, script_pk, height_txo, utxidx FROM txin
    WHERE satoshi > 0 AND
       height >= %d AND
-      height < %d`, start, end)
+      height < %d AND
+      %s`, start, end, store.SqlNotOrphan)
 	return getUtxoBySql(psql)
 }
 
@@ -90,9 +92,10 @@ func GetNewUTXOAfterBlockHeight(start, end int) (utxosMapRsp map[string]*model.T
 	psql := fmt.Sprintf(`
 SELECT utxid, vout, satoshi, script_type, script_pk, 0, 0 FROM txout
    WHERE satoshi > 0 AND
-      NOT startsWith(script_type, char(0x00, 0x6a)) AND
+      substring(script_type, 1, 2) != %s AND
       height >= %d AND
-      height < %d`, start, end)
+      height < %d AND
+      %s`, clickhouse.Unhex("006a"), start, end, store.SqlNotOrphan)
 	return getUtxoBySql(psql)
 }
 
@@ -17,7 +17,7 @@ func newMysql(db *sql.DB) *clickhImpl {
 }
 
 func (m *clickhImpl) Scan(psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -31,7 +31,7 @@ func (m *clickhImpl) Scan(psql string, srf ScanRowsFunc, args ...interface{}) (r
 }
 
 func (m *clickhImpl) ScanAll(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -65,7 +65,7 @@ func (m *clickhImpl) ScanAll(psql string, srf ScanRowFunc, args ...interface{})
 }
 
 func (m *clickhImpl) ScanOne2(psql string, to interface{}, args ...interface{}) (ok bool, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -91,7 +91,7 @@ func (m *clickhImpl) ScanOne2(psql string, to interface{}, args ...interface{})
 }
 
 func (m *clickhImpl) ScanOne(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -119,7 +119,7 @@ func (m *clickhImpl) ScanRange(psql string, srf ScanRowFunc, offset int, limit i
 	}
 	args = append(args, offset, limit)
 
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -165,7 +165,7 @@ func (m *clickhImpl) ScanPage(psql string, srf ScanRowFunc, offset int, limit in
 	}
 	args = append(args, offset, limit)
 
-	pstmt, err := m.DB.Prepare(dataPsql)
+	pstmt, err := m.DB.Prepare(Rebind(dataPsql))
 	if err != nil {
 		return
 	}
@@ -214,7 +214,7 @@ func (m *clickhImpl) scanPageTotal(psql string, meta *SqlMeta, args ...interface
 		GenTotalSql(psql, meta)
 	}
 
-	pstmt, err := m.DB.Prepare(meta.TotalPsql)
+	pstmt, err := m.DB.Prepare(Rebind(meta.TotalPsql))
 	if err != nil {
 		return
 	}
@@ -232,7 +232,7 @@ func (m *clickhImpl) scanPageTotal(psql string, meta *SqlMeta, args ...interface
 }
 
 func (m *clickhImpl) Exec(psql string, args ...interface{}) (ret sql.Result, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.DB.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
@@ -246,7 +246,7 @@ func (m *clickhImpl) ExecBatch(psql string, argsList ...interface{}) (retList []
 	if err != nil {
 		return
 	}
-	pstmt, err := tx.Prepare(psql)
+	pstmt, err := tx.Prepare(Rebind(psql))
 	if err != nil {
 		return
 	}
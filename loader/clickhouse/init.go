@@ -1,13 +1,9 @@
 package clickhouse
 
 import (
-	"database/sql"
 	"fmt"
-	"net/url"
-	"strconv"
-	"strings"
 
-	_ "github.com/ClickHouse/clickhouse-go"
+	ch "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/spf13/viper"
 )
 
@@ -25,34 +21,17 @@ func Init() {
 		}
 	}
 
-	address := viper.GetString("address")
-
-	config := map[string]string{
-		"username":                 viper.GetString("username"),
-		"password":                 viper.GetString("password"),
-		"database":                 viper.GetString("database"),
-		"read_timeout":             strconv.Itoa(viper.GetInt("read_timeout")),
-		"write_timeout":            strconv.Itoa(viper.GetInt("write_timeout")),
-		"send_timeout":             strconv.Itoa(viper.GetInt("send_timeout")),
-		"receive_timeout":          strconv.Itoa(viper.GetInt("receive_timeout")),
-		"no_delay":                 fmt.Sprintf("%t", viper.GetBool("no_delay")),
-		"connection_open_strategy": viper.GetString("connection_open_strategy"),
-		"block_size":               strconv.Itoa(viper.GetInt("block_size")),
-		"pool_size":                strconv.Itoa(viper.GetInt("pool_size")),
-		"debug":                    fmt.Sprintf("%t", viper.GetBool("debug")),
+	if viper.GetString("backend") == "postgres" {
+		InitPostgres()
+		return
 	}
+
 	maxIdleConns := viper.GetInt("maxIdleConns")
 	maxOpenConns := viper.GetInt("maxOpenConns")
 	connMaxLifetime := viper.GetDuration("connMaxLifetime")
 
-	sb := new(strings.Builder)
-	for key, value := range config {
-		addit(sb, key, value)
-	}
-	db, err := sql.Open("clickhouse", "tcp://"+address+sb.String())
-	if err != nil {
-		panic(err)
-	}
+	// clickhouse-go v1与v2注册了同名的database/sql驱动，不能同时引入，查询也使用v2
+	db := ch.OpenDB(nativeOptions())
 	if maxIdleConns > 0 {
 		db.SetMaxIdleConns(maxIdleConns)
 	}
@@ -64,19 +43,6 @@ func Init() {
 	}
 
 	CK = &clickhImpl{DB: db}
-}
 
-func addit(sb *strings.Builder, key, val string) {
-	if strings.TrimSpace(val) == "" {
-		return
-	}
-
-	if sb.Len() == 0 {
-		sb.WriteByte('?')
-	} else {
-		sb.WriteByte('&')
-	}
-	sb.WriteString(key)
-	sb.WriteByte('=')
-	sb.WriteString(url.QueryEscape(val))
+	initNative()
 }
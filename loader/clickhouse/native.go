@@ -0,0 +1,56 @@
+package clickhouse
+
+import (
+	"strings"
+	"time"
+
+	ch "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/viper"
+)
+
+var (
+	// Native 原生协议连接，用于批量写入
+	Native driver.Conn
+
+	// BatchRows 批量写入时缓存的最大行数，达到即发送
+	BatchRows int
+)
+
+// nativeOptions 原生协议连接配置，database/sql连接(CK)与Native共用
+func nativeOptions() *ch.Options {
+	// v2没有random，多个地址时轮流连接
+	connOpenStrategy := ch.ConnOpenInOrder
+	if s := viper.GetString("connection_open_strategy"); s == "random" || s == "round_robin" {
+		connOpenStrategy = ch.ConnOpenRoundRobin
+	}
+	return &ch.Options{
+		Addr: strings.Split(viper.GetString("address"), ","),
+		Auth: ch.Auth{
+			Database: viper.GetString("database"),
+			Username: viper.GetString("username"),
+			Password: viper.GetString("password"),
+		},
+		Compression: &ch.Compression{
+			Method: ch.CompressionLZ4,
+		},
+		DialTimeout:      30 * time.Second,
+		ReadTimeout:      time.Duration(viper.GetInt("read_timeout")) * time.Second,
+		MaxOpenConns:     viper.GetInt("maxOpenConns"),
+		MaxIdleConns:     viper.GetInt("maxIdleConns"),
+		ConnMaxLifetime:  viper.GetDuration("connMaxLifetime"),
+		ConnOpenStrategy: connOpenStrategy,
+		Debug:            viper.GetBool("debug"),
+	}
+}
+
+func initNative() {
+	viper.SetDefault("batch_rows", 100000)
+	BatchRows = viper.GetInt("batch_rows")
+
+	conn, err := ch.Open(nativeOptions())
+	if err != nil {
+		panic(err)
+	}
+	Native = conn
+}
@@ -0,0 +1,118 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// IsPostgres 区块数据存储在PostgreSQL(db.yaml中backend为postgres)，CK连接到PostgreSQL，不使用clickhouse
+var IsPostgres bool
+
+func init() {
+	sql.Register("sensibled-postgres", &pgDriver{})
+}
+
+// InitPostgres 连接postgres_dsn指定的PostgreSQL，db.yaml已读取或由调用方设置viper配置
+func InitPostgres() {
+	viper.SetDefault("batch_rows", 100000)
+	BatchRows = viper.GetInt("batch_rows")
+
+	db, err := sql.Open("sensibled-postgres", viper.GetString("postgres_dsn"))
+	if err != nil {
+		panic(err)
+	}
+	if maxIdleConns := viper.GetInt("maxIdleConns"); maxIdleConns > 0 {
+		db.SetMaxIdleConns(maxIdleConns)
+	}
+	if maxOpenConns := viper.GetInt("maxOpenConns"); maxOpenConns > 0 {
+		db.SetMaxOpenConns(maxOpenConns)
+	}
+	if connMaxLifetime := viper.GetDuration("connMaxLifetime"); connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(connMaxLifetime)
+	}
+
+	CK = &clickhImpl{DB: db}
+	IsPostgres = true
+}
+
+// Rebind 使用PostgreSQL时，将语句中的?占位符转换为$n
+func Rebind(psql string) string {
+	if !IsPostgres || !strings.Contains(psql, "?") {
+		return psql
+	}
+	sb := new(strings.Builder)
+	n := 0
+	inQuote := false
+	for _, ch := range psql {
+		if ch == '\'' {
+			inQuote = !inQuote
+		}
+		if ch == '?' && !inQuote {
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(ch)
+	}
+	return sb.String()
+}
+
+// Unhex 十六进制常量
+func Unhex(hexStr string) string {
+	if IsPostgres {
+		return "decode('" + hexStr + "', 'hex')"
+	}
+	return "unhex('" + hexStr + "')"
+}
+
+// pgDriver 包装lib/pq。写入clickhouse的参数多为包含二进制数据的string和uint64，
+// PostgreSQL中对应bytea和numeric，需要转换后才能写入，包括COPY
+type pgDriver struct {
+	pq.Driver
+}
+
+func (d *pgDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{Conn: conn}, nil
+}
+
+type pgConn struct {
+	driver.Conn
+}
+
+// ExecContext 无参数时使用简单查询协议，避免每条语句都先prepare
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *pgConn) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	switch v := nv.Value.(type) {
+	case string:
+		nv.Value = []byte(v)
+		return nil
+	case uint64:
+		if v > math.MaxInt64 {
+			nv.Value = strconv.FormatUint(v, 10)
+			return nil
+		}
+		nv.Value = int64(v)
+		return nil
+	}
+	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	return err
+}
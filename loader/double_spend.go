@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+func txoSpentResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.TxoSpentDO
+	err := rows.Scan(&ret.UTxid, &ret.Vout, &ret.TxId, &ret.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func txoGenesisResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.TxoSpentDO
+	err := rows.Scan(&ret.UTxid, &ret.Vout, &ret.Address, &ret.CodeHash, &ret.Genesis, &ret.CodeType)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetConfirmedSpentTxoFromDB 查询已被确认tx花费的utxo，返回花费tx及utxo的地址、合约信息
+func GetConfirmedSpentTxoFromDB(outpointKeys []string) (txosMapRsp map[string]*model.TxoSpentDO, err error) {
+	txosMapRsp = make(map[string]*model.TxoSpentDO, 0)
+	if len(outpointKeys) == 0 {
+		return txosMapRsp, nil
+	}
+
+	// txin_spent只保存utxid前12字节
+	spentConds := make([]string, len(outpointKeys))
+	txoConds := make([]string, len(outpointKeys))
+	for idx, outpointKey := range outpointKeys {
+		vout := binary.LittleEndian.Uint32([]byte(outpointKey[32:]))
+		spentConds[idx] = fmt.Sprintf("(%s, %d)", clickhouse.Unhex(hex.EncodeToString([]byte(outpointKey[:12]))), vout)
+		txoConds[idx] = fmt.Sprintf("(%s, %d)", clickhouse.Unhex(hex.EncodeToString([]byte(outpointKey[:32]))), vout)
+	}
+
+	psql := fmt.Sprintf(`
+SELECT utxid, vout, txid, height FROM txin_spent
+   WHERE height < 4294967295 AND
+      (utxid, vout) IN (%s) AND %s`, strings.Join(spentConds, ","), store.SqlNotOrphan)
+	spentRet, err := clickhouse.ScanAll(psql, txoSpentResultSRF)
+	if err != nil {
+		logger.Log.Info("query txin_spent failed", zap.Error(err))
+		return nil, err
+	}
+	if spentRet == nil {
+		return txosMapRsp, nil
+	}
+
+	spentMap := make(map[string]*model.TxoSpentDO, 0)
+	for _, spent := range spentRet.([]*model.TxoSpentDO) {
+		key := make([]byte, 16)
+		copy(key, spent.UTxid)
+		binary.LittleEndian.PutUint32(key[12:], spent.Vout)
+		spentMap[string(key)] = spent
+	}
+
+	psql = fmt.Sprintf(`
+SELECT utxid, vout, address, codehash, genesis, code_type FROM txout
+   WHERE (utxid, vout) IN (%s) AND %s`, strings.Join(txoConds, ","), store.SqlNotOrphan)
+	txoRet, err := clickhouse.ScanAll(psql, txoGenesisResultSRF)
+	if err != nil {
+		logger.Log.Info("query txout failed", zap.Error(err))
+		return nil, err
+	}
+	txoMap := make(map[string]*model.TxoSpentDO, 0)
+	if txoRet != nil {
+		for _, txo := range txoRet.([]*model.TxoSpentDO) {
+			key := make([]byte, 36)
+			copy(key, txo.UTxid)
+			binary.LittleEndian.PutUint32(key[32:], txo.Vout)
+			txoMap[string(key)] = txo
+		}
+	}
+
+	for _, outpointKey := range outpointKeys {
+		spent, ok := spentMap[outpointKey[:12]+outpointKey[32:]]
+		if !ok {
+			continue
+		}
+		ret := &model.TxoSpentDO{
+			UTxid:  []byte(outpointKey[:32]),
+			Vout:   spent.Vout,
+			TxId:   spent.TxId,
+			Height: spent.Height,
+		}
+		if txo, ok := txoMap[outpointKey]; ok {
+			ret.Address = txo.Address
+			ret.CodeHash = txo.CodeHash
+			ret.Genesis = txo.Genesis
+			ret.CodeType = txo.CodeType
+		}
+		txosMapRsp[outpointKey] = ret
+	}
+	return txosMapRsp, nil
+}
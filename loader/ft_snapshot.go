@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+func ftHolderResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.FTHolderDO
+	err := rows.Scan(&ret.Height, &ret.AddressPkh, &ret.Balance)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+type ftHolderChangeDO struct {
+	AddressPkh []byte
+	OutValue   uint64
+	InValue    uint64
+}
+
+func ftHolderChangeResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret ftHolderChangeDO
+	err := rows.Scan(&ret.AddressPkh, &ret.OutValue, &ret.InValue)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetFTSnapshotHeight 查询不高于height的最近一次ft持有人快照高度，没有则返回-1
+func GetFTSnapshotHeight(codeHash, genesisId []byte, height int) (snapshotHeight int, err error) {
+	psql := fmt.Sprintf(`
+SELECT height, address, balance FROM ft_holder_snapshot
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND height <= %d AND %s
+   ORDER BY height DESC LIMIT 1`, hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), height, store.SqlNotOrphan)
+
+	snapshotRet, err := clickhouse.ScanOne(psql, ftHolderResultSRF)
+	if err != nil {
+		logger.Log.Info("query ft snapshot height failed", zap.Error(err))
+		return -1, err
+	}
+	if snapshotRet == nil {
+		return -1, nil
+	}
+	return int(snapshotRet.(*model.FTHolderDO).Height), nil
+}
+
+// GetFTHoldersAtHeight 统计ft在指定高度(含)的所有持有人余额，key: address pkh
+// 如有不高于height的快照，则在快照基础上累加之后的txout/txin变化
+func GetFTHoldersAtHeight(codeHash, genesisId []byte, height int) (holdersRsp map[string]uint64, err error) {
+	strCodeHash := hex.EncodeToString(codeHash)
+	strGenesisId := hex.EncodeToString(genesisId)
+
+	snapshotHeight, err := GetFTSnapshotHeight(codeHash, genesisId, height)
+	if err != nil {
+		return nil, err
+	}
+
+	holdersRsp = make(map[string]uint64, 0)
+	if snapshotHeight >= 0 {
+		psql := fmt.Sprintf(`
+SELECT height, address, balance FROM ft_holder_snapshot
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND height = %d AND %s`,
+			strCodeHash, strGenesisId, snapshotHeight, store.SqlNotOrphan)
+
+		holdersRet, err := clickhouse.ScanAll(psql, ftHolderResultSRF)
+		if err != nil {
+			logger.Log.Info("query ft snapshot failed", zap.Error(err))
+			return nil, err
+		}
+		if holdersRet != nil {
+			for _, holder := range holdersRet.([]*model.FTHolderDO) {
+				holdersRsp[string(holder.AddressPkh)] = holder.Balance
+			}
+		}
+		if snapshotHeight == height {
+			return holdersRsp, nil
+		}
+	}
+
+	// 快照之后的余额变化，txout增加、txin减少
+	psql := fmt.Sprintf(`
+SELECT address, sum(out_value), sum(in_value) FROM (
+   SELECT address, data_value AS out_value, toUInt64(0) AS in_value FROM txout
+      WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND code_type = %d AND
+         height > %d AND height <= %d AND %s
+   UNION ALL
+   SELECT address, toUInt64(0) AS out_value, data_value AS in_value FROM txin
+      WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND code_type = %d AND
+         height > %d AND height <= %d AND %s
+) GROUP BY address`,
+		strCodeHash, strGenesisId, scriptDecoder.CodeType_FT, snapshotHeight, height, store.SqlNotOrphan,
+		strCodeHash, strGenesisId, scriptDecoder.CodeType_FT, snapshotHeight, height, store.SqlNotOrphan)
+
+	changesRet, err := clickhouse.ScanAll(psql, ftHolderChangeResultSRF)
+	if err != nil {
+		logger.Log.Info("query ft holder changes failed", zap.Error(err))
+		return nil, err
+	}
+	if changesRet == nil {
+		return holdersRsp, nil
+	}
+	for _, change := range changesRet.([]*ftHolderChangeDO) {
+		strAddressPkh := string(change.AddressPkh)
+		balance := holdersRsp[strAddressPkh] + change.OutValue - change.InValue
+		if balance == 0 {
+			delete(holdersRsp, strAddressPkh)
+			continue
+		}
+		holdersRsp[strAddressPkh] = balance
+	}
+	return holdersRsp, nil
+}
@@ -0,0 +1,43 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func ftSupplyResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.FTSupplyData
+	err := rows.Scan(&ret.CodeHash, &ret.GenesisId, &ret.Minted, &ret.Burned)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetFTSupplyAfterBlockHeight 统计指定高度之后各ft的增发、销毁数量，用于回滚
+func GetFTSupplyAfterBlockHeight(start int) (supplyMapRsp map[string]*model.FTSupplyData, err error) {
+	psql := fmt.Sprintf(`
+SELECT codehash, genesis, sum(minted), sum(burned) FROM blk_ft_supply_height
+   WHERE height >= %d AND %s
+   GROUP BY codehash, genesis`, start, store.SqlNotOrphan)
+
+	supplyMapRsp = make(map[string]*model.FTSupplyData, 0)
+	supplyRet, err := clickhouse.ScanAll(psql, ftSupplyResultSRF)
+	if err != nil {
+		logger.Log.Info("query ft supply failed", zap.Error(err))
+		return nil, err
+	}
+	if supplyRet == nil {
+		return supplyMapRsp, nil
+	}
+	for _, supply := range supplyRet.([]*model.FTSupplyData) {
+		supplyMapRsp[string(supply.CodeHash)+string(supply.GenesisId)] = supply
+	}
+	return supplyMapRsp, nil
+}
@@ -0,0 +1,54 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func ftTokenResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.FTToken
+	var verified, copycat uint8
+	err := rows.Scan(&ret.Height, &ret.TxIdx, &ret.TxId, &ret.CodeHash, &ret.GenesisId, &ret.SensibleId,
+		&ret.Name, &ret.Symbol, &ret.Decimal, &ret.IssuerPkh, &verified, &copycat)
+	if err != nil {
+		return nil, err
+	}
+	ret.Verified = verified == 1
+	ret.Copycat = copycat == 1
+	return &ret, nil
+}
+
+func getFTTokens(psql string) (tokensRsp []*model.FTToken, err error) {
+	tokensRet, err := clickhouse.ScanAll(psql, ftTokenResultSRF)
+	if err != nil {
+		logger.Log.Info("query ft token failed", zap.Error(err))
+		return nil, err
+	}
+	if tokensRet == nil {
+		return nil, nil
+	}
+	return tokensRet.([]*model.FTToken), nil
+}
+
+// GetFTTokens 全部已登记ft，按首次出现顺序排列
+func GetFTTokens() (tokensRsp []*model.FTToken, err error) {
+	psql := `
+SELECT height, txidx, txid, codehash, genesis, sensibleid, name, symbol, decimal, issuer, verified, copycat FROM ft_token
+   WHERE ` + store.SqlNotOrphan + `
+   ORDER BY height, txidx`
+	return getFTTokens(psql)
+}
+
+// GetFTTokensAfterBlockHeight 指定高度之后登记的ft，用于回滚
+func GetFTTokensAfterBlockHeight(start int) (tokensRsp []*model.FTToken, err error) {
+	psql := fmt.Sprintf(`
+SELECT height, txidx, txid, codehash, genesis, sensibleid, name, symbol, decimal, issuer, verified, copycat FROM ft_token
+   WHERE height >= %d AND %s`, start, store.SqlNotOrphan)
+	return getFTTokens(psql)
+}
@@ -0,0 +1,72 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func auctionIdResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret string
+	err := rows.Scan(&ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func nftAuctionEventResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.NFTAuctionEvent
+	err := rows.Scan(&ret.Height, &ret.TxId, &ret.AuctionId, &ret.CodeHash, &ret.NFTCodeHash, &ret.NFTID,
+		&ret.Event, &ret.SenderPkh, &ret.BidderPkh, &ret.Price, &ret.EndTimestamp, &ret.Vout)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetNFTAuctionBeforeBlockHeight 查询指定高度之后有变化的拍卖，及其在该高度之前的最新状态，用于回滚
+func GetNFTAuctionBeforeBlockHeight(start int) (auctionIds []string, auctionMap map[string]*model.NFTAuctionEvent, err error) {
+	changedSql := fmt.Sprintf(`
+SELECT DISTINCT auction_id FROM nft_auction_event
+   WHERE height >= %d AND height < %d AND %s`, start, model.MEMPOOL_HEIGHT, store.SqlNotOrphan)
+
+	idsRet, err := clickhouse.ScanAll(changedSql, auctionIdResultSRF)
+	if err != nil {
+		logger.Log.Info("query nft auction failed", zap.Error(err))
+		return nil, nil, err
+	}
+	auctionMap = make(map[string]*model.NFTAuctionEvent, 0)
+	if idsRet == nil {
+		return nil, auctionMap, nil
+	}
+	auctionIds = idsRet.([]string)
+
+	// 每个拍卖取最新一条，PostgreSQL没有LIMIT BY
+	distinctOn, limitBy := "", "\n   LIMIT 1 BY auction_id"
+	if clickhouse.IsPostgres {
+		distinctOn, limitBy = "DISTINCT ON (auction_id) ", ""
+	}
+	psql := fmt.Sprintf(`
+SELECT %sheight, txid, auction_id, codehash, nft_codehash, nft_id, event, sender, bidder, price, end_timestamp, vout FROM nft_auction_event
+   WHERE height < %d AND event != %d AND auction_id IN (%s) AND %s
+   ORDER BY auction_id, height DESC, txidx DESC, idx DESC%s`, distinctOn, start, model.NFT_AUCTION_OUTBID, changedSql, store.SqlNotOrphan, limitBy)
+
+	eventsRet, err := clickhouse.ScanAll(psql, nftAuctionEventResultSRF)
+	if err != nil {
+		logger.Log.Info("query nft auction state failed", zap.Error(err))
+		return nil, nil, err
+	}
+	if eventsRet == nil {
+		return auctionIds, auctionMap, nil
+	}
+	for _, event := range eventsRet.([]*model.NFTAuctionEvent) {
+		auctionMap[string(event.AuctionId)] = event
+	}
+	return auctionIds, auctionMap, nil
+}
@@ -0,0 +1,40 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func txOutScriptResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.TxOutScriptDO
+	err := rows.Scan(&ret.PkScript, &ret.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetTxOutScriptFromDB 查询已确认的输出锁定脚本，未找到返回nil
+func GetTxOutScriptFromDB(utxid []byte, vout uint32) (scriptRsp *model.TxOutScriptDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT script_pk, height FROM txout
+   WHERE utxid = %s AND vout = %d AND %s
+   LIMIT 1`, clickhouse.Unhex(hex.EncodeToString(utxid)), vout, store.SqlNotOrphan)
+
+	scriptRet, err := clickhouse.ScanOne(psql, txOutScriptResultSRF)
+	if err != nil {
+		logger.Log.Info("query txout script failed", zap.Error(err))
+		return nil, err
+	}
+	if scriptRet == nil {
+		return nil, nil
+	}
+	return scriptRet.(*model.TxOutScriptDO), nil
+}
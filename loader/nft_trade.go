@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/rdb"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func nftSellStatsResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.NFTSellStatsDO
+	err := rows.Scan(&ret.Trades, &ret.Volume, &ret.MinPrice, &ret.MaxPrice, &ret.LastPrice, &ret.LastHeight)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetNFTSellStats 统计nft出售合约的成交量、最近成交价，以及当前挂单最低价
+func GetNFTSellStats(codeHash, genesisId []byte) (statsRsp *model.NFTSellStatsDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT count(1), sum(price), min(price), max(price), argMax(price, (height, txidx)), max(height) FROM nft_sell_trade
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND %s`, hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), store.SqlNotOrphan)
+
+	statsRet, err := clickhouse.ScanOne(psql, nftSellStatsResultSRF)
+	if err != nil {
+		logger.Log.Info("query nft sell stats failed", zap.Error(err))
+		return nil, err
+	}
+	statsRsp = &model.NFTSellStatsDO{}
+	if statsRet != nil {
+		statsRsp = statsRet.(*model.NFTSellStatsDO)
+	}
+
+	// 当前挂单按价格排序
+	ctx := context.Background()
+	key := "{supc" + string(genesisId) + string(codeHash) + "}"
+	pipe := rdb.RdbBalanceClient.Pipeline()
+	floorCmd := pipe.ZRangeWithScores(ctx, key, 0, 0)
+	countCmd := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Info("query nft sell floor price failed", zap.Error(err))
+		return nil, err
+	}
+	if floor := floorCmd.Val(); len(floor) > 0 {
+		statsRsp.FloorPrice = uint64(floor[0].Score)
+	}
+	statsRsp.Listings = countCmd.Val()
+	return statsRsp, nil
+}
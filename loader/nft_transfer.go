@@ -0,0 +1,40 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func nftTransferResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.NFTTransferDO
+	err := rows.Scan(&ret.Height, &ret.TxIdx, &ret.TxId, &ret.Vout, &ret.FromAddress, &ret.Address, &ret.Operation)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetNFTTransferHistory 按时间顺序查询单个nft的转移历史
+func GetNFTTransferHistory(codeHash, genesisId []byte, tokenIndex uint64) (transfersRsp []*model.NFTTransferDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT height, txidx, txid, vout, from_address, address, operation FROM nft_transfer_height
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND token_idx = %d AND %s
+   ORDER BY height, txidx, vout`, hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), tokenIndex, store.SqlNotOrphan)
+
+	transfersRet, err := clickhouse.ScanAll(psql, nftTransferResultSRF)
+	if err != nil {
+		logger.Log.Info("query nft transfer failed", zap.Error(err))
+		return nil, err
+	}
+	if transfersRet == nil {
+		return nil, nil
+	}
+	return transfersRet.([]*model.NFTTransferDO), nil
+}
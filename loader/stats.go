@@ -0,0 +1,168 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+// sqlLastStatsCondition 最近一次统计的高度和区块，排除孤块上的统计
+const sqlLastStatsCondition string = "(height, blkid) IN (SELECT height, blkid FROM stat_address WHERE " + store.SqlNotOrphan + " ORDER BY height DESC LIMIT 1)"
+
+func addressStatsResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.AddressStatsDO
+	err := rows.Scan(&ret.Height, &ret.Addresses, &ret.Utxos)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func richListResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.RichListDO
+	err := rows.Scan(&ret.AddressPkh, &ret.Balance, &ret.ContractBalance)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func genesisHolderResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.GenesisHolderDO
+	err := rows.Scan(&ret.AddressPkh, &ret.Balance)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func utxoBucketResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.UtxoBucketDO
+	err := rows.Scan(&ret.Bucket, &ret.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func activeAddressResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.ActiveAddressDO
+	err := rows.Scan(&ret.Day, &ret.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetAddressStats 最近一次统计的地址汇总，尚未统计返回nil
+func GetAddressStats() (statsRsp *model.AddressStatsDO, err error) {
+	psql := "SELECT height, addresses, utxos FROM stat_address WHERE " + store.SqlNotOrphan + " ORDER BY height DESC LIMIT 1"
+
+	statsRet, err := clickhouse.ScanOne(psql, addressStatsResultSRF)
+	if err != nil {
+		logger.Log.Info("query address stats failed", zap.Error(err))
+		return nil, err
+	}
+	if statsRet == nil {
+		return nil, nil
+	}
+	return statsRet.(*model.AddressStatsDO), nil
+}
+
+// GetDayStartHeight 区块所在日期的第一个区块高度
+func GetDayStartHeight(height int) (startHeight int, err error) {
+	psql := fmt.Sprintf(`
+SELECT min(height) FROM blk_height
+   WHERE toDate(blocktime) = (SELECT toDate(blocktime) FROM blk_height WHERE height = %d AND %s LIMIT 1) AND
+      height <= %d AND %s`, height, store.SqlNotOrphan, height, store.SqlNotOrphan)
+
+	var minHeight uint32
+	if _, err := clickhouse.ScanOne2(psql, &minHeight); err != nil {
+		logger.Log.Info("query day start height failed", zap.Error(err))
+		return height, err
+	}
+	return int(minHeight), nil
+}
+
+// GetRichList 最近一次统计的地址余额排行
+func GetRichList(limit int) (richListRsp []*model.RichListDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT address, balance, contract_balance FROM stat_rich_list
+   WHERE %s
+   ORDER BY balance + contract_balance DESC
+   LIMIT %d`, sqlLastStatsCondition, limit)
+
+	richListRet, err := clickhouse.ScanAll(psql, richListResultSRF)
+	if err != nil {
+		logger.Log.Info("query rich list failed", zap.Error(err))
+		return nil, err
+	}
+	if richListRet == nil {
+		return nil, nil
+	}
+	return richListRet.([]*model.RichListDO), nil
+}
+
+// GetGenesisTopHolders 最近一次统计的ft/nft持有人排行
+func GetGenesisTopHolders(codeHash, genesisId []byte, limit int) (holdersRsp []*model.GenesisHolderDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT address, balance FROM stat_genesis_holder
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND
+      %s
+   ORDER BY balance DESC
+   LIMIT %d`, hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), sqlLastStatsCondition, limit)
+
+	holdersRet, err := clickhouse.ScanAll(psql, genesisHolderResultSRF)
+	if err != nil {
+		logger.Log.Info("query genesis top holders failed", zap.Error(err))
+		return nil, err
+	}
+	if holdersRet == nil {
+		return nil, nil
+	}
+	return holdersRet.([]*model.GenesisHolderDO), nil
+}
+
+// GetUtxoDistribution 最近一次统计的地址utxo数量分布
+func GetUtxoDistribution() (bucketsRsp []*model.UtxoBucketDO, err error) {
+	psql := `
+SELECT bucket, addresses FROM stat_utxo_distribution
+   WHERE ` + sqlLastStatsCondition + `
+   ORDER BY bucket`
+
+	bucketsRet, err := clickhouse.ScanAll(psql, utxoBucketResultSRF)
+	if err != nil {
+		logger.Log.Info("query utxo distribution failed", zap.Error(err))
+		return nil, err
+	}
+	if bucketsRet == nil {
+		return nil, nil
+	}
+	return bucketsRet.([]*model.UtxoBucketDO), nil
+}
+
+// GetActiveAddresses 最近days天的每日活跃地址数量，同一日期取最新统计
+func GetActiveAddresses(days int) (activeRsp []*model.ActiveAddressDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT toString(day), argMax(addresses, height) FROM stat_active_address
+   WHERE %s
+   GROUP BY day
+   ORDER BY day DESC
+   LIMIT %d`, store.SqlNotOrphan, days)
+
+	activeRet, err := clickhouse.ScanAll(psql, activeAddressResultSRF)
+	if err != nil {
+		logger.Log.Info("query active addresses failed", zap.Error(err))
+		return nil, err
+	}
+	if activeRet == nil {
+		return nil, nil
+	}
+	return activeRet.([]*model.ActiveAddressDO), nil
+}
@@ -0,0 +1,111 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func swapPoolResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret string
+	err := rows.Scan(&ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func swapReserveResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.SwapCandle
+	err := rows.Scan(&ret.Height, &ret.TxIdx, &ret.TxId, &ret.CodeHash, &ret.GenesisId,
+		&ret.Close, &ret.Reserve1, &ret.Reserve2, &ret.Lp)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func swapCandleResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.SwapCandleDO
+	err := rows.Scan(&ret.Ts, &ret.Open, &ret.High, &ret.Low, &ret.Close,
+		&ret.Volume1, &ret.Volume2, &ret.Trades, &ret.Reserve1, &ret.Reserve2, &ret.Lp)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetSwapReserveBeforeBlockHeight 查询指定高度之后有变化的swap池，及其在该高度之前的最新储备，用于回滚
+// 返回的池key为codehash+genesis
+func GetSwapReserveBeforeBlockHeight(start int) (pools []string, reserveMap map[string]*model.SwapCandle, err error) {
+	// 池key，PostgreSQL的concat结果为文本，bytea需使用||连接
+	poolKey := "concat(codehash, genesis)"
+	distinctOn, limitBy := "", "\n   LIMIT 1 BY codehash, genesis"
+	if clickhouse.IsPostgres {
+		poolKey = "(codehash || genesis)"
+		distinctOn, limitBy = "DISTINCT ON (codehash, genesis) ", ""
+	}
+	changedSql := fmt.Sprintf(`
+SELECT DISTINCT %s FROM swap_candle
+   WHERE height >= %d AND height < %d AND period = %d AND %s`, poolKey, start, model.MEMPOOL_HEIGHT, model.SwapCandlePeriods[0], store.SqlNotOrphan)
+
+	poolsRet, err := clickhouse.ScanAll(changedSql, swapPoolResultSRF)
+	if err != nil {
+		logger.Log.Info("query swap pool failed", zap.Error(err))
+		return nil, nil, err
+	}
+	reserveMap = make(map[string]*model.SwapCandle, 0)
+	if poolsRet == nil {
+		return nil, reserveMap, nil
+	}
+	pools = poolsRet.([]string)
+
+	psql := fmt.Sprintf(`
+SELECT %sheight, txidx, txid, codehash, genesis, close, reserve1, reserve2, lp FROM swap_candle
+   WHERE height < %d AND period = %d AND %s IN (%s) AND %s
+   ORDER BY codehash, genesis, height DESC, txidx DESC%s`, distinctOn, start, model.SwapCandlePeriods[0], poolKey, changedSql, store.SqlNotOrphan, limitBy)
+
+	reservesRet, err := clickhouse.ScanAll(psql, swapReserveResultSRF)
+	if err != nil {
+		logger.Log.Info("query swap reserve failed", zap.Error(err))
+		return nil, nil, err
+	}
+	if reservesRet == nil {
+		return pools, reserveMap, nil
+	}
+	for _, candle := range reservesRet.([]*model.SwapCandle) {
+		reserveMap[string(candle.CodeHash)+string(candle.GenesisId)] = candle
+	}
+	return pools, reserveMap, nil
+}
+
+// GetSwapCandles 查询swap池K线，合并同一周期内各区块和内存池的记录，时间范围为[startTs, endTs)
+func GetSwapCandles(codeHash, genesisId []byte, period, startTs, endTs uint32) (candlesRsp []*model.SwapCandleDO, err error) {
+	psql := fmt.Sprintf(`
+SELECT ts, argMin(open, (height, txidx)), max(high), min(low), argMax(close, (height, txidx)),
+       sum(volume1), sum(volume2), sum(trades),
+       argMax(reserve1, (height, txidx)), argMax(reserve2, (height, txidx)), argMax(lp, (height, txidx)) FROM swap_candle
+   WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND period = %d AND ts >= %d AND ts < %d AND %s
+   GROUP BY ts
+   ORDER BY ts`, hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), period, startTs, endTs, store.SqlNotOrphan)
+
+	candlesRet, err := clickhouse.ScanAll(psql, swapCandleResultSRF)
+	if err != nil {
+		logger.Log.Info("query swap candle failed", zap.Error(err))
+		return nil, err
+	}
+	if candlesRet == nil {
+		return nil, nil
+	}
+	candlesRsp = candlesRet.([]*model.SwapCandleDO)
+	for _, candle := range candlesRsp {
+		candle.TVL = candle.Reserve1 * 2
+	}
+	return candlesRsp, nil
+}
@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/prune"
+	"sensibled/store"
+
+	"go.uber.org/zap"
+)
+
+func watchEntryResultSRF(rows *sql.Rows) (interface{}, error) {
+	var entry string
+	if err := rows.Scan(&entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func addressTxResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.AddressTxDO
+	err := rows.Scan(&ret.AddressPkh, &ret.Height, &ret.TxIdx)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetWatchList 已生效的关注列表，尚未记录则返回错误
+func GetWatchList() (*prune.WatchList, error) {
+	psql := "SELECT entry FROM watch_list"
+	entriesRet, err := clickhouse.ScanAll(psql, watchEntryResultSRF)
+	if err != nil {
+		logger.Log.Info("query watch list failed", zap.Error(err))
+		return nil, err
+	}
+	var entries []string
+	if entriesRet != nil {
+		entries = entriesRet.([]string)
+	}
+	return prune.NewWatchList(entries)
+}
+
+// GetWatchUTXO 涉及地址、genesis的已确认未花费utxo
+func GetWatchUTXO(addresses, genesis []string) (utxosMapRsp map[string]*model.TxoData, err error) {
+	cond := store.WatchKeysCondition(addresses, genesis)
+	psql := fmt.Sprintf(`
+SELECT utxid, vout, satoshi, script_type, script_pk, height, utxidx FROM txout
+   WHERE satoshi > 0 AND
+      substring(script_type, 1, 2) != %s AND
+      %s AND
+      height < %d AND
+      %s AND
+      (utxid, vout) NOT IN (
+         SELECT utxid, vout FROM txin
+            WHERE %s AND
+               height < %d AND
+               %s)`, clickhouse.Unhex("006a"), cond, model.MEMPOOL_HEIGHT, store.SqlNotOrphan,
+		cond, model.MEMPOOL_HEIGHT, store.SqlNotOrphan)
+	return getUtxoBySql(psql)
+}
+
+// GetAddressTxHistory 地址参与的已确认tx
+func GetAddressTxHistory(addresses []string) (txsRsp []*model.AddressTxDO, err error) {
+	cond := store.WatchKeysCondition(addresses, nil)
+	psql := fmt.Sprintf(`
+SELECT address, height, utxidx FROM txout
+   WHERE %s AND height < %d AND %s
+UNION ALL
+SELECT address, height, txidx FROM txin
+   WHERE %s AND height < %d AND %s`, cond, model.MEMPOOL_HEIGHT, store.SqlNotOrphan,
+		cond, model.MEMPOOL_HEIGHT, store.SqlNotOrphan)
+
+	txsRet, err := clickhouse.ScanAll(psql, addressTxResultSRF)
+	if err != nil {
+		logger.Log.Info("query address history failed", zap.Error(err))
+		return nil, err
+	}
+	if txsRet == nil {
+		return nil, nil
+	}
+	return txsRet.([]*model.AddressTxDO), nil
+}
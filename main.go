@@ -20,6 +20,7 @@ import (
 	"sensibled/rdb"
 	"sensibled/store"
 	"sensibled/task"
+	"sensibled/task/meta"
 	"strconv"
 	"sync"
 	"syscall"
@@ -85,6 +86,7 @@ var (
 	isFull           bool
 	syncOnce         bool
 	gobFlushFrom     int
+	exportDir        string
 )
 
 func init() {
@@ -94,6 +96,7 @@ func init() {
 	flag.IntVar(&startBlockHeight, "start", -1, "start block height")
 	flag.IntVar(&endBlockHeight, "end", -1, "end block height")
 	flag.IntVar(&batchTxCount, "batch", 0, "batch tx count")
+	flag.StringVar(&exportDir, "out", "export", "export parquet dir")
 
 	flag.IntVar(&gobFlushFrom, "gob", -1, "gob flush block header cache after fileIdx")
 
@@ -111,11 +114,33 @@ func init() {
 	blocksPath = viper.GetString("blocks")
 	blockMagic = viper.GetString("magic")
 
+	// 统计数据，每隔stats_interval个区块生成一次
+	viper.SetDefault("stats_interval", 0)
+	viper.SetDefault("stats_top", 1000)
+	task.StatsInterval = viper.GetInt("stats_interval")
+	task.StatsTopN = viper.GetInt("stats_top")
+
+	// 批次utxo缓存的内存预算(MB)，超过后溢出到utxo_cache_path目录
+	viper.SetDefault("utxo_cache_mb", 0)
+	viper.SetDefault("utxo_cache_path", "utxo_cache")
+	model.UtxoCacheMemBytes = viper.GetInt("utxo_cache_mb") << 20
+	model.UtxoCachePath = viper.GetString("utxo_cache_path")
+
 	rdb.RdbBalanceClient = rdb.Init("conf/rdb_balance.yaml")
-	rdb.RdbUtxoClient = rdb.Init("conf/rdb_utxo.yaml")
+	rdb.InitUtxoStore("conf/rdb_utxo.yaml")
 	rdb.RdbAddrTxClient = rdb.Init("conf/rdb_address.yaml")
 	clickhouse.Init()
 	prune.Init()
+
+	// 设置关注列表后，*_genesis_height只记录关注的地址和genesis
+	if prune.IsWatchMode {
+		store.EnableWatchListFilterCk()
+	}
+
+	if clickhouse.IsPostgres && task.StatsInterval > 0 {
+		logger.Log.Warn("stats not supported on postgres, ignore stats_interval")
+		task.StatsInterval = 0
+	}
 }
 
 func logProcessInfo(info processInfo) {
@@ -165,6 +190,13 @@ func syncBlock() {
 
 	var onceRpc sync.Once
 	var onceZmq sync.Once
+	var onceMeta sync.Once
+
+	mempool, err := memTask.NewMempool() // 准备内存池，新区块确认后增量调整
+	if err != nil {
+		logger.Log.Info("init mempool error: %v", zap.Error(err))
+		return
+	}
 
 	// 扫描区块
 	for {
@@ -193,6 +225,12 @@ func syncBlock() {
 		txCount := 0
 
 		if !isFull {
+			// 关注列表有变化，先补全或清除地址相关的索引
+			if ok := task.UpdateWatchList(mempool, blockchain.BackfillWatchedAddresses); !ok {
+				model.NeedStop = true
+				break
+			}
+
 			// 现有追加扫描
 			needRemove := false
 			if startBlockHeight < 0 {
@@ -216,6 +254,10 @@ func syncBlock() {
 				// 手动指定同步位置
 				needRemove = true
 			}
+			if needRemove || startBlockHeight != mempool.SyncedHeight+1 {
+				// 区块重组或同步不连续，需要全量重新同步内存池
+				mempool.NeedFullReload = true
+			}
 			if needRemove {
 				if ok := task.RemoveBlocksForReorg(startBlockHeight); !ok {
 					break
@@ -225,10 +267,15 @@ func syncBlock() {
 			store.CreatePartSyncCk() // 初始化同步数据库表
 			store.PreparePartSyncCk()
 		} else {
-			startBlockHeight = 0    // 重新全量扫描
+			startBlockHeight = 0 // 重新全量扫描
+			mempool.NeedFullReload = true
 			rdb.FlushdbInRedis()    // 清空redis
 			store.CreateAllSyncCk() // 初始化同步数据库表
 			store.PrepareFullSyncCk()
+			if ok := task.ResetWatchList(); !ok { // 按当前关注列表同步
+				model.NeedStop = true
+				break
+			}
 		}
 
 		needSaveBlock = true
@@ -257,6 +304,7 @@ func syncBlock() {
 			needSaveBlock = false
 
 			task.SubmitBlocksWithoutMempool(isFull, stageBlockHeight)
+			task.RefreshStats(stageBlockHeight)
 
 			isFull = false // 准备继续同步
 			startBlockHeight = -1
@@ -276,23 +324,18 @@ func syncBlock() {
 		logger.Log.Info("waiting new block...")
 
 		// 同步内存池
-		startIdx := 0
 		initSyncMempool := true
 
-		mempool, err := memTask.NewMempool() // 准备内存池
-		if err != nil {
-			logger.Log.Info("init mempool error: %v", zap.Error(err))
-			return
-		}
 		onceRpc.Do(memLoader.InitRpc)
 		onceZmq.Do(memLoader.InitZmq)
+		onceMeta.Do(meta.StartResolver) // nft元数据解析依赖rpc
 
 		if info.Mempool == 0 {
 			info.Mempool = time.Now().Unix() - info.Start
 			logProcessInfo(info)
 		}
 		for {
-			needSaveMempool := mempool.Process(initSyncMempool, stageBlockHeight, startIdx)
+			needSaveMempool := mempool.Process(initSyncMempool, stageBlockHeight)
 			if !needSaveMempool {
 				break
 			}
@@ -306,29 +349,34 @@ func syncBlock() {
 				needSaveBlock = false
 				logger.Log.Info("block finished")
 			} else {
-				mempool.SubmitMempoolWithoutBlocks(initSyncMempool)
+				mempool.SubmitMempoolWithoutBlocks()
 			}
 
 			initSyncMempool = false
-			startIdx += len(mempool.BatchTxs) // 同步完毕
-			logger.Log.Info("mempool finished", zap.Int("idx", startIdx), zap.Int("nNewTx", len(mempool.BatchTxs)))
+			mempool.StartIdx += len(mempool.BatchTxs) // 同步完毕
+			logger.Log.Info("mempool finished", zap.Int("idx", mempool.StartIdx), zap.Int("nNewTx", len(mempool.BatchTxs)))
 
 			if info.ZmqFirst == 0 {
 				info.ZmqFirst = time.Now().Unix() - info.Start
-				info.MempoolFirstIdx = startIdx
+				info.MempoolFirstIdx = mempool.StartIdx
 			}
 			info.ZmqLast = time.Now().Unix() - info.Start
-			info.MempoolLastIdx = startIdx
+			info.MempoolLastIdx = mempool.StartIdx
 			logProcessInfo(info)
 
 			if needToSwitchToSecondary() {
 				break
 			}
+			// 关注列表有变化，重新开始以便切换，并全量同步内存池
+			if prune.IsWatchListPending() {
+				break
+			}
 		}
 
 		// 未完成同步内存池 且未同步区块
 		if needSaveBlock {
 			task.SubmitBlocksWithoutMempool(isFull, stageBlockHeight)
+			task.RefreshStats(stageBlockHeight)
 			logger.Log.Info("block finished")
 		}
 		isFull = false // 准备继续同步
@@ -356,6 +404,38 @@ func syncBlock() {
 }
 
 func main() {
+	// sensibled migrate: 升级数据库结构
+	if flag.Arg(0) == "migrate" {
+		ok := store.MigrateCk()
+		logger.SyncLog()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// sensibled export: 导出parquet文件
+	if flag.Arg(0) == "export" {
+		ok := store.CheckSchemaVersionCk() && store.ExportParquetCk(exportDir, startBlockHeight, endBlockHeight)
+		logger.SyncLog()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 数据库结构版本不一致则拒绝同步，全量同步会重建数据表
+	if !isFull && !store.CheckSchemaVersionCk() {
+		logger.SyncLog()
+		os.Exit(1)
+	}
+
+	// 上次部分同步中断，先执行剩余步骤，再从db中的区块高度继续同步
+	if !isFull && !store.ResumePartSyncCk() {
+		logger.SyncLog()
+		os.Exit(1)
+	}
+
 	// pprof
 	go func() {
 		http.ListenAndServe("0.0.0.0:8000", nil)
@@ -383,6 +463,9 @@ func main() {
 		}
 	}()
 
+	// 定期重新加载关注列表
+	prune.StartWatchListReloader()
+
 	// GC
 	go func() {
 		for {
@@ -55,6 +55,42 @@ func GetRawMemPoolRPC() []interface{} {
 	return rawtxs
 }
 
+// GetRawMemPoolEntriesRPC 获取内存池所有txid及其依赖的内存池父tx
+func GetRawMemPoolEntriesRPC() map[string][]string {
+	response, err := rpcClient.Call("getrawmempool", []interface{}{true})
+	if err != nil {
+		logger.Log.Info("call failed", zap.Error(err))
+		return nil
+	}
+
+	if response.Error != nil {
+		logger.Log.Info("Receive remote return", zap.Any("response", response))
+		return nil
+	}
+
+	entries, ok := response.Result.(map[string]interface{})
+	if !ok {
+		logger.Log.Info("mempool not map: %T", zap.Any("response", response.Result))
+		return nil
+	}
+
+	txs := make(map[string][]string, len(entries))
+	for txid, entry := range entries {
+		depends := make([]string, 0)
+		if info, ok := entry.(map[string]interface{}); ok {
+			if list, ok := info["depends"].([]interface{}); ok {
+				for _, dep := range list {
+					if depTxid, ok := dep.(string); ok {
+						depends = append(depends, depTxid)
+					}
+				}
+			}
+		}
+		txs[txid] = depends
+	}
+	return txs
+}
+
 func GetRawTxRPC(txid interface{}) []byte {
 	response, err := rpcClient.Call("getrawtransaction", []interface{}{txid})
 	if err != nil {
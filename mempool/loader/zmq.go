@@ -1,20 +1,64 @@
 package loader
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sensibled/logger"
+	"time"
 
 	"github.com/spf13/viper"
-	"github.com/zeromq/goczmq"
 	"go.uber.org/zap"
 )
 
+// zmqSocket zmq订阅连接
+type zmqSocket interface {
+	// RecvMessage 接收一条多帧消息，超时无消息返回errZmqTimeout
+	RecvMessage() ([][]byte, error)
+	Close()
+}
+
+// zmqTransports 可选的zmq实现，通过配置zmq_transport选择
+var zmqTransports = map[string]func(endpoint, topic string) (zmqSocket, error){
+	"native": newNativeZmqSocket,
+}
+
+var errZmqTimeout = errors.New("zmq recv timeout")
+
+// zmq连接失败和断开后重连的等待时间
 var (
-	NewBlockNotify = make(chan string, 1)
-	RawTxNotify    = make(chan []byte, 1000)
+	zmqDialRetryDelay = 5 * time.Second
+	zmqReconnectDelay = time.Second
 )
 
+// zmq连接的tcp keepalive参数
+const (
+	zmqTcpKeepaliveIdle  = 120
+	zmqTcpKeepaliveCnt   = 10
+	zmqTcpKeepaliveIntvl = 3
+)
+
+var (
+	NewBlockNotify      = make(chan string, 1)
+	RawTxNotify         = make(chan []byte, 1000)
+	MempoolResyncNotify = make(chan struct{}, 1) // zmq消息丢失，需要对比节点内存池重新同步
+)
+
+// zmqSubscriber 订阅单个zmq topic，跟踪消息序号，并在长时间无消息时重连
+type zmqSubscriber struct {
+	dial     func(endpoint, topic string) (zmqSocket, error)
+	endpoint string
+	topic    string
+	timeout  time.Duration // 超过此时间无消息则重连
+
+	hasSeq  bool
+	lastSeq uint32
+
+	onMessage func(body []byte) // 收到消息
+	onGap     func()            // 消息序号不连续或重连，可能有消息丢失
+}
+
 func InitZmq() {
 	viper.SetConfigFile("conf/chain.yaml")
 	if err := viper.ReadInConfig(); err != nil {
@@ -25,106 +69,150 @@ func InitZmq() {
 		}
 	}
 
-	zmqEndpointBlock := viper.GetString("zmq_block")
-	zmqEndpointTx := viper.GetString("zmq_tx")
+	viper.SetDefault("zmq_timeout_block", 3600)
+	viper.SetDefault("zmq_timeout_tx", 600)
+	viper.SetDefault("zmq_transport", "native")
 
-	logger.Log.Info("ZeroMQ started to listen for blocks")
-	subscriberBlock, err := goczmq.NewSub(zmqEndpointBlock, "hashblock")
-	if err != nil {
-		logger.Log.Fatal("ZMQ connect failed", zap.Error(err))
-		return
+	if maxFrameSize := viper.GetUint64("zmq_max_frame_size"); maxFrameSize > 0 {
+		zmtpMaxFrameSize = maxFrameSize
 	}
 
-	logger.Log.Info("ZeroMQ started to listen for txs")
-	subscriberTx, err := goczmq.NewSub(zmqEndpointTx, "rawtx")
-	if err != nil {
-		logger.Log.Fatal("ZMQ connect failed", zap.Error(err))
+	transport := viper.GetString("zmq_transport")
+	dial, ok := zmqTransports[transport]
+	if !ok {
+		logger.Log.Fatal("ZMQ transport not supported, build with -tags czmq to use czmq",
+			zap.String("transport", transport))
 		return
 	}
+	logger.Log.Info("ZeroMQ transport", zap.String("transport", transport))
+
+	subscriberBlock := newBlockSubscriber(dial, viper.GetString("zmq_block"),
+		time.Duration(viper.GetInt("zmq_timeout_block"))*time.Second)
+	subscriberTx := newTxSubscriber(dial, viper.GetString("zmq_tx"),
+		time.Duration(viper.GetInt("zmq_timeout_tx"))*time.Second)
 
 	// 监听新Block
-	go func() {
-		zmqNotifyBlock(subscriberBlock)
-	}()
+	logger.Log.Info("ZeroMQ started to listen for blocks")
+	go subscriberBlock.run()
 
 	// 监听新Tx
-	go func() {
-		zmqNotifyTx(subscriberTx)
-	}()
+	logger.Log.Info("ZeroMQ started to listen for txs")
+	go subscriberTx.run()
 }
 
-func zmqNotifyBlock(subscriber *goczmq.Sock) {
-	defer subscriber.Destroy()
-
-	subscriber.SetTcpKeepalive(1)
-	subscriber.SetTcpKeepaliveIdle(120)
-	subscriber.SetTcpKeepaliveCnt(10)
-	subscriber.SetTcpKeepaliveIntvl(3)
-
-	logger.Log.Info("zmq block conf",
-		zap.Int("keepalive", subscriber.TcpKeepalive()),
-		zap.Int("keepalive idle", subscriber.TcpKeepaliveIdle()),
-		zap.Int("keepalive count", subscriber.TcpKeepaliveCnt()),
-		zap.Int("keepalive intvl", subscriber.TcpKeepaliveIntvl()),
-	)
+// run 持续接收消息，连接失效时自动重连
+func (s *zmqSubscriber) run() {
+	firstConnect := true
 	for {
-		msg, n, err := subscriber.RecvFrame()
+		subscriber, err := s.dial(s.endpoint, s.topic)
 		if err != nil {
-			logger.Log.Info("Block Error ZMQ RecFrame", zap.Error(err))
+			logger.Log.Error("ZMQ connect failed", zap.String("topic", s.topic), zap.Error(err))
+			time.Sleep(zmqDialRetryDelay)
 			continue
 		}
+		logger.Log.Info("zmq connected", zap.String("topic", s.topic))
 
-		if len(msg) == 4 {
-			// id
-			// logger.Log.Info("zmq id", zap.Int("n", n), zap.Uint32("id", binary.LittleEndian.Uint32(msg)))
+		// 重连期间可能丢失消息
+		s.hasSeq = false
+		if !firstConnect {
+			s.onGap()
+		}
+		firstConnect = false
 
-		} else if len(msg) == 9 {
-			// topic
-			// logger.Log.Info("sub received", zap.Int("n", n), zap.String("topic", string(msg)))
+		s.recvLoop(subscriber)
+		subscriber.Close()
 
-		} else if len(msg) == 32 {
-			blockIdHex := hex.EncodeToString(msg)
-			logger.Log.Info("new block received", zap.String("blkid", blockIdHex))
-			NewBlockNotify <- blockIdHex
-		} else {
-			logger.Log.Info("bytes received", zap.Int("n", n), zap.Int("len", len(msg)))
-		}
+		logger.Log.Info("zmq reconnect", zap.String("topic", s.topic))
+		time.Sleep(zmqReconnectDelay)
 	}
 }
 
-func zmqNotifyTx(subscriber *goczmq.Sock) {
-	defer subscriber.Destroy()
-
-	subscriber.SetTcpKeepalive(1)
-	subscriber.SetTcpKeepaliveIdle(120)
-	subscriber.SetTcpKeepaliveCnt(10)
-	subscriber.SetTcpKeepaliveIntvl(3)
-
-	logger.Log.Info("zmq tx conf",
-		zap.Int("keepalive", subscriber.TcpKeepalive()),
-		zap.Int("keepalive idle", subscriber.TcpKeepaliveIdle()),
-		zap.Int("keepalive count", subscriber.TcpKeepaliveCnt()),
-		zap.Int("keepalive intvl", subscriber.TcpKeepaliveIntvl()),
-	)
+// recvLoop 接收消息直到连接出错或超时无消息
+func (s *zmqSubscriber) recvLoop(subscriber zmqSocket) {
+	lastRecv := time.Now()
 	for {
-		msg, n, err := subscriber.RecvFrame()
+		msg, err := subscriber.RecvMessage()
 		if err != nil {
-			logger.Log.Info("Tx Error ZMQ RecFrame", zap.Int("n", n), zap.Error(err))
+			if err != errZmqTimeout {
+				logger.Log.Info("zmq recv failed", zap.String("topic", s.topic), zap.Error(err))
+				return
+			}
+			// 长时间无消息则需要重连
+			if time.Since(lastRecv) > s.timeout {
+				logger.Log.Info("zmq timeout",
+					zap.String("topic", s.topic),
+					zap.Duration("silence", time.Since(lastRecv)),
+					zap.Error(err))
+				return
+			}
 			continue
 		}
+		lastRecv = time.Now()
 
-		if len(msg) == 4 {
-			// id
-			// logger.Log.Info("zmq id", zap.Int("n", n), zap.Uint32("id", binary.LittleEndian.Uint32(msg)))
+		// frames: topic, body, seq
+		if len(msg) != 3 || string(msg[0]) != s.topic || len(msg[2]) != 4 {
+			logger.Log.Info("zmq bad message", zap.String("topic", s.topic), zap.Int("nFrames", len(msg)))
+			continue
+		}
 
-		} else if len(msg) == 5 || len(msg) == 6 {
-			// topic
-			// logger.Log.Info("sub received", zap.Int("n", n), zap.String("topic", string(msg)))
+		seq := binary.LittleEndian.Uint32(msg[2])
+		if s.hasSeq && seq != s.lastSeq+1 {
+			logger.Log.Warn("zmq sequence gap",
+				zap.String("topic", s.topic),
+				zap.Uint32("last", s.lastSeq),
+				zap.Uint32("seq", seq))
+			s.onGap()
+		}
+		s.hasSeq = true
+		s.lastSeq = seq
 
-		} else {
+		s.onMessage(msg[1])
+	}
+}
+
+// newBlockSubscriber 订阅新区块通知，消息丢失时触发重新扫描区块
+func newBlockSubscriber(dial func(endpoint, topic string) (zmqSocket, error), endpoint string, timeout time.Duration) *zmqSubscriber {
+	return &zmqSubscriber{
+		dial:     dial,
+		endpoint: endpoint,
+		topic:    "hashblock",
+		timeout:  timeout,
+		onMessage: func(body []byte) {
+			if len(body) != 32 {
+				logger.Log.Info("bytes received", zap.Int("len", len(body)))
+				return
+			}
+			blockIdHex := hex.EncodeToString(body)
+			logger.Log.Info("new block received", zap.String("blkid", blockIdHex))
+			NewBlockNotify <- blockIdHex
+		},
+		onGap: func() {
+			// 可能错过了新区块，触发重新扫描区块
+			select {
+			case NewBlockNotify <- "":
+			default:
+			}
+		},
+	}
+}
+
+// newTxSubscriber 订阅新tx通知，消息丢失时触发内存池对比同步
+func newTxSubscriber(dial func(endpoint, topic string) (zmqSocket, error), endpoint string, timeout time.Duration) *zmqSubscriber {
+	return &zmqSubscriber{
+		dial:     dial,
+		endpoint: endpoint,
+		topic:    "rawtx",
+		timeout:  timeout,
+		onMessage: func(body []byte) {
 			// rawtx
-			RawTxNotify <- msg
-			// logger.Log.Info("new tx received", zap.Int("n", n), zap.Int("rawtxLen", len(msg)))
-		}
+			RawTxNotify <- body
+		},
+		onGap: func() {
+			// 可能错过了部分tx，触发内存池对比同步
+			select {
+			case MempoolResyncNotify <- struct{}{}:
+			default:
+			}
+		},
 	}
 }
@@ -0,0 +1,54 @@
+//go:build czmq
+
+package loader
+
+import (
+	"sensibled/logger"
+
+	"github.com/zeromq/goczmq"
+	"go.uber.org/zap"
+)
+
+// 使用czmq需要CGO和libczmq，编译时加 -tags czmq
+func init() {
+	zmqTransports["czmq"] = newCzmqSocket
+}
+
+type czmqSocket struct {
+	sock *goczmq.Sock
+}
+
+func newCzmqSocket(endpoint, topic string) (zmqSocket, error) {
+	sock, err := goczmq.NewSub(endpoint, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	sock.SetTcpKeepalive(1)
+	sock.SetTcpKeepaliveIdle(zmqTcpKeepaliveIdle)
+	sock.SetTcpKeepaliveCnt(zmqTcpKeepaliveCnt)
+	sock.SetTcpKeepaliveIntvl(zmqTcpKeepaliveIntvl)
+	sock.SetRcvtimeo(1000)
+
+	logger.Log.Info("zmq conf",
+		zap.String("topic", topic),
+		zap.Int("keepalive", sock.TcpKeepalive()),
+		zap.Int("keepalive idle", sock.TcpKeepaliveIdle()),
+		zap.Int("keepalive count", sock.TcpKeepaliveCnt()),
+		zap.Int("keepalive intvl", sock.TcpKeepaliveIntvl()),
+	)
+	return &czmqSocket{sock: sock}, nil
+}
+
+// RecvMessage czmq会自动重连，接收失败均视为超时
+func (s *czmqSocket) RecvMessage() ([][]byte, error) {
+	msg, err := s.sock.RecvMessage()
+	if err != nil {
+		return nil, errZmqTimeout
+	}
+	return msg, nil
+}
+
+func (s *czmqSocket) Close() {
+	s.sock.Destroy()
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package loader
+
+import (
+	"syscall"
+)
+
+// 由setZmqTcpKeepalive设置keepalive参数，禁止net.Dialer覆盖
+const zmqDialerKeepAlive = -1
+
+// setZmqTcpKeepalive 设置tcp keepalive参数，与czmq的SetTcpKeepalive*一致
+func setZmqTcpKeepalive(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); sockErr != nil {
+			return
+		}
+		if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, zmqTcpKeepaliveIdle); sockErr != nil {
+			return
+		}
+		if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, zmqTcpKeepaliveCnt); sockErr != nil {
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, zmqTcpKeepaliveIntvl)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package loader
+
+import (
+	"syscall"
+	"time"
+)
+
+const zmqDialerKeepAlive = zmqTcpKeepaliveIdle * time.Second
+
+// setZmqTcpKeepalive 非linux平台仅使用net.Dialer的KeepAlive设置
+func setZmqTcpKeepalive(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,241 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sensibled/logger"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// nativeZmqSocket 纯Go实现的zmq SUB，支持ZMTP 3.0 NULL认证，无需CGO
+// 参考: https://rfc.zeromq.org/spec/23/
+type nativeZmqSocket struct {
+	conn         net.Conn
+	maxFrameSize uint64
+	msgs         chan [][]byte
+	err          error
+	closed       chan struct{}
+}
+
+const (
+	zmtpFlagMore    = 0x01
+	zmtpFlagLong    = 0x02
+	zmtpFlagCommand = 0x04
+
+	zmtpReadChunk = 1024 * 1024 // 大帧按块读取，避免按帧头长度一次性分配
+)
+
+// zmtpMaxFrameSize 单帧最大长度，超过的消息被丢弃而不断开连接，通过配置zmq_max_frame_size调整
+var zmtpMaxFrameSize uint64 = 4 * 1024 * 1024 * 1024
+
+var errZmtpFrameTooLarge = errors.New("zmq frame too large")
+
+func newNativeZmqSocket(endpoint, topic string) (zmqSocket, error) {
+	if !strings.HasPrefix(endpoint, "tcp://") {
+		return nil, fmt.Errorf("unsupported zmq endpoint: %s", endpoint)
+	}
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: zmqDialerKeepAlive,
+		Control:   setZmqTcpKeepalive,
+	}
+	conn, err := dialer.Dial("tcp", strings.TrimPrefix(endpoint, "tcp://"))
+	if err != nil {
+		return nil, err
+	}
+	return newNativeZmqSocketConn(conn, topic)
+}
+
+// newNativeZmqSocketConn 在已建立的连接上完成握手并开始接收消息
+func newNativeZmqSocketConn(conn net.Conn, topic string) (zmqSocket, error) {
+	s := &nativeZmqSocket{
+		conn:         conn,
+		maxFrameSize: zmtpMaxFrameSize,
+		msgs:         make(chan [][]byte, 1000),
+		closed:       make(chan struct{}),
+	}
+	r := bufio.NewReader(conn)
+
+	// 握手阶段设置超时，之后由keepalive检测连接
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := s.handshake(r, topic); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go s.readLoop(r)
+	return s, nil
+}
+
+// handshake 交换greeting和READY命令，然后订阅topic
+func (s *nativeZmqSocket) handshake(r *bufio.Reader, topic string) error {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3 // version major
+	greeting[11] = 0 // version minor
+	copy(greeting[12:32], "NULL")
+	if _, err := s.conn.Write(greeting); err != nil {
+		return err
+	}
+
+	peerGreeting := make([]byte, 64)
+	if _, err := io.ReadFull(r, peerGreeting); err != nil {
+		return err
+	}
+	if peerGreeting[0] != 0xff || peerGreeting[9] != 0x7f || peerGreeting[10] < 3 {
+		return errors.New("zmq peer greeting not supported")
+	}
+	if mechanism := strings.TrimRight(string(peerGreeting[12:32]), "\x00"); mechanism != "NULL" {
+		return fmt.Errorf("zmq peer mechanism not supported: %s", mechanism)
+	}
+
+	// READY命令
+	ready := []byte{5}
+	ready = append(ready, "READY"...)
+	ready = appendZmtpProperty(ready, "Socket-Type", "SUB")
+	if err := s.writeFrame(zmtpFlagCommand, ready); err != nil {
+		return err
+	}
+
+	flags, body, err := readZmtpFrame(r, s.maxFrameSize)
+	if err != nil {
+		return err
+	}
+	if flags&zmtpFlagCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return errors.New("zmq peer not ready")
+	}
+
+	// 订阅
+	return s.writeFrame(0, append([]byte{1}, topic...))
+}
+
+// readLoop 持续读取消息，跳过命令帧
+// 含超长帧的消息整条丢弃，之后的消息序号不连续，由订阅方对比节点内存池补充
+func (s *nativeZmqSocket) readLoop(r *bufio.Reader) {
+	msg := make([][]byte, 0, 3)
+	tooLarge := false
+	for {
+		flags, body, err := readZmtpFrame(r, s.maxFrameSize)
+		if err == errZmtpFrameTooLarge {
+			tooLarge = true
+		} else if err != nil {
+			s.err = err
+			close(s.msgs)
+			return
+		}
+		if flags&zmtpFlagCommand != 0 {
+			continue
+		}
+		msg = append(msg, body)
+		if flags&zmtpFlagMore != 0 {
+			continue
+		}
+		if tooLarge {
+			logger.Log.Warn("zmq message too large, skipped",
+				zap.Uint64("max", s.maxFrameSize))
+			msg = make([][]byte, 0, 3)
+			tooLarge = false
+			continue
+		}
+		select {
+		case s.msgs <- msg:
+		case <-s.closed:
+			return
+		}
+		msg = make([][]byte, 0, 3)
+	}
+}
+
+func (s *nativeZmqSocket) RecvMessage() ([][]byte, error) {
+	select {
+	case msg, ok := <-s.msgs:
+		if !ok {
+			return nil, s.err
+		}
+		return msg, nil
+	case <-time.After(time.Second):
+		return nil, errZmqTimeout
+	}
+}
+
+func (s *nativeZmqSocket) Close() {
+	close(s.closed)
+	s.conn.Close()
+}
+
+func (s *nativeZmqSocket) writeFrame(flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | zmtpFlagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	_, err := s.conn.Write(append(header, body...))
+	return err
+}
+
+// readZmtpFrame 读取一帧，超过maxSize的帧内容被跳过，返回errZmtpFrameTooLarge
+func readZmtpFrame(r *bufio.Reader, maxSize uint64) (flags byte, body []byte, err error) {
+	flags, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&zmtpFlagLong != 0 {
+		buf := make([]byte, 8)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(buf)
+	} else {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > maxSize {
+		if size > math.MaxInt64 {
+			return 0, nil, fmt.Errorf("zmq bad frame size: %d", size)
+		}
+		if _, err = io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return 0, nil, err
+		}
+		return flags, nil, errZmtpFrameTooLarge
+	}
+	if size <= zmtpReadChunk {
+		body = make([]byte, size)
+		if _, err = io.ReadFull(r, body); err != nil {
+			return 0, nil, err
+		}
+		return flags, body, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, zmtpReadChunk))
+	if _, err = io.CopyN(buf, r, int64(size)); err != nil {
+		return 0, nil, err
+	}
+	return flags, buf.Bytes(), nil
+}
+
+func appendZmtpProperty(buf []byte, name, value string) []byte {
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(value)))
+	buf = append(buf, size...)
+	return append(buf, value...)
+}
@@ -0,0 +1,255 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubZmqPublisher net.Pipe另一端模拟的zmq PUB
+type stubZmqPublisher struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *nativeZmqSocket // 仅用于写帧
+}
+
+func newStubZmqPublisher(conn net.Conn) *stubZmqPublisher {
+	return &stubZmqPublisher{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    &nativeZmqSocket{conn: conn},
+	}
+}
+
+func stubZmtpGreeting(mechanism string) []byte {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	copy(greeting[12:32], mechanism)
+	return greeting
+}
+
+// handshake 完成PUB端握手，返回订阅的topic
+func (p *stubZmqPublisher) handshake() (string, error) {
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(p.r, greeting); err != nil {
+		return "", err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f || greeting[10] != 3 ||
+		strings.TrimRight(string(greeting[12:32]), "\x00") != "NULL" {
+		return "", errors.New("bad greeting")
+	}
+	if _, err := p.conn.Write(stubZmtpGreeting("NULL")); err != nil {
+		return "", err
+	}
+
+	flags, body, err := readZmtpFrame(p.r, zmtpMaxFrameSize)
+	if err != nil {
+		return "", err
+	}
+	if flags&zmtpFlagCommand == 0 || string(body[1:6]) != "READY" {
+		return "", errors.New("bad ready command")
+	}
+	if !bytes.Equal(body[6:], appendZmtpProperty(nil, "Socket-Type", "SUB")) {
+		return "", errors.New("bad ready properties")
+	}
+	ready := append([]byte{5}, "READY"...)
+	ready = appendZmtpProperty(ready, "Socket-Type", "PUB")
+	if err := p.w.writeFrame(zmtpFlagCommand, ready); err != nil {
+		return "", err
+	}
+
+	flags, body, err = readZmtpFrame(p.r, zmtpMaxFrameSize)
+	if err != nil {
+		return "", err
+	}
+	if flags&zmtpFlagCommand != 0 || len(body) == 0 || body[0] != 1 {
+		return "", errors.New("bad subscribe")
+	}
+	return string(body[1:]), nil
+}
+
+// publish 发送topic、body、seq三帧消息
+func (p *stubZmqPublisher) publish(topic string, body []byte, seq uint32) error {
+	seqBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seqBytes, seq)
+	if err := p.w.writeFrame(zmtpFlagMore, []byte(topic)); err != nil {
+		return err
+	}
+	if err := p.w.writeFrame(zmtpFlagMore, body); err != nil {
+		return err
+	}
+	return p.w.writeFrame(0, seqBytes)
+}
+
+// connectStubZmq 通过net.Pipe连接stub PUB，返回订阅端和PUB端
+func connectStubZmq(t *testing.T, topic string) (zmqSocket, *stubZmqPublisher) {
+	t.Helper()
+	client, server := net.Pipe()
+	pub := newStubZmqPublisher(server)
+
+	subscribed := make(chan error, 1)
+	go func() {
+		gotTopic, err := pub.handshake()
+		if err == nil && gotTopic != topic {
+			err = errors.New("subscribed topic " + gotTopic)
+		}
+		subscribed <- err
+	}()
+
+	socket, err := newNativeZmqSocketConn(client, topic)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if err := <-subscribed; err != nil {
+		t.Fatalf("publisher handshake failed: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		socket.Close()
+	})
+	return socket, pub
+}
+
+func recvStubZmq(t *testing.T, socket zmqSocket) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		msg, err := socket.RecvMessage()
+		if err == errZmqTimeout {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("recv failed: %v", err)
+		}
+		return msg
+	}
+	t.Fatal("recv timeout")
+	return nil
+}
+
+func TestNativeZmqHandshakeAndMultipart(t *testing.T) {
+	socket, pub := connectStubZmq(t, "rawtx")
+
+	short := []byte("short body")
+	long := bytes.Repeat([]byte{0xab}, 70000) // 超过255字节，使用长帧
+	go func() {
+		pub.publish("rawtx", short, 1)
+		// 消息之间的命令帧被跳过
+		pub.w.writeFrame(zmtpFlagCommand, append([]byte{4}, "PING"...))
+		pub.publish("rawtx", long, 2)
+	}()
+
+	for i, want := range [][]byte{short, long} {
+		msg := recvStubZmq(t, socket)
+		if len(msg) != 3 {
+			t.Fatalf("message %d frames %d, want 3", i, len(msg))
+		}
+		if string(msg[0]) != "rawtx" {
+			t.Fatalf("message %d topic %s", i, msg[0])
+		}
+		if !bytes.Equal(msg[1], want) {
+			t.Fatalf("message %d body len %d, want %d", i, len(msg[1]), len(want))
+		}
+		if seq := binary.LittleEndian.Uint32(msg[2]); seq != uint32(i+1) {
+			t.Fatalf("message %d seq %d", i, seq)
+		}
+	}
+}
+
+func TestNativeZmqSkipTooLargeMessage(t *testing.T) {
+	maxFrameSize := zmtpMaxFrameSize
+	zmtpMaxFrameSize = 1000
+	defer func() { zmtpMaxFrameSize = maxFrameSize }()
+
+	socket, pub := connectStubZmq(t, "rawtx")
+	go func() {
+		pub.publish("rawtx", bytes.Repeat([]byte{1}, 2000), 1)
+		pub.publish("rawtx", []byte("next"), 2)
+	}()
+
+	// 超长消息被丢弃，连接保持，后续消息正常接收
+	msg := recvStubZmq(t, socket)
+	if string(msg[1]) != "next" || binary.LittleEndian.Uint32(msg[2]) != 2 {
+		t.Fatalf("unexpected message %s", msg[1])
+	}
+}
+
+func TestNativeZmqPeerClosed(t *testing.T) {
+	socket, pub := connectStubZmq(t, "hashblock")
+	pub.conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err := socket.RecvMessage()
+		if err == errZmqTimeout {
+			continue
+		}
+		if err == nil {
+			t.Fatal("unexpected message")
+		}
+		return
+	}
+	t.Fatal("peer close not detected")
+}
+
+func TestNativeZmqRejectMechanism(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		io.ReadFull(server, make([]byte, 64))
+		server.Write(stubZmtpGreeting("CURVE"))
+	}()
+
+	if _, err := newNativeZmqSocketConn(client, "rawtx"); err == nil {
+		t.Fatal("handshake with CURVE peer should fail")
+	}
+}
+
+func TestReadZmtpFrame(t *testing.T) {
+	var buf bytes.Buffer
+	w := &nativeZmqSocket{conn: &bufferConn{buf: &buf}}
+
+	large := bytes.Repeat([]byte{7}, 3*zmtpReadChunk+1)
+	w.writeFrame(zmtpFlagMore, []byte("tiny"))
+	w.writeFrame(0, large)
+	w.writeFrame(0, bytes.Repeat([]byte{9}, 300))
+	w.writeFrame(0, []byte("after"))
+
+	r := bufio.NewReader(&buf)
+	flags, body, err := readZmtpFrame(r, zmtpMaxFrameSize)
+	if err != nil || flags != zmtpFlagMore || string(body) != "tiny" {
+		t.Fatalf("short frame: flags %d body %q err %v", flags, body, err)
+	}
+	flags, body, err = readZmtpFrame(r, zmtpMaxFrameSize)
+	if err != nil || flags != zmtpFlagLong || !bytes.Equal(body, large) {
+		t.Fatalf("long frame: flags %d len %d err %v", flags, len(body), err)
+	}
+	if _, _, err = readZmtpFrame(r, 100); err != errZmtpFrameTooLarge {
+		t.Fatalf("too large frame err %v", err)
+	}
+	// 超长帧内容已跳过，后续帧可继续读取
+	if _, body, err = readZmtpFrame(r, 100); err != nil || string(body) != "after" {
+		t.Fatalf("frame after skipped: body %q err %v", body, err)
+	}
+	if _, _, err = readZmtpFrame(r, 100); err != io.EOF {
+		t.Fatalf("eof err %v", err)
+	}
+}
+
+// bufferConn 将写入保存到内存，仅用于构造帧
+type bufferConn struct {
+	net.Conn
+	buf *bytes.Buffer
+}
+
+func (c *bufferConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
@@ -0,0 +1,205 @@
+package loader
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubZmqSocket 按脚本返回消息的zmq连接，脚本结束后返回连接断开
+type stubZmqSocket struct {
+	recvs   []stubZmqRecv
+	idle    bool          // 脚本结束后持续返回超时，而不是断开
+	release chan struct{} // 非nil时，脚本结束后等待关闭再断开
+}
+
+type stubZmqRecv struct {
+	msg [][]byte
+	err error
+}
+
+func (s *stubZmqSocket) RecvMessage() ([][]byte, error) {
+	if len(s.recvs) == 0 {
+		if s.idle {
+			time.Sleep(5 * time.Millisecond)
+			return nil, errZmqTimeout
+		}
+		if s.release != nil {
+			<-s.release
+		}
+		return nil, io.EOF
+	}
+	r := s.recvs[0]
+	s.recvs = s.recvs[1:]
+	return r.msg, r.err
+}
+
+func (s *stubZmqSocket) Close() {}
+
+func stubZmqMessage(topic string, body []byte, seq uint32) stubZmqRecv {
+	seqBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seqBytes, seq)
+	return stubZmqRecv{msg: [][]byte{[]byte(topic), body, seqBytes}}
+}
+
+// stubZmqDialer 依次返回预置的连接，全部用完后阻塞
+type stubZmqDialer struct {
+	mu      sync.Mutex
+	sockets []*stubZmqSocket
+	nDial   int
+}
+
+func (d *stubZmqDialer) dial(endpoint, topic string) (zmqSocket, error) {
+	d.mu.Lock()
+	if d.nDial >= len(d.sockets) {
+		d.mu.Unlock()
+		select {}
+	}
+	socket := d.sockets[d.nDial]
+	d.nDial++
+	d.mu.Unlock()
+	return socket, nil
+}
+
+func (d *stubZmqDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nDial
+}
+
+func TestMain(m *testing.M) {
+	// 测试中缩短重连等待时间
+	zmqDialRetryDelay, zmqReconnectDelay = time.Millisecond, time.Millisecond
+	os.Exit(m.Run())
+}
+
+func drainZmqNotify() {
+	for {
+		select {
+		case <-NewBlockNotify:
+		case <-RawTxNotify:
+		case <-MempoolResyncNotify:
+		default:
+			return
+		}
+	}
+}
+
+func TestZmqSubscriberSequenceGap(t *testing.T) {
+	nGap := 0
+	bodies := make([]string, 0)
+	s := &zmqSubscriber{
+		topic:     "rawtx",
+		timeout:   time.Minute,
+		onMessage: func(body []byte) { bodies = append(bodies, string(body)) },
+		onGap:     func() { nGap++ },
+	}
+
+	socket := &stubZmqSocket{recvs: []stubZmqRecv{
+		stubZmqMessage("rawtx", []byte("a"), 1),
+		stubZmqMessage("rawtx", []byte("b"), 2),
+		stubZmqMessage("rawtx", []byte("c"), 4), // 丢失3
+		{err: errZmqTimeout},
+		stubZmqMessage("rawtx", []byte("d"), 5),
+		stubZmqMessage("hashblock", []byte("x"), 6), // 错误topic，忽略
+		stubZmqMessage("rawtx", []byte("e"), 0xffffffff),
+		stubZmqMessage("rawtx", []byte("f"), 0), // 序号回绕
+	}}
+	s.recvLoop(socket)
+
+	if nGap != 2 {
+		t.Fatalf("gap count %d, want 2", nGap)
+	}
+	if got := len(bodies); got != 6 {
+		t.Fatalf("message count %d, want 6", got)
+	}
+}
+
+func TestZmqTxSubscriberResyncAndReconnect(t *testing.T) {
+	drainZmqNotify()
+
+	release := make(chan struct{})
+	dialer := &stubZmqDialer{sockets: []*stubZmqSocket{
+		{recvs: []stubZmqRecv{
+			stubZmqMessage("rawtx", []byte("tx1"), 1),
+			stubZmqMessage("rawtx", []byte("tx3"), 3),
+		}, release: release},
+		{recvs: []stubZmqRecv{
+			stubZmqMessage("rawtx", []byte("tx100"), 100),
+		}, idle: true},
+	}}
+	s := newTxSubscriber(dialer.dial, "stub", time.Minute)
+	go s.run()
+
+	expectRawTx(t, "tx1")
+	expectRawTx(t, "tx3")
+	expectResync(t) // 序号不连续
+
+	// 连接断开后重连，重连期间可能丢失消息
+	close(release)
+	expectResync(t)
+	// 重连后序号重新开始跟踪，不视为丢失
+	expectRawTx(t, "tx100")
+	expectNoResync(t)
+
+	if n := dialer.count(); n != 2 {
+		t.Fatalf("dial count %d, want 2", n)
+	}
+}
+
+func TestZmqBlockSubscriberTimeoutReconnect(t *testing.T) {
+	drainZmqNotify()
+
+	dialer := &stubZmqDialer{sockets: []*stubZmqSocket{
+		{idle: true},
+		{idle: true},
+	}}
+	s := newBlockSubscriber(dialer.dial, "stub", 30*time.Millisecond)
+	go s.run()
+
+	// 长时间无消息则重连，并触发重新扫描区块
+	select {
+	case blockIdHex := <-NewBlockNotify:
+		if blockIdHex != "" {
+			t.Fatalf("unexpected block notify %s", blockIdHex)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no block rescan after timeout reconnect")
+	}
+	if n := dialer.count(); n != 2 {
+		t.Fatalf("dial count %d, want 2", n)
+	}
+}
+
+func expectRawTx(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case body := <-RawTxNotify:
+		if string(body) != want {
+			t.Fatalf("rawtx %s, want %s", body, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("rawtx %s not received", want)
+	}
+}
+
+func expectResync(t *testing.T) {
+	t.Helper()
+	select {
+	case <-MempoolResyncNotify:
+	case <-time.After(2 * time.Second):
+		t.Fatal("mempool resync not triggered")
+	}
+}
+
+func expectNoResync(t *testing.T) {
+	t.Helper()
+	select {
+	case <-MempoolResyncNotify:
+		t.Fatal("unexpected mempool resync")
+	default:
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const sqlDoubleSpendPattern string = "INSERT INTO double_spend (utxid, vout, address, codehash, genesis, code_type, txid, conflict_txid, conflict_height, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+type doubleSpendKeyDO struct {
+	UTxid        []byte
+	Vout         uint32
+	TxId         []byte
+	ConflictTxId []byte
+}
+
+func doubleSpendKeyResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret doubleSpendKeyDO
+	err := rows.Scan(&ret.UTxid, &ret.Vout, &ret.TxId, &ret.ConflictTxId)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func doubleSpendKey(utxid []byte, vout uint32, txid, conflictTxid []byte) string {
+	return fmt.Sprintf("%s%d%s%s", utxid, vout, txid, conflictTxid)
+}
+
+// filterNewDoubleSpends 去掉批次内重复、以及已保存的重复花费记录
+func filterNewDoubleSpends(records []*model.DoubleSpend) ([]*model.DoubleSpend, error) {
+	outpointConds := make([]string, 0, len(records))
+	outpoints := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		outpoint := fmt.Sprintf("(%s, %d)", clickhouse.Unhex(hex.EncodeToString(r.UTxid)), r.Vout)
+		if _, ok := outpoints[outpoint]; ok {
+			continue
+		}
+		outpoints[outpoint] = struct{}{}
+		outpointConds = append(outpointConds, outpoint)
+	}
+
+	psql := fmt.Sprintf("SELECT utxid, vout, txid, conflict_txid FROM double_spend WHERE (utxid, vout) IN (%s)",
+		strings.Join(outpointConds, ","))
+	savedRet, err := clickhouse.ScanAll(psql, doubleSpendKeyResultSRF)
+	if err != nil {
+		return nil, err
+	}
+	savedKeys := make(map[string]struct{}, 0)
+	if savedRet != nil {
+		for _, saved := range savedRet.([]*doubleSpendKeyDO) {
+			savedKeys[doubleSpendKey(saved.UTxid, saved.Vout, saved.TxId, saved.ConflictTxId)] = struct{}{}
+		}
+	}
+
+	newRecords := make([]*model.DoubleSpend, 0, len(records))
+	for _, r := range records {
+		key := doubleSpendKey(r.UTxid, r.Vout, r.TxId, r.ConflictTxId)
+		if _, ok := savedKeys[key]; ok {
+			continue
+		}
+		savedKeys[key] = struct{}{}
+		newRecords = append(newRecords, r)
+	}
+	return newRecords, nil
+}
+
+// SaveDoubleSpendCk 保存重复花费记录，已保存的冲突不再重复写入
+func SaveDoubleSpendCk(records []*model.DoubleSpend) bool {
+	if len(records) == 0 {
+		return true
+	}
+	records, err := filterNewDoubleSpends(records)
+	if err != nil {
+		logger.Log.Error("query saved double spend failed", zap.Error(err))
+		return false
+	}
+	if len(records) == 0 {
+		return true
+	}
+
+	tx, err := clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync-begin-double-spend", zap.Error(err))
+		return false
+	}
+	stmt, err := tx.Prepare(clickhouse.Rebind(sqlDoubleSpendPattern))
+	if err != nil {
+		logger.Log.Error("sync-prepare-double-spend", zap.Error(err))
+		return false
+	}
+	for _, r := range records {
+		if _, err := stmt.Exec(
+			string(r.UTxid),
+			r.Vout,
+			string(r.AddressPkh),
+			string(r.CodeHash),
+			string(r.GenesisId),
+			r.CodeType,
+			string(r.TxId),
+			string(r.ConflictTxId),
+			r.ConflictHeight,
+			r.Timestamp,
+		); err != nil {
+			logger.Log.Error("sync-exec-double-spend", zap.Error(err))
+			return false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("sync-commit-double-spend", zap.Error(err))
+		return false
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"sensibled/loader/clickhouse"
 	"sensibled/logger"
+	blockStore "sensibled/store"
 
 	"go.uber.org/zap"
 )
@@ -15,6 +16,10 @@ var (
 		"ALTER TABLE txin_spent DROP PARTITION '2045222'",
 		"ALTER TABLE txin DROP PARTITION '2045222'",
 		"ALTER TABLE txout DROP PARTITION '2045222'",
+		blockStore.SqlCreateNFTAuctionTable,
+		"ALTER TABLE nft_auction_event DROP PARTITION '2045222'",
+		blockStore.SqlCreateSwapCandleTable,
+		"ALTER TABLE swap_candle DROP PARTITION '2045222'",
 	}
 
 	createPartSQLs = []string{
@@ -22,18 +27,24 @@ var (
 		"DROP TABLE IF EXISTS blktx_height_mempool_new",
 		"DROP TABLE IF EXISTS txout_mempool_new",
 		"DROP TABLE IF EXISTS txin_mempool_new",
+		"DROP TABLE IF EXISTS nft_auction_event_mempool_new",
+		"DROP TABLE IF EXISTS swap_candle_mempool_new",
 
 		"CREATE TABLE IF NOT EXISTS blktx_contract_height_mempool_new AS blktx_contract_height",
 		"CREATE TABLE IF NOT EXISTS blktx_height_mempool_new AS blktx_height",
 		"CREATE TABLE IF NOT EXISTS txout_mempool_new AS txout",
 		"CREATE TABLE IF NOT EXISTS txin_mempool_new AS txin",
+		blockStore.SqlCreateNFTAuctionTable,
+		"CREATE TABLE IF NOT EXISTS nft_auction_event_mempool_new AS nft_auction_event",
+		blockStore.SqlCreateSwapCandleTable,
+		"CREATE TABLE IF NOT EXISTS swap_candle_mempool_new AS swap_candle",
 	}
 
 	// 更新现有基础数据表blktx_contract_height、blktx_height、txin、txout
 	processPartSQLsForTxIn = []string{
 		"INSERT INTO txin SELECT * FROM txin_mempool_new",
 		// 更新txo被花费的tx索引
-		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout FROM txin_mempool_new",
+		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout, blkid FROM txin_mempool_new",
 
 		"DROP TABLE IF EXISTS txin_mempool_new",
 	}
@@ -46,9 +57,13 @@ var (
 	processPartSQLs = []string{
 		"INSERT INTO blktx_contract_height SELECT * FROM blktx_contract_height_mempool_new;",
 		"INSERT INTO blktx_height SELECT * FROM blktx_height_mempool_new;",
+		"INSERT INTO nft_auction_event SELECT * FROM nft_auction_event_mempool_new;",
+		"INSERT INTO swap_candle SELECT * FROM swap_candle_mempool_new;",
 
 		"DROP TABLE IF EXISTS blktx_contract_height_mempool_new",
 		"DROP TABLE IF EXISTS blktx_height_mempool_new",
+		"DROP TABLE IF EXISTS nft_auction_event_mempool_new",
+		"DROP TABLE IF EXISTS swap_candle_mempool_new",
 	}
 )
 
@@ -74,6 +89,9 @@ func ProcessPartSyncCk() bool {
 }
 
 func ProcessSyncCk(processSQLs []string) bool {
+	if clickhouse.IsPostgres {
+		return blockStore.ProcessSyncPg(processSQLs)
+	}
 	for _, psql := range processSQLs {
 		partLen := len(psql)
 		if partLen > 96 {
@@ -88,3 +106,77 @@ func ProcessSyncCk(processSQLs []string) bool {
 	}
 	return true
 }
+
+var (
+	// 内存池数据所在的表及其txid字段
+	mempoolTxidColumns = [][2]string{
+		{"blktx_contract_height", "txid"},
+		{"blktx_height", "txid"},
+		{"txin_spent", "txid"},
+		{"txin", "txid"},
+		{"txout", "utxid"},
+		{"nft_auction_event", "txid"},
+		{"swap_candle", "txid"},
+	}
+
+	createRemoveTxidSQLs = []string{
+		"DROP TABLE IF EXISTS txid_mempool_remove",
+		"CREATE TABLE IF NOT EXISTS txid_mempool_remove (txid FixedString(32)) engine=Memory",
+	}
+)
+
+// RemoveTxsSyncCk 从db删除部分mempool tx数据，保留其余部分
+// ck无法直接删除分区内的部分记录，先将需要保留的记录写入临时表，再以REPLACE PARTITION原子替换整个mempool分区
+func RemoveTxsSyncCk(txids []string) bool {
+	if len(txids) == 0 {
+		return true
+	}
+	logger.Log.Info("sync mempool sql: remove", zap.Int("nTx", len(txids)))
+
+	if !ProcessSyncCk(createRemoveTxidSQLs) {
+		return false
+	}
+
+	tx, err := clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync-begin-remove-txid", zap.Error(err))
+		return false
+	}
+	stmt, err := tx.Prepare(clickhouse.Rebind("INSERT INTO txid_mempool_remove (txid) VALUES (?)"))
+	if err != nil {
+		logger.Log.Error("sync-prepare-remove-txid", zap.Error(err))
+		return false
+	}
+	for _, txid := range txids {
+		if _, err := stmt.Exec(txid); err != nil {
+			logger.Log.Error("sync-exec-remove-txid", zap.Error(err))
+			return false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("sync-commit-remove-txid", zap.Error(err))
+		return false
+	}
+
+	for _, tc := range mempoolTxidColumns {
+		table, column := tc[0], tc[1]
+		sqls := []string{
+			"DROP TABLE IF EXISTS " + table + "_mempool_keep",
+			"CREATE TABLE IF NOT EXISTS " + table + "_mempool_keep AS " + table,
+			"INSERT INTO " + table + "_mempool_keep SELECT * FROM " + table +
+				" WHERE height = 4294967295 AND " + column + " NOT IN (SELECT txid FROM txid_mempool_remove)",
+			"ALTER TABLE " + table + " REPLACE PARTITION '2045222' FROM " + table + "_mempool_keep",
+			"DROP TABLE IF EXISTS " + table + "_mempool_keep",
+		}
+		if clickhouse.IsPostgres {
+			// PostgreSQL可以直接删除部分记录
+			sqls = []string{
+				"DELETE FROM " + table + " WHERE height = 4294967295 AND " + column + " IN (SELECT txid FROM txid_mempool_remove)",
+			}
+		}
+		if !ProcessSyncCk(sqls) {
+			return false
+		}
+	}
+	return ProcessSyncCk([]string{"DROP TABLE IF EXISTS txid_mempool_remove"})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sensibled/loader/clickhouse"
 	"sensibled/logger"
+	blockStore "sensibled/store"
 
 	"go.uber.org/zap"
 )
@@ -14,11 +15,15 @@ var (
 	SyncStmtTx         *sql.Stmt
 	SyncStmtTxOut      *sql.Stmt
 	SyncStmtTxIn       *sql.Stmt
+	SyncStmtNFTAuction *sql.Stmt
+	SyncStmtSwapCandle *sql.Stmt
 
 	syncTxContract *sql.Tx
 	syncTx         *sql.Tx
 	syncTxOut      *sql.Tx
 	syncTxIn       *sql.Tx
+	syncNFTAuction *sql.Tx
+	syncSwapCandle *sql.Tx
 )
 
 const (
@@ -33,6 +38,8 @@ func prepareSyncCk() bool {
 	sqlTx := fmt.Sprintf(sqlTxPattern, "blktx_height_mempool_new")
 	sqlTxOut := fmt.Sprintf(sqlTxOutPattern, "txout_mempool_new")
 	sqlTxIn := fmt.Sprintf(sqlTxInPattern, "txin_mempool_new")
+	sqlNFTAuction := fmt.Sprintf(blockStore.SqlNFTAuctionPattern, "nft_auction_event_mempool_new")
+	sqlSwapCandle := fmt.Sprintf(blockStore.SqlSwapCandlePattern, "swap_candle_mempool_new")
 
 	var err error
 
@@ -41,7 +48,7 @@ func prepareSyncCk() bool {
 		logger.Log.Error("sync-begin-blk-contract", zap.Error(err))
 		return false
 	}
-	SyncStmtTxContract, err = syncTxContract.Prepare(sqlTxContract)
+	SyncStmtTxContract, err = syncTxContract.Prepare(clickhouse.Rebind(sqlTxContract))
 	if err != nil {
 		logger.Log.Error("sync-prepare-blk-contract", zap.Error(err))
 		return false
@@ -52,7 +59,7 @@ func prepareSyncCk() bool {
 		logger.Log.Error("sync-begin-tx", zap.Error(err))
 		return false
 	}
-	SyncStmtTx, err = syncTx.Prepare(sqlTx)
+	SyncStmtTx, err = syncTx.Prepare(clickhouse.Rebind(sqlTx))
 	if err != nil {
 		logger.Log.Error("sync-prepare-tx", zap.Error(err))
 		return false
@@ -63,7 +70,7 @@ func prepareSyncCk() bool {
 		logger.Log.Error("sync-begin-txout", zap.Error(err))
 		return false
 	}
-	SyncStmtTxOut, err = syncTxOut.Prepare(sqlTxOut)
+	SyncStmtTxOut, err = syncTxOut.Prepare(clickhouse.Rebind(sqlTxOut))
 	if err != nil {
 		logger.Log.Error("sync-prepare-txout", zap.Error(err))
 		return false
@@ -74,12 +81,34 @@ func prepareSyncCk() bool {
 		logger.Log.Error("sync-begin-txinfull", zap.Error(err))
 		return false
 	}
-	SyncStmtTxIn, err = syncTxIn.Prepare(sqlTxIn)
+	SyncStmtTxIn, err = syncTxIn.Prepare(clickhouse.Rebind(sqlTxIn))
 	if err != nil {
 		logger.Log.Error("sync-prepare-txinfull", zap.Error(err))
 		return false
 	}
 
+	syncNFTAuction, err = clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync-begin-nft-auction", zap.Error(err))
+		return false
+	}
+	SyncStmtNFTAuction, err = syncNFTAuction.Prepare(clickhouse.Rebind(sqlNFTAuction))
+	if err != nil {
+		logger.Log.Error("sync-prepare-nft-auction", zap.Error(err))
+		return false
+	}
+
+	syncSwapCandle, err = clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync-begin-swap-candle", zap.Error(err))
+		return false
+	}
+	SyncStmtSwapCandle, err = syncSwapCandle.Prepare(clickhouse.Rebind(sqlSwapCandle))
+	if err != nil {
+		logger.Log.Error("sync-prepare-swap-candle", zap.Error(err))
+		return false
+	}
+
 	return true
 }
 
@@ -93,6 +122,8 @@ func CommitSyncCk() bool {
 	defer SyncStmtTxOut.Close()
 	defer SyncStmtTxIn.Close()
 	defer SyncStmtTxContract.Close()
+	defer SyncStmtNFTAuction.Close()
+	defer SyncStmtSwapCandle.Close()
 
 	isOk := true
 	if err := syncTx.Commit(); err != nil {
@@ -111,5 +142,13 @@ func CommitSyncCk() bool {
 		logger.Log.Error("sync-commit-tx-contract", zap.Error(err))
 		isOk = false
 	}
+	if err := syncNFTAuction.Commit(); err != nil {
+		logger.Log.Error("sync-commit-nft-auction", zap.Error(err))
+		isOk = false
+	}
+	if err := syncSwapCandle.Commit(); err != nil {
+		logger.Log.Error("sync-commit-swap-candle", zap.Error(err))
+		isOk = false
+	}
 	return isOk
 }
@@ -0,0 +1,141 @@
+package task
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sensibled/logger"
+	"sensibled/mempool/store"
+	"sensibled/mempool/task/serial"
+	"sensibled/model"
+	"sensibled/utils"
+	"time"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// checkConfirmedDoubleSpend 检查tx输入是否已被确认tx花费
+func (mp *Mempool) checkConfirmedDoubleSpend(tx *model.Tx, outpointKey string, confirmedSpentTxos map[string]*model.TxoSpentDO) bool {
+	if spent, ok := model.GlobalConfirmedSpentUtxoMap[outpointKey]; ok {
+		if bytes.Equal(spent.TxId, tx.TxId) {
+			return false
+		}
+		// 当前区块花费的utxo信息
+		data, _ := model.GlobalSpentUtxoDataMap.Get(outpointKey)
+		mp.addDoubleSpend(tx, outpointKey, spent.TxId, spent.Height, data)
+		return true
+	}
+
+	spent, ok := confirmedSpentTxos[outpointKey]
+	if !ok || bytes.Equal(spent.TxId, tx.TxId) {
+		return false
+	}
+	mp.DoubleSpends = append(mp.DoubleSpends, &model.DoubleSpend{
+		UTxid:          spent.UTxid,
+		Vout:           spent.Vout,
+		AddressPkh:     spent.Address,
+		CodeHash:       spent.CodeHash,
+		GenesisId:      spent.Genesis,
+		CodeType:       spent.CodeType,
+		TxId:           tx.TxId,
+		ConflictTxId:   spent.TxId,
+		ConflictHeight: spent.Height,
+		Timestamp:      uint32(time.Now().Unix()),
+	})
+	return true
+}
+
+// checkMempoolDoubleSpend 检查当前批次tx输入是否已被其他内存池tx花费
+// 先出现的tx有效，冲突tx及其在当前批次中的后代从批次中移除，不再同步。BatchTxs需已按依赖排序
+func (mp *Mempool) checkMempoolDoubleSpend() {
+	batchSpentTxs := make(map[string]*model.Tx, 0)
+	conflictTxIds := make(map[string]struct{}, 0)
+	batchTxs := make([]*model.Tx, 0, len(mp.BatchTxs))
+	for _, tx := range mp.BatchTxs {
+		conflicted := false
+		for _, input := range tx.TxIns {
+			outpointKey := input.InputOutpointKey
+			if _, ok := conflictTxIds[outpointKey[:32]]; ok {
+				conflicted = true
+				continue
+			}
+			if spentTxid, ok := mp.SpentByTxs[outpointKey]; ok && spentTxid != string(tx.TxId) {
+				data, ok := mp.MempoolSpentUtxoMap[outpointKey]
+				if !ok {
+					data = mp.ConfirmedSpentUtxoMap[outpointKey]
+				}
+				mp.addDoubleSpend(tx, outpointKey, []byte(spentTxid), model.MEMPOOL_HEIGHT, data)
+				conflicted = true
+
+			} else if spentTx, ok := batchSpentTxs[outpointKey]; ok && spentTx != tx {
+				data, ok := model.GlobalMempoolNewUtxoDataMap[outpointKey]
+				if !ok {
+					data, _ = model.GlobalNewUtxoDataMap.Get(outpointKey)
+				}
+				mp.addDoubleSpend(tx, outpointKey, spentTx.TxId, model.MEMPOOL_HEIGHT, data)
+				conflicted = true
+			}
+		}
+		if conflicted {
+			// 与先出现的内存池tx冲突，不再同步
+			logger.Log.Info("skip mempool double spend tx", zap.String("txid", tx.TxIdHex))
+			conflictTxIds[string(tx.TxId)] = struct{}{}
+			mp.SkipTxs[tx.TxIdHex] = struct{}{}
+			continue
+		}
+		for _, input := range tx.TxIns {
+			batchSpentTxs[input.InputOutpointKey] = tx
+		}
+		batchTxs = append(batchTxs, tx)
+	}
+	mp.BatchTxs = batchTxs
+}
+
+// addDoubleSpend 记录重复花费，data为被花费的utxo信息，可能为nil
+func (mp *Mempool) addDoubleSpend(tx *model.Tx, outpointKey string, conflictTxId []byte, conflictHeight uint32, data *model.TxoData) {
+	record := &model.DoubleSpend{
+		UTxid:          []byte(outpointKey[:32]),
+		Vout:           binary.LittleEndian.Uint32([]byte(outpointKey[32:])),
+		TxId:           tx.TxId,
+		ConflictTxId:   conflictTxId,
+		ConflictHeight: conflictHeight,
+		Timestamp:      uint32(time.Now().Unix()),
+	}
+	if data != nil && data.Data != nil {
+		if data.Data.HasAddress {
+			record.AddressPkh = data.Data.AddressPkh[:]
+		}
+		if data.Data.CodeType != scriptDecoder.CodeType_NONE {
+			record.CodeHash = data.Data.CodeHash[:]
+			record.GenesisId = data.Data.GenesisId[:data.Data.GenesisIdLen]
+			record.CodeType = data.Data.CodeType
+		}
+	}
+	mp.DoubleSpends = append(mp.DoubleSpends, record)
+}
+
+// saveDoubleSpend 保存当前批次发现的重复花费，并发出告警。保存失败的记录保留到下一批次重试，
+// db写入时跳过已保存的记录，redis重试可能重复通知
+func (mp *Mempool) saveDoubleSpend() {
+	if len(mp.DoubleSpends) == 0 {
+		return
+	}
+	for _, r := range mp.DoubleSpends {
+		logger.Log.Warn("found double spend",
+			zap.String("txid", utils.HashString(r.TxId)),
+			zap.String("conflictTxid", utils.HashString(r.ConflictTxId)),
+			zap.Uint32("conflictHeight", r.ConflictHeight),
+			zap.String("utxid", utils.HashString(r.UTxid)),
+			zap.Uint32("vout", r.Vout),
+		)
+	}
+	if ok := store.SaveDoubleSpendCk(mp.DoubleSpends); !ok {
+		logger.Log.Error("save double spend into ck failed, retry next batch", zap.Int("n", len(mp.DoubleSpends)))
+		return
+	}
+	if ok := serial.SaveDoubleSpendIntoRedis(mp.DoubleSpends); !ok {
+		logger.Log.Error("save double spend into redis failed, retry next batch", zap.Int("n", len(mp.DoubleSpends)))
+		return
+	}
+	mp.DoubleSpends = nil
+}
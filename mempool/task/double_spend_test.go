@@ -0,0 +1,54 @@
+package task
+
+import (
+	"encoding/hex"
+	"sensibled/model"
+	"testing"
+)
+
+func newTestBatchTx(name string, inputs ...string) *model.Tx {
+	tx := &model.Tx{
+		TxId:    []byte(testTxid(name)),
+		TxIdHex: hex.EncodeToString([]byte(testTxid(name))),
+	}
+	for _, outpointKey := range inputs {
+		tx.TxIns = append(tx.TxIns, &model.TxIn{InputOutpointKey: outpointKey})
+	}
+	return tx
+}
+
+func TestCheckMempoolDoubleSpend(t *testing.T) {
+	model.CleanMempoolUtxoMap()
+	mp := &Mempool{}
+	mp.ResetIndex()
+	mp.SkipTxs = make(map[string]struct{}, 0)
+
+	// 已索引的内存池tx花费了chain:0
+	mp.SpentByTxs[testOutpoint(testTxid("chain"), 0)] = testTxid("indexed")
+
+	first := newTestBatchTx("first", testOutpoint(testTxid("chain"), 1))
+	second := newTestBatchTx("second", testOutpoint(testTxid("chain"), 1))            // 与批次内先出现的tx冲突
+	secondChild := newTestBatchTx("secondchild", testOutpoint(testTxid("second"), 0)) // 冲突tx的后代
+	conflictIndexed := newTestBatchTx("conflictindexed", testOutpoint(testTxid("chain"), 0))
+	firstChild := newTestBatchTx("firstchild", testOutpoint(testTxid("first"), 0))
+	mp.BatchTxs = []*model.Tx{first, second, secondChild, conflictIndexed, firstChild}
+
+	mp.checkMempoolDoubleSpend()
+
+	if len(mp.BatchTxs) != 2 || mp.BatchTxs[0] != first || mp.BatchTxs[1] != firstChild {
+		t.Fatalf("batch after check has %d txs, want first and firstchild", len(mp.BatchTxs))
+	}
+	for _, tx := range []*model.Tx{second, secondChild, conflictIndexed} {
+		if _, ok := mp.SkipTxs[tx.TxIdHex]; !ok {
+			t.Fatalf("conflicting tx %s not skipped", tx.TxIdHex)
+		}
+	}
+	// 后代不是重复花费，只记录直接冲突
+	if len(mp.DoubleSpends) != 2 {
+		t.Fatalf("double spend records %d, want 2", len(mp.DoubleSpends))
+	}
+	if string(mp.DoubleSpends[0].ConflictTxId) != testTxid("first") ||
+		string(mp.DoubleSpends[1].ConflictTxId) != testTxid("indexed") {
+		t.Fatal("unexpected conflict txid")
+	}
+}
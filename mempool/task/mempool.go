@@ -11,6 +11,7 @@ import (
 	"sensibled/mempool/task/parallel"
 	"sensibled/mempool/task/serial"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
 	"sensibled/utils"
 	"sync"
@@ -30,20 +31,65 @@ type Mempool struct {
 	NewUtxoDataMap    map[string]*model.TxoData // 当前同步批次中新产生的utxo集合
 	RemoveUtxoDataMap map[string]*model.TxoData // 当前同步批次中花费的未确认的utxo集合，且属于前批次产生的utxo
 
+	IndexedTxs            map[string]*IndexedTx     // 已索引的所有内存池Tx，key为txid
+	ConfirmedSpentUtxoMap map[string]*model.TxoData // 内存池Tx花费的已确认utxo
+	MempoolSpentUtxoMap   map[string]*model.TxoData // 内存池Tx花费的未确认utxo
+	SpentByTxs            map[string]string         // 内存池Tx花费的utxo对应的花费txid
+
+	DoubleSpends []*model.DoubleSpend // 发现的重复花费，保存成功后清空
+
+	NFTAuctionMap  map[string]*model.NFTAuctionEvent // 当前批次nft拍卖的最新状态
+	SwapReserveMap map[string]*model.SwapCandle      // 当前批次swap池的最新储备
+
+	OrphanTxs         map[string]*orphanTx           // 父tx尚未出现的Tx，key为txid
+	OrphanTxsByParent map[string]map[string]struct{} // 缺失的父txid对应的orphan Tx
+
+	StartIdx       int  // 下一批次Tx的起始序号
+	SyncedHeight   int  // 内存池数据对应的区块高度，-1表示尚未同步
+	NeedFullReload bool // 下次是否需要全量重新同步内存池
+	IsFullReload   bool // 当前批次是否为全量同步，需要清除之前的内存池数据
+
 	m sync.Mutex
 }
 
+// IndexedTx 已索引的内存池Tx，用于新区块确认后增量调整内存池数据
+type IndexedTx struct {
+	TxIdHex   string
+	TxIdx     uint64   // 在内存池中的序号
+	NOut      uint32   // 输出数量
+	Inputs    []string // 所有输入的outpointKey
+	Addresses []string // 涉及的地址
+	Auctions  []string // 涉及的nft拍卖
+	SwapPools []string // 涉及的swap池
+}
+
 func NewMempool() (mp *Mempool, err error) {
 	mp = new(Mempool)
+	mp.SyncedHeight = -1
+	mp.NeedFullReload = true
+	mp.ResetIndex()
 	return
 }
 
+// ResetIndex 清空内存池Tx索引
+func (mp *Mempool) ResetIndex() {
+	mp.IndexedTxs = make(map[string]*IndexedTx, 0)
+	mp.ConfirmedSpentUtxoMap = make(map[string]*model.TxoData, 0)
+	mp.MempoolSpentUtxoMap = make(map[string]*model.TxoData, 0)
+	mp.SpentByTxs = make(map[string]string, 0)
+	mp.OrphanTxs = make(map[string]*orphanTx, 0)
+	mp.OrphanTxsByParent = make(map[string]map[string]struct{}, 0)
+	mp.StartIdx = 0
+}
+
 func (mp *Mempool) Init() {
 	mp.BatchTxs = make([]*model.Tx, 0)
 	mp.SpentUtxoKeysMap = make(map[string]struct{}, 1)
 	mp.SpentUtxoDataMap = make(map[string]*model.TxoData, 1)
 	mp.NewUtxoDataMap = make(map[string]*model.TxoData, 1)
 	mp.RemoveUtxoDataMap = make(map[string]*model.TxoData, 1)
+	mp.NFTAuctionMap = make(map[string]*model.NFTAuctionEvent, 0)
+	mp.SwapReserveMap = make(map[string]*model.SwapCandle, 0)
 }
 
 func (mp *Mempool) LoadFromMempool() bool {
@@ -58,6 +104,11 @@ func (mp *Mempool) LoadFromMempool() bool {
 			// skip
 		}
 	}
+	// 全量同步无需再对比
+	select {
+	case <-loader.MempoolResyncNotify:
+	default:
+	}
 
 	rawtxs := loader.GetRawMemPoolRPC()
 	if rawtxs == nil {
@@ -74,15 +125,11 @@ func (mp *Mempool) LoadFromMempool() bool {
 		}
 
 		// parser tx
-		tx, txoffset := parser.NewTx(rawtx)
-		if int(txoffset) < len(rawtx) {
+		tx := newTxFromRaw(rawtx)
+		if tx == nil {
 			logger.Log.Info("skip bad rawtx")
 			continue
 		}
-		tx.Raw = rawtx
-		tx.Size = uint32(txoffset)
-		tx.TxId = utils.GetHash256(tx.Raw)
-		tx.TxIdHex = utils.HashString(tx.TxId)
 
 		// maybe impossible dup here
 		if _, ok := mp.Txs[tx.TxIdHex]; ok {
@@ -104,6 +151,19 @@ func (mp *Mempool) LoadFromMempool() bool {
 	return true
 }
 
+// newTxFromRaw 解析rawtx，失败返回nil
+func newTxFromRaw(rawtx []byte) *model.Tx {
+	tx, txoffset := parser.NewTx(rawtx)
+	if int(txoffset) < len(rawtx) {
+		return nil
+	}
+	tx.Raw = rawtx
+	tx.Size = uint32(txoffset)
+	tx.TxId = utils.GetHash256(tx.Raw)
+	tx.TxIdHex = utils.HashString(tx.TxId)
+	return tx
+}
+
 // SyncMempoolFromZmq 从zmq同步tx
 func (mp *Mempool) SyncMempoolFromZmq() (blockReady bool) {
 	COINBASE_TX_PREFIX, _ := hex.DecodeString("01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff")
@@ -130,6 +190,20 @@ func (mp *Mempool) SyncMempoolFromZmq() (blockReady bool) {
 			}
 
 			blockReady = true
+
+		case <-loader.MempoolResyncNotify:
+			// zmq消息丢失，对比节点内存池删除已丢弃的tx、补充缺失的tx
+			if ok := mp.ResyncFromRpc(); !ok {
+				// 内存池数据已不一致，结束追加同步，下次全量同步
+				logger.Log.Info("resync mempool failed")
+				mp.NeedFullReload = true
+				return true
+			}
+			if len(mp.BatchTxs) > 0 {
+				return false
+			}
+			continue
+
 		case <-time.After(time.Second):
 			timeout = true
 		}
@@ -146,15 +220,11 @@ func (mp *Mempool) SyncMempoolFromZmq() (blockReady bool) {
 		}
 
 		// parser tx
-		tx, txoffset := parser.NewTx(rawtx)
-		if int(txoffset) < len(rawtx) {
+		tx := newTxFromRaw(rawtx)
+		if tx == nil {
 			logger.Log.Info("skip bad rawtx")
 			continue
 		}
-		tx.Raw = rawtx
-		tx.Size = uint32(txoffset)
-		tx.TxId = utils.GetHash256(tx.Raw)
-		tx.TxIdHex = utils.HashString(tx.TxId)
 
 		// ignore non final tx
 		if parser.IsTxNonFinal(tx, mp.SkipTxs) {
@@ -202,8 +272,82 @@ func (mp *Mempool) SyncMempoolFromZmq() (blockReady bool) {
 	}
 }
 
+// ResyncFromRpc 对比节点内存池，删除节点已丢弃的tx，补充zmq未通知到的tx，父tx在前
+// 删除失败返回false，需要全量重新同步内存池
+func (mp *Mempool) ResyncFromRpc() bool {
+	entries := loader.GetRawMemPoolEntriesRPC()
+	if entries == nil {
+		return true
+	}
+
+	// 节点已丢弃的tx(过期、被替换或被驱逐)及其后代
+	droppedTxs := mp.classifyDroppedTxs(entries)
+	if len(droppedTxs) > 0 {
+		logger.Log.Info("resync mempool drop txs", zap.Int("nDropped", len(droppedTxs)))
+		if ok := mp.removeIndexedTxs(droppedTxs, nil); !ok {
+			return false
+		}
+	}
+
+	missingTxs := make(map[string][]string, 0)
+	for txid, depends := range entries {
+		if _, ok := mp.Txs[txid]; ok {
+			continue
+		}
+		if _, ok := mp.SkipTxs[txid]; ok {
+			continue
+		}
+		missingTxs[txid] = depends
+	}
+	logger.Log.Info("resync mempool from rpc",
+		zap.Int("nNode", len(entries)),
+		zap.Int("nMissing", len(missingTxs)))
+
+	// 按依赖关系排序，保证父tx先同步
+	visited := make(map[string]struct{}, len(missingTxs))
+	var visit func(txid string)
+	visit = func(txid string) {
+		if _, ok := visited[txid]; ok {
+			return
+		}
+		visited[txid] = struct{}{}
+		for _, depTxid := range missingTxs[txid] {
+			if _, ok := missingTxs[depTxid]; ok {
+				visit(depTxid)
+			}
+		}
+
+		rawtx := loader.GetRawTxRPC(txid)
+		if rawtx == nil {
+			return
+		}
+		tx := newTxFromRaw(rawtx)
+		if tx == nil {
+			logger.Log.Info("skip bad rawtx")
+			return
+		}
+		if parser.IsTxNonFinal(tx, mp.SkipTxs) {
+			logger.Log.Info("skip non final tx",
+				zap.String("txid", tx.TxIdHex),
+			)
+			mp.SkipTxs[tx.TxIdHex] = struct{}{}
+			return
+		}
+		if _, ok := mp.Txs[tx.TxIdHex]; ok {
+			return
+		}
+		mp.Txs[tx.TxIdHex] = struct{}{}
+		mp.BatchTxs = append(mp.BatchTxs, tx)
+	}
+	for txid := range missingTxs {
+		visit(txid)
+	}
+	return true
+}
+
 // ParseMempool 开始串行同步mempool
-func (mp *Mempool) ParseMempool(startIdx int) {
+func (mp *Mempool) ParseMempool() {
+	startIdx := mp.StartIdx
 
 	mp.AddrPkhInTxMap = make(map[string][]int, len(mp.BatchTxs))
 	// first
@@ -223,12 +367,21 @@ func (mp *Mempool) ParseMempool(startIdx int) {
 	}
 
 	// 2 dep 0
-	serial.SyncBlockTxOutputInfo(startIdx, mp.BatchTxs)
+	// 只索引token时，需要先依赖txin的utxo信息确定相关tx
+	if !prune.IsTokenOnly {
+		serial.SyncBlockTxOutputInfo(startIdx, mp.BatchTxs)
+	}
 
 	// 3 dep 1
 	// SpentUtxoDataMap w
 	serial.ParseGetSpentUtxoDataFromRedisSerial(mp.SpentUtxoKeysMap, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap)
 
+	if prune.IsTokenOnly {
+		// SpentUtxoDataMap r
+		serial.MarkIndexedTxSerial(startIdx, mp.BatchTxs, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap, mp.AddrPkhInTxMap)
+		serial.SyncBlockTxOutputInfo(startIdx, mp.BatchTxs)
+	}
+
 	// 4 dep 3
 	// SpentUtxoDataMap r
 	serial.SyncBlockTxInputDetail(startIdx, mp.BatchTxs, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap, mp.AddrPkhInTxMap)
@@ -237,8 +390,65 @@ func (mp *Mempool) ParseMempool(startIdx int) {
 	// SpentUtxoDataMap r
 	serial.SyncBlockTxContract(startIdx, mp.BatchTxs, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap)
 
+	// 9 dep 3
+	// SpentUtxoDataMap r
+	mp.NFTAuctionMap = serial.SyncBlockNFTAuction(startIdx, mp.BatchTxs, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap)
+
+	// 10 dep 3
+	// SpentUtxoDataMap r
+	mp.SwapReserveMap = serial.SyncBlockSwapCandle(startIdx, mp.BatchTxs, mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap)
+
 	// 5 dep 2 4
 	serial.SyncBlockTx(startIdx, mp.BatchTxs)
+
+	mp.indexBatchTxs()
+}
+
+// indexBatchTxs 记录当前批次Tx的输入输出和地址，以便新区块确认后增量调整
+func (mp *Mempool) indexBatchTxs() {
+	batchIndexedTxs := make([]*IndexedTx, len(mp.BatchTxs))
+	for txIdx, tx := range mp.BatchTxs {
+		itx := &IndexedTx{
+			TxIdHex: tx.TxIdHex,
+			TxIdx:   uint64(mp.StartIdx + txIdx),
+			NOut:    tx.TxOutCnt,
+			Inputs:  make([]string, len(tx.TxIns)),
+		}
+		for vin, input := range tx.TxIns {
+			itx.Inputs[vin] = input.InputOutpointKey
+			mp.SpentByTxs[input.InputOutpointKey] = string(tx.TxId)
+			if data, ok := mp.NewUtxoDataMap[input.InputOutpointKey]; ok {
+				mp.MempoolSpentUtxoMap[input.InputOutpointKey] = data
+			} else if data, ok := mp.RemoveUtxoDataMap[input.InputOutpointKey]; ok {
+				mp.MempoolSpentUtxoMap[input.InputOutpointKey] = data
+			} else if data, ok := mp.SpentUtxoDataMap[input.InputOutpointKey]; ok {
+				mp.ConfirmedSpentUtxoMap[input.InputOutpointKey] = data
+			}
+		}
+		batchIndexedTxs[txIdx] = itx
+		mp.IndexedTxs[string(tx.TxId)] = itx
+	}
+
+	for auctionId, event := range mp.NFTAuctionMap {
+		if itx, ok := mp.IndexedTxs[string(event.TxId)]; ok {
+			itx.Auctions = append(itx.Auctions, auctionId)
+		}
+	}
+	for key, candle := range mp.SwapReserveMap {
+		if itx, ok := mp.IndexedTxs[string(candle.TxId)]; ok {
+			itx.SwapPools = append(itx.SwapPools, key)
+		}
+	}
+
+	for strAddressPkh, listTxid := range mp.AddrPkhInTxMap {
+		for _, txIdx := range listTxid {
+			itx := batchIndexedTxs[txIdx-mp.StartIdx]
+			if n := len(itx.Addresses); n > 0 && itx.Addresses[n-1] == strAddressPkh {
+				continue
+			}
+			itx.Addresses = append(itx.Addresses, strAddressPkh)
+		}
+	}
 }
 
 // ParseEnd 最后分析执行
@@ -250,23 +460,44 @@ func ParseEnd() bool {
 	return store.ProcessPartSyncCk()
 }
 
-func (mp *Mempool) Process(initSyncMempool bool, stageBlockHeight, startIdx int) bool {
+func (mp *Mempool) Process(initSyncMempool bool, stageBlockHeight int) bool {
 	mp.Init()
+	mp.IsFullReload = false
 	if initSyncMempool {
-		logger.Log.Info("init sync mempool...")
-		model.CleanMempoolUtxoMap()
-		if ok := mp.LoadFromMempool(); !ok { // 重新全量同步
-			logger.Log.Info("LoadFromMempool failed")
-			return false
+		if !mp.NeedFullReload && mp.SyncedHeight >= 0 {
+			logger.Log.Info("reconcile mempool...", zap.Int("nTx", len(mp.IndexedTxs)))
+			if ok := mp.Reconcile(); !ok { // 增量调整失败，则重新全量同步
+				logger.Log.Info("reconcile mempool failed")
+				mp.NeedFullReload = true
+				mp.Init()
+			}
+		} else {
+			mp.NeedFullReload = true
+		}
+
+		if mp.NeedFullReload {
+			logger.Log.Info("init sync mempool...")
+			mp.IsFullReload = true
+			model.CleanMempoolUtxoMap()
+			mp.ResetIndex()
+			if ok := mp.LoadFromMempool(); !ok { // 重新全量同步
+				logger.Log.Info("LoadFromMempool failed")
+				return false
+			}
 		}
 
 		latestBlockHeight := loader.GetBlockCountRPC()
 		if stageBlockHeight < latestBlockHeight-1 {
-			// 有新区块，不同步内存池
+			// 有新区块，不同步内存池。本次调整未完成，下次需要全量同步
+			mp.NeedFullReload = true
 			return false
 		}
 
-		store.ProcessAllSyncCk() // 从db删除mempool数据
+		if mp.IsFullReload {
+			store.ProcessAllSyncCk() // 从db删除mempool数据
+		}
+		mp.SyncedHeight = stageBlockHeight
+		mp.NeedFullReload = false
 	} else {
 		// 现有追加同步
 		isNewBlockReady := mp.SyncMempoolFromZmq()
@@ -277,14 +508,21 @@ func (mp *Mempool) Process(initSyncMempool bool, stageBlockHeight, startIdx int)
 			return false
 		}
 	}
+	// 按依赖排序，暂存父tx缺失的tx
+	if ok := mp.PrepareBatchTxs(initSyncMempool); !ok {
+		// 本批次tx已取出，需要全量重新同步
+		mp.NeedFullReload = true
+		return false
+	}
+
 	store.CreatePartSyncCk()  // 初始化同步数据库表
 	store.PreparePartSyncCk() // 准备同步db，todo: 可能初始化失败
-	mp.ParseMempool(startIdx) // 开始同步mempool
+	mp.ParseMempool()         // 开始同步mempool
 	return true
 }
 
 // SubmitMempoolWithoutBlocks
-func (mp *Mempool) SubmitMempoolWithoutBlocks(initSyncMempool bool) {
+func (mp *Mempool) SubmitMempoolWithoutBlocks() {
 	var wg sync.WaitGroup
 
 	// address history
@@ -292,7 +530,7 @@ func (mp *Mempool) SubmitMempoolWithoutBlocks(initSyncMempool bool) {
 	go func() {
 		defer wg.Done()
 		// Pika更新addr tx历史
-		if ok := serial.SaveAddressTxHistoryIntoPika(initSyncMempool, mp.AddrPkhInTxMap); !ok {
+		if ok := serial.SaveAddressTxHistoryIntoPika(mp.IsFullReload, mp.AddrPkhInTxMap); !ok {
 			model.NeedStop = true
 			return
 		}
@@ -337,8 +575,10 @@ func (mp *Mempool) SubmitMempoolWithoutBlocks(initSyncMempool bool) {
 		rdsPipe := rdb.RdbBalanceClient.TxPipeline()
 		// for txin dump
 		// 6 dep 2 4
-		serial.UpdateUtxoInRedis(rdsPipe, initSyncMempool,
+		serial.UpdateUtxoInRedis(rdsPipe, mp.IsFullReload,
 			mp.NewUtxoDataMap, mp.RemoveUtxoDataMap, mp.SpentUtxoDataMap)
+		serial.UpdateNFTAuctionInRedis(rdsPipe, mp.NFTAuctionMap)
+		serial.UpdateSwapReserveInRedis(rdsPipe, mp.SwapReserveMap)
 
 		ctx := context.Background()
 		if _, err := rdsPipe.Exec(ctx); err != nil {
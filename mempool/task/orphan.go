@@ -0,0 +1,273 @@
+package task
+
+import (
+	"sensibled/loader"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/rdb"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxOrphanTxs    = 10000            // orphan池最多保留的tx数量
+	orphanTxTimeout = 20 * time.Minute // orphan tx超时后丢弃
+)
+
+// orphanTx 父tx尚未出现的内存池tx
+type orphanTx struct {
+	tx      *model.Tx
+	parents []string // 缺失的父txid
+	addTime time.Time
+}
+
+// PrepareBatchTxs 整理当前批次Tx：释放父tx已出现的orphan，按依赖关系排序，并暂存父tx缺失的orphan
+// 如果retryAll=true，则所有orphan重新检查，用于新区块确认后。无法确定输入来源时返回false，当前批次需要重新同步
+func (mp *Mempool) PrepareBatchTxs(retryAll bool) bool {
+	mp.expireOrphanTxs()
+	mp.releaseOrphanTxs(retryAll)
+	mp.BatchTxs = sortTxsByDependency(mp.BatchTxs)
+	if ok := mp.holdOrphanTxs(); !ok {
+		return false
+	}
+	mp.checkMempoolDoubleSpend()
+	mp.saveDoubleSpend()
+	return true
+}
+
+// expireOrphanTxs 丢弃超时的orphan
+func (mp *Mempool) expireOrphanTxs() {
+	for txid, orphan := range mp.OrphanTxs {
+		if time.Since(orphan.addTime) < orphanTxTimeout {
+			continue
+		}
+		logger.Log.Info("drop expired orphan tx", zap.String("txid", orphan.tx.TxIdHex))
+		mp.removeOrphanTx(txid)
+		delete(mp.Txs, orphan.tx.TxIdHex)
+	}
+}
+
+// releaseOrphanTxs 父tx出现在当前批次中的orphan，重新加入当前批次
+func (mp *Mempool) releaseOrphanTxs(retryAll bool) {
+	if len(mp.OrphanTxs) == 0 {
+		return
+	}
+
+	released := make([]*orphanTx, 0)
+	if retryAll {
+		for txid, orphan := range mp.OrphanTxs {
+			released = append(released, orphan)
+			mp.removeOrphanTx(txid)
+		}
+	} else {
+		parents := make([]string, 0, len(mp.BatchTxs))
+		for _, tx := range mp.BatchTxs {
+			parents = append(parents, string(tx.TxId))
+		}
+		for len(parents) > 0 {
+			parentTxid := parents[len(parents)-1]
+			parents = parents[:len(parents)-1]
+			for txid := range mp.OrphanTxsByParent[parentTxid] {
+				orphan, ok := mp.OrphanTxs[txid]
+				if !ok {
+					continue
+				}
+				released = append(released, orphan)
+				mp.removeOrphanTx(txid)
+				parents = append(parents, txid)
+			}
+		}
+	}
+
+	if len(released) == 0 {
+		return
+	}
+	logger.Log.Info("release orphan tx", zap.Int("n", len(released)), zap.Int("nLeft", len(mp.OrphanTxs)))
+	for _, orphan := range released {
+		mp.BatchTxs = append(mp.BatchTxs, orphan.tx)
+	}
+}
+
+// holdOrphanTxs 从当前批次中移除父tx缺失的tx，暂存到orphan池；移除与已确认tx冲突的tx。BatchTxs需已按依赖排序
+// 查询utxo是否存在失败时返回false，否则父tx缺失的tx会以空的输入信息同步
+func (mp *Mempool) holdOrphanTxs() bool {
+	batchTxIds := make(map[string]struct{}, len(mp.BatchTxs))
+	for _, tx := range mp.BatchTxs {
+		batchTxIds[string(tx.TxId)] = struct{}{}
+	}
+
+	// 查询来源不明的utxo是否存在
+	uncheckedUtxoKeys := make([]string, 0)
+	for _, tx := range mp.BatchTxs {
+		for _, input := range tx.TxIns {
+			if _, ok := model.GlobalConfirmedSpentUtxoMap[input.InputOutpointKey]; ok {
+				continue
+			}
+			if mp.isInputSourceKnown(input.InputOutpointKey, batchTxIds) {
+				continue
+			}
+			if _, ok := mp.OrphanTxs[input.InputOutpointKey[:32]]; ok {
+				continue
+			}
+			uncheckedUtxoKeys = append(uncheckedUtxoKeys, input.InputOutpointKey)
+		}
+	}
+	existUtxoKeys, err := rdb.UtxoDB.Exists(uncheckedUtxoKeys)
+	if err != nil {
+		logger.Log.Error("pika check orphan utxo failed", zap.Error(err))
+		return false
+	}
+
+	// 不存在的utxo，可能已被确认tx花费
+	missingUtxos := make(map[string]struct{}, 0)
+	missingUtxoKeys := make([]string, 0)
+	for _, outpointKey := range uncheckedUtxoKeys {
+		if _, ok := existUtxoKeys[outpointKey]; ok {
+			continue
+		}
+		if _, ok := missingUtxos[outpointKey]; ok {
+			continue
+		}
+		missingUtxos[outpointKey] = struct{}{}
+		missingUtxoKeys = append(missingUtxoKeys, outpointKey)
+	}
+	confirmedSpentTxos, err := loader.GetConfirmedSpentTxoFromDB(missingUtxoKeys)
+	if err != nil {
+		logger.Log.Error("query confirmed spent utxo failed", zap.Error(err))
+		confirmedSpentTxos = make(map[string]*model.TxoSpentDO, 0)
+	}
+
+	orphanTxIds := make(map[string]struct{}, 0)
+	conflictTxIds := make(map[string]struct{}, 0)
+	batchTxs := make([]*model.Tx, 0, len(mp.BatchTxs))
+	for _, tx := range mp.BatchTxs {
+		parents := make([]string, 0)
+		conflicted := false
+		for _, input := range tx.TxIns {
+			parentTxid := input.InputOutpointKey[:32]
+			if _, ok := conflictTxIds[parentTxid]; ok {
+				conflicted = true
+				continue
+			}
+			if mp.checkConfirmedDoubleSpend(tx, input.InputOutpointKey, confirmedSpentTxos) {
+				conflicted = true
+				continue
+			}
+			if _, ok := orphanTxIds[parentTxid]; ok {
+				parents = append(parents, parentTxid)
+				continue
+			}
+			if _, ok := mp.OrphanTxs[parentTxid]; ok {
+				parents = append(parents, parentTxid)
+				continue
+			}
+			if _, ok := missingUtxos[input.InputOutpointKey]; ok {
+				parents = append(parents, parentTxid)
+			}
+		}
+		if conflicted {
+			// 与已确认tx冲突，不再同步
+			conflictTxIds[string(tx.TxId)] = struct{}{}
+			mp.SkipTxs[tx.TxIdHex] = struct{}{}
+			continue
+		}
+		if len(parents) == 0 {
+			batchTxs = append(batchTxs, tx)
+			continue
+		}
+
+		orphanTxIds[string(tx.TxId)] = struct{}{}
+		if len(mp.OrphanTxs) >= maxOrphanTxs {
+			logger.Log.Info("orphan pool full, drop tx", zap.String("txid", tx.TxIdHex))
+			delete(mp.Txs, tx.TxIdHex)
+			continue
+		}
+		logger.Log.Info("hold orphan tx", zap.String("txid", tx.TxIdHex), zap.Int("nMissing", len(parents)))
+		mp.addOrphanTx(&orphanTx{tx: tx, parents: parents, addTime: time.Now()})
+	}
+	mp.BatchTxs = batchTxs
+	return true
+}
+
+// isInputSourceKnown 输入的来源tx已在内存池或本地缓存中
+func (mp *Mempool) isInputSourceKnown(outpointKey string, batchTxIds map[string]struct{}) bool {
+	parentTxid := outpointKey[:32]
+	if _, ok := batchTxIds[parentTxid]; ok {
+		return true
+	}
+	if _, ok := mp.IndexedTxs[parentTxid]; ok {
+		return true
+	}
+	if _, ok := model.GlobalMempoolNewUtxoDataMap[outpointKey]; ok {
+		return true
+	}
+	if _, ok := model.GlobalNewUtxoDataMap.Get(outpointKey); ok {
+		return true
+	}
+	// 已被其他内存池tx花费，属于冲突而非orphan
+	if _, ok := mp.MempoolSpentUtxoMap[outpointKey]; ok {
+		return true
+	}
+	if _, ok := mp.ConfirmedSpentUtxoMap[outpointKey]; ok {
+		return true
+	}
+	return false
+}
+
+func (mp *Mempool) addOrphanTx(orphan *orphanTx) {
+	txid := string(orphan.tx.TxId)
+	mp.OrphanTxs[txid] = orphan
+	for _, parentTxid := range orphan.parents {
+		children, ok := mp.OrphanTxsByParent[parentTxid]
+		if !ok {
+			children = make(map[string]struct{}, 1)
+			mp.OrphanTxsByParent[parentTxid] = children
+		}
+		children[txid] = struct{}{}
+	}
+}
+
+func (mp *Mempool) removeOrphanTx(txid string) {
+	orphan, ok := mp.OrphanTxs[txid]
+	if !ok {
+		return
+	}
+	delete(mp.OrphanTxs, txid)
+	for _, parentTxid := range orphan.parents {
+		children := mp.OrphanTxsByParent[parentTxid]
+		delete(children, txid)
+		if len(children) == 0 {
+			delete(mp.OrphanTxsByParent, parentTxid)
+		}
+	}
+}
+
+// sortTxsByDependency 按依赖关系排序，父tx在前，其余保持原顺序
+func sortTxsByDependency(txs []*model.Tx) []*model.Tx {
+	txsById := make(map[string]*model.Tx, len(txs))
+	for _, tx := range txs {
+		txsById[string(tx.TxId)] = tx
+	}
+
+	sorted := make([]*model.Tx, 0, len(txs))
+	visited := make(map[string]struct{}, len(txs))
+	var visit func(tx *model.Tx)
+	visit = func(tx *model.Tx) {
+		txid := string(tx.TxId)
+		if _, ok := visited[txid]; ok {
+			return
+		}
+		visited[txid] = struct{}{}
+		for _, input := range tx.TxIns {
+			if parent, ok := txsById[input.InputOutpointKey[:32]]; ok {
+				visit(parent)
+			}
+		}
+		sorted = append(sorted, tx)
+	}
+	for _, tx := range txs {
+		visit(tx)
+	}
+	return sorted
+}
@@ -0,0 +1,202 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sensibled/model"
+	"sensibled/rdb"
+	"testing"
+	"time"
+)
+
+// stubUtxoStore 按预置结果返回的utxo存储
+type stubUtxoStore struct {
+	exists map[string]struct{}
+	err    error
+}
+
+func (s *stubUtxoStore) Get(outpointKeys []string) (map[string][]byte, error) {
+	return nil, s.err
+}
+
+func (s *stubUtxoStore) Exists(outpointKeys []string) (map[string]struct{}, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	exists := make(map[string]struct{}, 0)
+	for _, outpointKey := range outpointKeys {
+		if _, ok := s.exists[outpointKey]; ok {
+			exists[outpointKey] = struct{}{}
+		}
+	}
+	return exists, nil
+}
+
+func (s *stubUtxoStore) Update(utxoToRemove []string, utxoToStore map[string][]byte) error {
+	return s.err
+}
+
+func (s *stubUtxoStore) Flush() error {
+	return s.err
+}
+
+func useStubUtxoStore(t *testing.T, store *stubUtxoStore) {
+	t.Helper()
+	utxoDB := rdb.UtxoDB
+	rdb.UtxoDB = store
+	t.Cleanup(func() { rdb.UtxoDB = utxoDB })
+}
+
+func newTestOrphanMempool() *Mempool {
+	model.CleanUtxoMap()
+	model.CleanMempoolUtxoMap()
+	model.CleanConfirmedTxMap(true)
+	mp := &Mempool{}
+	mp.ResetIndex()
+	mp.Txs = make(map[string]struct{}, 0)
+	mp.SkipTxs = make(map[string]struct{}, 0)
+	return mp
+}
+
+func testBatchTxNames(txs []*model.Tx) (names []string) {
+	for _, tx := range txs {
+		names = append(names, string(tx.TxId))
+	}
+	return names
+}
+
+func TestSortTxsByDependency(t *testing.T) {
+	grandchild := newTestBatchTx("grandchild", testOutpoint(testTxid("child"), 0))
+	child := newTestBatchTx("child", testOutpoint(testTxid("parent"), 0))
+	other := newTestBatchTx("other", testOutpoint(testTxid("chain"), 0))
+	parent := newTestBatchTx("parent", testOutpoint(testTxid("chain"), 1))
+	// 同时花费父tx和祖父tx的输出
+	both := newTestBatchTx("both", testOutpoint(testTxid("child"), 1), testOutpoint(testTxid("parent"), 1))
+
+	sorted := sortTxsByDependency([]*model.Tx{grandchild, child, other, both, parent})
+	want := []*model.Tx{parent, child, grandchild, other, both}
+	if len(sorted) != len(want) {
+		t.Fatalf("sorted %d txs, want %d", len(sorted), len(want))
+	}
+	for i, tx := range want {
+		if sorted[i] != tx {
+			t.Fatalf("sorted %q, want %q", testBatchTxNames(sorted), testBatchTxNames(want))
+		}
+	}
+}
+
+func TestReleaseOrphanTxsChain(t *testing.T) {
+	mp := newTestOrphanMempool()
+
+	child := newTestBatchTx("child", testOutpoint(testTxid("parent"), 0))
+	grandchild := newTestBatchTx("grandchild", testOutpoint(testTxid("child"), 0))
+	unrelated := newTestBatchTx("unrelated", testOutpoint(testTxid("missing"), 0))
+	mp.addOrphanTx(&orphanTx{tx: child, parents: []string{testTxid("parent")}, addTime: time.Now()})
+	mp.addOrphanTx(&orphanTx{tx: grandchild, parents: []string{testTxid("child")}, addTime: time.Now()})
+	mp.addOrphanTx(&orphanTx{tx: unrelated, parents: []string{testTxid("missing")}, addTime: time.Now()})
+
+	// 父tx出现后，子tx及其orphan后代一起释放
+	parent := newTestBatchTx("parent", testOutpoint(testTxid("chain"), 0))
+	mp.BatchTxs = []*model.Tx{parent}
+	mp.releaseOrphanTxs(false)
+
+	if len(mp.BatchTxs) != 3 {
+		t.Fatalf("batch %q, want parent, child and grandchild", testBatchTxNames(mp.BatchTxs))
+	}
+	sorted := sortTxsByDependency(mp.BatchTxs)
+	if sorted[0] != parent || sorted[1] != child || sorted[2] != grandchild {
+		t.Fatalf("sorted batch %q", testBatchTxNames(sorted))
+	}
+	if len(mp.OrphanTxs) != 1 || mp.OrphanTxs[testTxid("unrelated")] == nil {
+		t.Fatalf("orphan pool %d txs, want only unrelated", len(mp.OrphanTxs))
+	}
+	if len(mp.OrphanTxsByParent) != 1 {
+		t.Fatalf("orphan parent index %d, want 1", len(mp.OrphanTxsByParent))
+	}
+
+	// 新区块确认后全部重新检查
+	mp.BatchTxs = nil
+	mp.releaseOrphanTxs(true)
+	if len(mp.BatchTxs) != 1 || len(mp.OrphanTxs) != 0 || len(mp.OrphanTxsByParent) != 0 {
+		t.Fatalf("retry all: batch %d, orphan %d", len(mp.BatchTxs), len(mp.OrphanTxs))
+	}
+}
+
+func TestExpireOrphanTxs(t *testing.T) {
+	mp := newTestOrphanMempool()
+
+	expired := newTestBatchTx("expired", testOutpoint(testTxid("missing"), 0))
+	fresh := newTestBatchTx("fresh", testOutpoint(testTxid("missing"), 1))
+	mp.Txs[expired.TxIdHex] = struct{}{}
+	mp.Txs[fresh.TxIdHex] = struct{}{}
+	mp.addOrphanTx(&orphanTx{tx: expired, parents: []string{testTxid("missing")}, addTime: time.Now().Add(-orphanTxTimeout - time.Second)})
+	mp.addOrphanTx(&orphanTx{tx: fresh, parents: []string{testTxid("missing")}, addTime: time.Now()})
+
+	mp.expireOrphanTxs()
+
+	if _, ok := mp.OrphanTxs[testTxid("expired")]; ok {
+		t.Fatal("expired orphan not dropped")
+	}
+	if _, ok := mp.Txs[expired.TxIdHex]; ok {
+		t.Fatal("expired orphan still in txs, will not be synced again")
+	}
+	if _, ok := mp.OrphanTxs[testTxid("fresh")]; !ok {
+		t.Fatal("fresh orphan dropped")
+	}
+	if children := mp.OrphanTxsByParent[testTxid("missing")]; len(children) != 1 {
+		t.Fatalf("orphan parent index %d children, want 1", len(children))
+	}
+}
+
+func TestHoldOrphanTxsPoolFull(t *testing.T) {
+	mp := newTestOrphanMempool()
+	useStubUtxoStore(t, &stubUtxoStore{})
+
+	// orphan池已满，父tx仍是orphan的tx直接丢弃
+	parent := newTestBatchTx("parent", testOutpoint(testTxid("missing"), 0))
+	mp.addOrphanTx(&orphanTx{tx: parent, parents: []string{testTxid("missing")}, addTime: time.Now()})
+	for i := len(mp.OrphanTxs); i < maxOrphanTxs; i++ {
+		filler := newTestBatchTx(fmt.Sprintf("filler%d", i), testOutpoint(testTxid("missing"), uint32(i)))
+		mp.addOrphanTx(&orphanTx{tx: filler, parents: []string{testTxid("missing")}, addTime: time.Now()})
+	}
+	if len(mp.OrphanTxs) != maxOrphanTxs {
+		t.Fatalf("orphan pool %d, want %d", len(mp.OrphanTxs), maxOrphanTxs)
+	}
+
+	child := newTestBatchTx("child", testOutpoint(testTxid("parent"), 0))
+	ok := newTestBatchTx("ok", testOutpoint(testTxid("chain"), 0))
+	model.GlobalNewUtxoDataMap.Set(testOutpoint(testTxid("chain"), 0), &model.TxoData{})
+	mp.Txs[child.TxIdHex] = struct{}{}
+	mp.BatchTxs = []*model.Tx{child, ok}
+
+	if !mp.holdOrphanTxs() {
+		t.Fatal("hold orphan txs failed")
+	}
+	if len(mp.BatchTxs) != 1 || mp.BatchTxs[0] != ok {
+		t.Fatalf("batch %q, want ok", testBatchTxNames(mp.BatchTxs))
+	}
+	if _, ok := mp.OrphanTxs[testTxid("child")]; ok {
+		t.Fatal("orphan added to full pool")
+	}
+	if _, ok := mp.Txs[child.TxIdHex]; ok {
+		t.Fatal("dropped orphan still in txs")
+	}
+	if len(mp.OrphanTxs) != maxOrphanTxs {
+		t.Fatalf("orphan pool %d, want %d", len(mp.OrphanTxs), maxOrphanTxs)
+	}
+}
+
+func TestHoldOrphanTxsCheckFailed(t *testing.T) {
+	mp := newTestOrphanMempool()
+	useStubUtxoStore(t, &stubUtxoStore{err: errors.New("pika down")})
+
+	// 来源不明的输入无法检查，不能当作来源存在继续同步
+	child := newTestBatchTx("child", testOutpoint(testTxid("unknown"), 0))
+	mp.BatchTxs = []*model.Tx{child}
+	if mp.holdOrphanTxs() {
+		t.Fatal("hold orphan txs should fail when utxo check fails")
+	}
+	if mp.PrepareBatchTxs(false) {
+		t.Fatal("prepare batch should fail when utxo check fails")
+	}
+}
@@ -3,6 +3,7 @@ package parallel
 import (
 	"encoding/binary"
 	"sensibled/model"
+	"sensibled/prune"
 
 	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
 )
@@ -55,6 +56,10 @@ func ParseUpdateNewUtxoInTxParallel(txIdx uint64, tx *model.Tx, mpNewUtxo map[st
 
 // ParseUpdateAddressInTxParallel address tx历史记录
 func ParseUpdateAddressInTxParallel(txIdx uint64, tx *model.Tx, addrPkhInTxMap map[string][]int) {
+	// 只索引token时，在确定tx是否相关后再记录
+	if prune.IsTokenOnly {
+		return
+	}
 	for _, output := range tx.TxOuts {
 		if output.Data.HasAddress {
 			address := string(output.Data.AddressPkh[:])
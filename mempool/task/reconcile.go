@@ -0,0 +1,261 @@
+package task
+
+import (
+	"context"
+	"encoding/binary"
+	"sensibled/logger"
+	"sensibled/mempool/loader"
+	"sensibled/mempool/store"
+	"sensibled/mempool/task/serial"
+	"sensibled/model"
+	"sensibled/rdb"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Reconcile 新区块确认后增量调整内存池数据，无需全量重新同步
+// 1. 删除被区块确认的tx，以及与区块冲突的tx及其后代
+// 2. 被确认tx的其余后代，其输入来源已改变，删除后重新加入当前批次同步
+// 3. 其余tx保持不变
+func (mp *Mempool) Reconcile() bool {
+	confirmedTxs, invalidTxs, requeueTxs := mp.classifyReconcileTxs()
+
+	removeTxs := make(map[string]*IndexedTx, len(confirmedTxs)+len(invalidTxs))
+	for txid, itx := range confirmedTxs {
+		removeTxs[txid] = itx
+	}
+	for txid := range invalidTxs {
+		removeTxs[txid] = mp.IndexedTxs[txid]
+	}
+	if ok := mp.removeIndexedTxs(removeTxs, confirmedTxs); !ok {
+		return false
+	}
+
+	// 按原顺序重新同步被确认tx的后代
+	for _, itx := range requeueTxs {
+		rawtx := loader.GetRawTxRPC(itx.TxIdHex)
+		if rawtx == nil {
+			logger.Log.Info("requeue tx not in mempool", zap.String("txid", itx.TxIdHex))
+			continue
+		}
+		tx := newTxFromRaw(rawtx)
+		if tx == nil {
+			logger.Log.Info("skip bad rawtx")
+			continue
+		}
+		mp.Txs[tx.TxIdHex] = struct{}{}
+		mp.BatchTxs = append(mp.BatchTxs, tx)
+	}
+	return true
+}
+
+// removeIndexedTxs 从内存池索引、utxo缓存、redis、pika及db中删除已索引的tx
+// confirmedTxs中的tx已被区块确认，其产生的utxo由区块同步写入，不从pika删除
+func (mp *Mempool) removeIndexedTxs(removeTxs, confirmedTxs map[string]*IndexedTx) bool {
+	utxoToRestore := make(map[string]*model.TxoData, 0)      // 重新恢复为未花费的内存池utxo
+	utxoToRemove := make(map[string]*model.TxoData, 0)       // 删除的内存池utxo
+	utxoToRemoveInPika := make(map[string]*model.TxoData, 0) // 删除的内存池utxo，不包括被确认的utxo
+	utxoToUnspend := make(map[string]*model.TxoData, 0)      // 撤销花费的已确认utxo
+	addrPkhInTxMap := make(map[string][]int, 0)              // 删除的地址tx历史
+	auctionsToRemove := make(map[string]struct{}, 0)         // 删除的nft拍卖状态
+	swapPoolsToRemove := make(map[string]struct{}, 0)        // 删除的swap池储备
+	txidsToRemove := make([]string, 0, len(removeTxs))
+	for txid, itx := range removeTxs {
+		_, isConfirmed := confirmedTxs[txid]
+		txidsToRemove = append(txidsToRemove, txid)
+
+		for vout := uint32(0); vout < itx.NOut; vout++ {
+			outpointKey := make([]byte, 36)
+			copy(outpointKey, txid)
+			binary.LittleEndian.PutUint32(outpointKey[32:], vout)
+
+			data, ok := model.GlobalMempoolNewUtxoDataMap[string(outpointKey)]
+			if !ok {
+				continue
+			}
+			utxoToRemove[string(outpointKey)] = data
+			if !isConfirmed { // 被确认的utxo由区块同步写入
+				utxoToRemoveInPika[string(outpointKey)] = data
+			}
+			delete(model.GlobalMempoolNewUtxoDataMap, string(outpointKey))
+		}
+
+		for _, outpointKey := range itx.Inputs {
+			if spentTxid, ok := mp.SpentByTxs[outpointKey]; ok && spentTxid == txid {
+				delete(mp.SpentByTxs, outpointKey)
+			}
+			if data, ok := mp.ConfirmedSpentUtxoMap[outpointKey]; ok {
+				utxoToUnspend[outpointKey] = data
+				delete(mp.ConfirmedSpentUtxoMap, outpointKey)
+				continue
+			}
+			data, ok := mp.MempoolSpentUtxoMap[outpointKey]
+			if !ok {
+				continue
+			}
+			delete(mp.MempoolSpentUtxoMap, outpointKey)
+
+			// 来源tx仍保留在内存池，则恢复utxo
+			parentTxid := outpointKey[:32]
+			if _, ok := removeTxs[parentTxid]; ok {
+				continue
+			}
+			if _, ok := mp.IndexedTxs[parentTxid]; !ok {
+				continue
+			}
+			utxoToRestore[outpointKey] = data
+		}
+
+		for _, strAddressPkh := range itx.Addresses {
+			addrPkhInTxMap[strAddressPkh] = append(addrPkhInTxMap[strAddressPkh], int(itx.TxIdx))
+		}
+		for _, auctionId := range itx.Auctions {
+			auctionsToRemove[auctionId] = struct{}{}
+		}
+		for _, key := range itx.SwapPools {
+			swapPoolsToRemove[key] = struct{}{}
+		}
+	}
+
+	if ok := serial.UpdateUtxoInPika(utxoToRestore, utxoToRemoveInPika); !ok {
+		return false
+	}
+
+	ctx := context.Background()
+	rdsPipe := rdb.RdbBalanceClient.TxPipeline()
+	serial.UpdateUtxoInRedis(rdsPipe, false, utxoToRestore, utxoToRemove, nil)
+	serial.RemoveSpentUtxoInRedis(rdsPipe, utxoToUnspend)
+	serial.RemoveNFTAuctionInRedis(rdsPipe, auctionsToRemove)
+	serial.RemoveSwapReserveInRedis(rdsPipe, swapPoolsToRemove)
+	if _, err := rdsPipe.Exec(ctx); err != nil {
+		logger.Log.Error("reconcile redis exec failed", zap.Error(err))
+		return false
+	}
+
+	if ok := serial.RemoveAddressTxHistoryInPika(addrPkhInTxMap); !ok {
+		return false
+	}
+
+	if ok := store.RemoveTxsSyncCk(txidsToRemove); !ok {
+		return false
+	}
+
+	for outpointKey, data := range utxoToRestore {
+		model.GlobalMempoolNewUtxoDataMap[outpointKey] = data
+	}
+	for txid, itx := range removeTxs {
+		delete(mp.IndexedTxs, txid)
+		delete(mp.Txs, itx.TxIdHex)
+	}
+
+	return true
+}
+
+// classifyReconcileTxs 根据最近确认区块对内存池tx分类
+// 返回被确认的tx、需要删除的tx（冲突tx及其后代，以及需要重新同步的tx），以及需要按原顺序重新同步的tx
+func (mp *Mempool) classifyReconcileTxs() (confirmedTxs map[string]*IndexedTx, invalidTxs map[string]struct{}, requeueTxs []*IndexedTx) {
+	confirmedTxs = make(map[string]*IndexedTx, 0)
+	conflictedTxs := make(map[string]*IndexedTx, 0)
+	childrenTxs := mp.indexChildrenTxs()
+	for txid, itx := range mp.IndexedTxs {
+		if _, ok := model.GlobalConfirmedTxMap[itx.TxIdHex]; ok {
+			confirmedTxs[txid] = itx
+			continue
+		}
+		for _, outpointKey := range itx.Inputs {
+			if _, ok := model.GlobalConfirmedSpentUtxoMap[outpointKey]; ok {
+				conflictedTxs[txid] = itx
+				break
+			}
+		}
+	}
+
+	// 冲突tx的所有后代均失效
+	invalidTxs = make(map[string]struct{}, len(conflictedTxs))
+	for txid := range conflictedTxs {
+		invalidTxs[txid] = struct{}{}
+		mp.markDescendants(txid, childrenTxs, invalidTxs)
+	}
+	// 被确认tx的其余后代需要重新同步
+	descendantTxs := make(map[string]struct{}, 0)
+	for txid := range confirmedTxs {
+		mp.markDescendants(txid, childrenTxs, descendantTxs)
+	}
+	requeueTxs = make([]*IndexedTx, 0)
+	for txid := range descendantTxs {
+		if _, ok := confirmedTxs[txid]; ok {
+			continue
+		}
+		if _, ok := invalidTxs[txid]; ok {
+			continue
+		}
+		invalidTxs[txid] = struct{}{}
+		requeueTxs = append(requeueTxs, mp.IndexedTxs[txid])
+	}
+
+	sort.Slice(requeueTxs, func(i, j int) bool {
+		return requeueTxs[i].TxIdx < requeueTxs[j].TxIdx
+	})
+
+	logger.Log.Info("reconcile mempool",
+		zap.Int("nConfirmed", len(confirmedTxs)),
+		zap.Int("nConflicted", len(conflictedTxs)),
+		zap.Int("nInvalid", len(invalidTxs)-len(requeueTxs)),
+		zap.Int("nRequeue", len(requeueTxs)))
+
+	return confirmedTxs, invalidTxs, requeueTxs
+}
+
+// classifyDroppedTxs 找出已索引、但节点内存池中已不存在的tx及其后代
+// nodeTxs为节点内存池所有txid(hex)
+func (mp *Mempool) classifyDroppedTxs(nodeTxs map[string][]string) map[string]*IndexedTx {
+	var childrenTxs map[string][]string
+	marked := make(map[string]struct{}, 0)
+	for txid, itx := range mp.IndexedTxs {
+		if _, ok := nodeTxs[itx.TxIdHex]; ok {
+			continue
+		}
+		if childrenTxs == nil {
+			childrenTxs = mp.indexChildrenTxs()
+		}
+		marked[txid] = struct{}{}
+		mp.markDescendants(txid, childrenTxs, marked)
+	}
+
+	droppedTxs := make(map[string]*IndexedTx, len(marked))
+	for txid := range marked {
+		droppedTxs[txid] = mp.IndexedTxs[txid]
+	}
+	return droppedTxs
+}
+
+// indexChildrenTxs 建立已索引tx的父子关系，key为父txid
+func (mp *Mempool) indexChildrenTxs() map[string][]string {
+	childrenTxs := make(map[string][]string, 0)
+	for txid, itx := range mp.IndexedTxs {
+		for _, outpointKey := range itx.Inputs {
+			parentTxid := outpointKey[:32]
+			if _, ok := mp.IndexedTxs[parentTxid]; ok {
+				childrenTxs[parentTxid] = append(childrenTxs[parentTxid], txid)
+			}
+		}
+	}
+	return childrenTxs
+}
+
+// markDescendants 标记tx的所有后代
+func (mp *Mempool) markDescendants(txid string, childrenTxs map[string][]string, marked map[string]struct{}) {
+	stack := []string{txid}
+	for len(stack) > 0 {
+		txid = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range childrenTxs[txid] {
+			if _, ok := marked[child]; ok {
+				continue
+			}
+			marked[child] = struct{}{}
+			stack = append(stack, child)
+		}
+	}
+}
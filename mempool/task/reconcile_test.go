@@ -0,0 +1,141 @@
+package task
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sensibled/model"
+	"strings"
+	"testing"
+)
+
+// testTxid 构造测试用32字节txid
+func testTxid(name string) string {
+	return name + strings.Repeat("_", 32-len(name))
+}
+
+func testOutpoint(txid string, vout uint32) string {
+	key := make([]byte, 36)
+	copy(key, txid)
+	binary.LittleEndian.PutUint32(key[32:], vout)
+	return string(key)
+}
+
+func newTestReconcileMempool(txs []*IndexedTx) *Mempool {
+	mp := &Mempool{}
+	mp.ResetIndex()
+	for _, itx := range txs {
+		txid, _ := hex.DecodeString(itx.TxIdHex)
+		mp.IndexedTxs[string(txid)] = itx
+	}
+	return mp
+}
+
+func newTestIndexedTx(name string, idx uint64, inputs ...string) *IndexedTx {
+	return &IndexedTx{
+		TxIdHex: hex.EncodeToString([]byte(testTxid(name))),
+		TxIdx:   idx,
+		NOut:    1,
+		Inputs:  inputs,
+	}
+}
+
+func TestReconcileClassify(t *testing.T) {
+	model.CleanConfirmedTxMap(true)
+	defer model.CleanConfirmedTxMap(true)
+
+	confirmed := newTestIndexedTx("confirmed", 1, testOutpoint(testTxid("chain"), 0))
+	child := newTestIndexedTx("child", 2, testOutpoint(testTxid("confirmed"), 0))
+	grandchild := newTestIndexedTx("grandchild", 5, testOutpoint(testTxid("child"), 0))
+	conflicted := newTestIndexedTx("conflicted", 3, testOutpoint(testTxid("chain"), 1))
+	conflictedChild := newTestIndexedTx("conflictedchild", 4, testOutpoint(testTxid("conflicted"), 0))
+	// 同时是被确认tx和冲突tx的后代，只能删除，不能重新同步
+	mixedChild := newTestIndexedTx("mixedchild", 6,
+		testOutpoint(testTxid("confirmed"), 1), testOutpoint(testTxid("conflicted"), 1))
+	unrelated := newTestIndexedTx("unrelated", 7, testOutpoint(testTxid("chain"), 2))
+
+	mp := newTestReconcileMempool([]*IndexedTx{
+		confirmed, child, grandchild, conflicted, conflictedChild, mixedChild, unrelated,
+	})
+
+	model.GlobalConfirmedTxMap[confirmed.TxIdHex] = struct{}{}
+	model.GlobalConfirmedSpentUtxoMap[testOutpoint(testTxid("chain"), 0)] = &model.SpentByTx{}
+	model.GlobalConfirmedSpentUtxoMap[testOutpoint(testTxid("chain"), 1)] = &model.SpentByTx{}
+
+	confirmedTxs, invalidTxs, requeueTxs := mp.classifyReconcileTxs()
+
+	if len(confirmedTxs) != 1 {
+		t.Fatalf("confirmed count %d, want 1", len(confirmedTxs))
+	}
+	if _, ok := confirmedTxs[testTxid("confirmed")]; !ok {
+		t.Fatal("confirmed tx not classified as confirmed")
+	}
+
+	wantInvalid := []string{"child", "grandchild", "conflicted", "conflictedchild", "mixedchild"}
+	if len(invalidTxs) != len(wantInvalid) {
+		t.Fatalf("invalid count %d, want %d", len(invalidTxs), len(wantInvalid))
+	}
+	for _, name := range wantInvalid {
+		if _, ok := invalidTxs[testTxid(name)]; !ok {
+			t.Fatalf("tx %s not removed", name)
+		}
+	}
+	if _, ok := invalidTxs[testTxid("unrelated")]; ok {
+		t.Fatal("unrelated tx removed")
+	}
+
+	wantRequeue := []*IndexedTx{child, grandchild}
+	if len(requeueTxs) != len(wantRequeue) {
+		t.Fatalf("requeue count %d, want %d", len(requeueTxs), len(wantRequeue))
+	}
+	for i, itx := range wantRequeue {
+		if requeueTxs[i] != itx {
+			t.Fatalf("requeue[%d] = %s, want %s", i, requeueTxs[i].TxIdHex, itx.TxIdHex)
+		}
+	}
+}
+
+func TestReconcileClassifyNoConfirmed(t *testing.T) {
+	model.CleanConfirmedTxMap(true)
+	defer model.CleanConfirmedTxMap(true)
+
+	mp := newTestReconcileMempool([]*IndexedTx{
+		newTestIndexedTx("a", 1, testOutpoint(testTxid("chain"), 0)),
+		newTestIndexedTx("b", 2, testOutpoint(testTxid("a"), 0)),
+	})
+
+	confirmedTxs, invalidTxs, requeueTxs := mp.classifyReconcileTxs()
+	if len(confirmedTxs) != 0 || len(invalidTxs) != 0 || len(requeueTxs) != 0 {
+		t.Fatalf("unexpected changes: confirmed %d, invalid %d, requeue %d",
+			len(confirmedTxs), len(invalidTxs), len(requeueTxs))
+	}
+}
+
+func TestResyncClassifyDropped(t *testing.T) {
+	kept := newTestIndexedTx("kept", 1, testOutpoint(testTxid("chain"), 0))
+	dropped := newTestIndexedTx("dropped", 2, testOutpoint(testTxid("chain"), 1))
+	droppedChild := newTestIndexedTx("droppedchild", 3, testOutpoint(testTxid("dropped"), 0))
+	keptChild := newTestIndexedTx("keptchild", 4, testOutpoint(testTxid("kept"), 0))
+	mp := newTestReconcileMempool([]*IndexedTx{kept, dropped, droppedChild, keptChild})
+
+	// 节点内存池仍保留后代，但其父tx已丢弃，同样需要删除
+	nodeTxs := map[string][]string{
+		kept.TxIdHex:         nil,
+		droppedChild.TxIdHex: {dropped.TxIdHex},
+		keptChild.TxIdHex:    {kept.TxIdHex},
+	}
+	droppedTxs := mp.classifyDroppedTxs(nodeTxs)
+	if len(droppedTxs) != 2 {
+		t.Fatalf("dropped count %d, want 2", len(droppedTxs))
+	}
+	for _, itx := range []*IndexedTx{dropped, droppedChild} {
+		txid, _ := hex.DecodeString(itx.TxIdHex)
+		if droppedTxs[string(txid)] != itx {
+			t.Fatalf("tx %s not dropped", itx.TxIdHex)
+		}
+	}
+
+	nodeTxs[dropped.TxIdHex] = nil
+	if droppedTxs := mp.classifyDroppedTxs(nodeTxs); len(droppedTxs) != 0 {
+		t.Fatalf("dropped count %d, want 0", len(droppedTxs))
+	}
+}
@@ -0,0 +1,68 @@
+package serial
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/rdb"
+	"sensibled/utils"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// doubleSpendNotify 重复花费通知内容
+type doubleSpendNotify struct {
+	TxId           string `json:"txid"`
+	ConflictTxId   string `json:"conflictTxid"`
+	ConflictHeight uint32 `json:"conflictHeight"`
+	UTxid          string `json:"utxid"`
+	Vout           uint32 `json:"vout"`
+	Address        string `json:"address"`
+	CodeHash       string `json:"codehash"`
+	Genesis        string `json:"genesis"`
+	CodeType       uint32 `json:"codeType"`
+}
+
+// SaveDoubleSpendIntoRedis 记录重复花费，按地址/genesis索引，并发布通知
+// {dsa<addr>}、{dsg<genesis><codehash>}: 有序集合，member为txid+conflict_txid，score为发现时间
+func SaveDoubleSpendIntoRedis(records []*model.DoubleSpend) bool {
+	if len(records) == 0 {
+		return true
+	}
+
+	ctx := context.Background()
+	pipe := rdb.RdbBalanceClient.Pipeline()
+	for _, r := range records {
+		member := &redis.Z{Score: float64(r.Timestamp), Member: string(r.TxId) + string(r.ConflictTxId)}
+		if len(r.AddressPkh) > 0 {
+			pipe.ZAdd(ctx, "{dsa"+string(r.AddressPkh)+"}", member)
+		}
+		if len(r.GenesisId) > 0 {
+			pipe.ZAdd(ctx, "{dsg"+string(r.GenesisId)+string(r.CodeHash)+"}", member)
+		}
+
+		content, err := json.Marshal(&doubleSpendNotify{
+			TxId:           utils.HashString(r.TxId),
+			ConflictTxId:   utils.HashString(r.ConflictTxId),
+			ConflictHeight: r.ConflictHeight,
+			UTxid:          utils.HashString(r.UTxid),
+			Vout:           r.Vout,
+			Address:        hex.EncodeToString(r.AddressPkh),
+			CodeHash:       hex.EncodeToString(r.CodeHash),
+			Genesis:        hex.EncodeToString(r.GenesisId),
+			CodeType:       r.CodeType,
+		})
+		if err != nil {
+			continue
+		}
+		pipe.Publish(ctx, "double_spend", content)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Error("redis double spend exec failed", zap.Error(err))
+		return false
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sensibled/logger"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
 	"sort"
 
@@ -50,6 +51,10 @@ func SaveAddressTxHistoryIntoPika(needReset bool, addrPkhInTxMap map[string][]in
 	// 写入地址的交易历史
 	pipe := rdb.RdbAddrTxClient.Pipeline()
 	for strAddressPkh, listTxid := range addrPkhInTxMap {
+		// 未关注的地址不记录历史
+		if !prune.IsAddressWatched(strAddressPkh) {
+			continue
+		}
 		sort.Ints(listTxid)
 		lastTxIdx := -1
 		for _, txIdx := range listTxid {
@@ -73,6 +78,9 @@ func SaveAddressTxHistoryIntoPika(needReset bool, addrPkhInTxMap map[string][]in
 	// 记录哪些地址在内存池中更新了交易历史
 	rdsPipe := rdb.RdbBalanceClient.TxPipeline()
 	for strAddressPkh := range addrPkhInTxMap {
+		if !prune.IsAddressWatched(strAddressPkh) {
+			continue
+		}
 		rdsPipe.SAdd(ctx, "mp:addresses", strAddressPkh)
 	}
 	if _, err := rdsPipe.Exec(ctx); err != nil {
@@ -82,3 +90,24 @@ func SaveAddressTxHistoryIntoPika(needReset bool, addrPkhInTxMap map[string][]in
 	}
 	return true
 }
+
+// RemoveAddressTxHistoryInPika 从Pika删除部分内存池tx的addr tx历史
+func RemoveAddressTxHistoryInPika(addrPkhInTxMap map[string][]int) bool {
+	if len(addrPkhInTxMap) == 0 {
+		return true
+	}
+
+	ctx := context.Background()
+	pipe := rdb.RdbAddrTxClient.Pipeline()
+	for strAddressPkh, listTxid := range addrPkhInTxMap {
+		for _, txIdx := range listTxid {
+			key := fmt.Sprintf("%d:%d", model.MEMPOOL_HEIGHT, txIdx)
+			pipe.ZRem(ctx, "{ah"+strAddressPkh+"}", key) // 有序address tx history数据清除
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Error("pika remove mempool address tx exec failed", zap.Error(err))
+		return false
+	}
+	return true
+}
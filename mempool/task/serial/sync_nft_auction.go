@@ -0,0 +1,81 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/mempool/store"
+	"sensibled/model"
+	blockSerial "sensibled/task/serial"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// SyncBlockNFTAuction 记录内存池nft拍卖状态变化，返回各拍卖的最新状态
+func SyncBlockNFTAuction(startIdx int, txs []*model.Tx, mpNewUtxo, removeUtxo, mpSpentUtxo map[string]*model.TxoData) (auctionMap map[string]*model.NFTAuctionEvent) {
+	getSpentTxo := func(outpointKey string) *model.TxoData {
+		if obj, ok := mpNewUtxo[outpointKey]; ok {
+			return obj
+		} else if obj, ok := removeUtxo[outpointKey]; ok {
+			return obj
+		} else if obj, ok := mpSpentUtxo[outpointKey]; ok {
+			return obj
+		}
+		return nil
+	}
+
+	auctionMap = make(map[string]*model.NFTAuctionEvent, 0)
+	for txIdx, tx := range txs {
+		events := model.ParseNFTAuctionEvents(tx, getSpentTxo)
+		for idx, event := range events {
+			event.Height = model.MEMPOOL_HEIGHT
+			event.TxId = tx.TxId
+			if _, err := store.SyncStmtNFTAuction.Exec(
+				model.MEMPOOL_HEIGHT, // uint32(block.Height),
+				0,                    // block.BlockTime,
+				uint64(startIdx+txIdx),
+				string(tx.TxId),
+				uint32(idx),
+				string(event.AuctionId),
+				string(event.CodeHash),
+				string(event.NFTCodeHash),
+				string(event.NFTID),
+				event.Event,
+				string(event.SenderPkh),
+				string(event.BidderPkh),
+				event.Price,
+				event.EndTimestamp,
+				event.Vout,
+				"", //string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-nft-auction-err",
+					zap.String("txid", tx.TxIdHex),
+					zap.String("err", err.Error()),
+				)
+			}
+
+			if event.Event != model.NFT_AUCTION_OUTBID {
+				auctionMap[string(event.AuctionId)] = event
+			}
+		}
+	}
+	return auctionMap
+}
+
+// UpdateNFTAuctionInRedis 更新内存池中拍卖的最新状态，mp:nai<auctionId>
+func UpdateNFTAuctionInRedis(pipe redis.Pipeliner, auctionMap map[string]*model.NFTAuctionEvent) {
+	ctx := context.Background()
+	for auctionId, event := range auctionMap {
+		mpkeyNAI := "mp:nai" + auctionId
+		blockSerial.SetNFTAuctionState(pipe, mpkeyNAI, event)
+		pipe.SAdd(ctx, "mp:keys", mpkeyNAI)
+	}
+}
+
+// RemoveNFTAuctionInRedis 删除内存池中拍卖的状态
+func RemoveNFTAuctionInRedis(pipe redis.Pipeliner, auctionIds map[string]struct{}) {
+	ctx := context.Background()
+	for auctionId := range auctionIds {
+		pipe.Del(ctx, "mp:nai"+auctionId)
+	}
+}
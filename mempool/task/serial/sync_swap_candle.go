@@ -0,0 +1,87 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/mempool/store"
+	"sensibled/model"
+	blockSerial "sensibled/task/serial"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// SyncBlockSwapCandle 记录内存池swap池K线，每个tx一条，以便tx被移除时删除，返回各池的最新储备
+func SyncBlockSwapCandle(startIdx int, txs []*model.Tx, mpNewUtxo, removeUtxo, mpSpentUtxo map[string]*model.TxoData) (reserveMap map[string]*model.SwapCandle) {
+	getSpentTxo := func(outpointKey string) *model.TxoData {
+		if obj, ok := mpNewUtxo[outpointKey]; ok {
+			return obj
+		} else if obj, ok := removeUtxo[outpointKey]; ok {
+			return obj
+		} else if obj, ok := mpSpentUtxo[outpointKey]; ok {
+			return obj
+		}
+		return nil
+	}
+
+	now := uint32(time.Now().Unix())
+	reserveMap = make(map[string]*model.SwapCandle, 0)
+	for txIdx, tx := range txs {
+		swapIn, swapOut, operation := model.ParseSwapTx(tx, getSpentTxo)
+		if swapIn == nil {
+			continue
+		}
+		candle := model.NewSwapCandle(swapIn, swapOut)
+		candle.Height = model.MEMPOOL_HEIGHT
+		candle.AddSwap(swapIn, swapOut, operation, uint64(startIdx+txIdx), tx.TxId)
+
+		for _, period := range model.SwapCandlePeriods {
+			if _, err := store.SyncStmtSwapCandle.Exec(
+				model.MEMPOOL_HEIGHT, // uint32(block.Height),
+				period,
+				now-now%period,
+				string(candle.CodeHash),
+				string(candle.GenesisId),
+				candle.Open,
+				candle.High,
+				candle.Low,
+				candle.Close,
+				candle.Volume1,
+				candle.Volume2,
+				candle.Trades,
+				candle.Reserve1,
+				candle.Reserve2,
+				candle.Lp,
+				candle.TxIdx,
+				string(candle.TxId),
+				"", //string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-swap-candle-err",
+					zap.String("txid", tx.TxIdHex),
+					zap.String("err", err.Error()),
+				)
+			}
+		}
+		reserveMap[string(candle.CodeHash)+string(candle.GenesisId)] = candle
+	}
+	return reserveMap
+}
+
+// UpdateSwapReserveInRedis 更新内存池中swap池的最新储备，mp:swr<codehash><genesis>
+func UpdateSwapReserveInRedis(pipe redis.Pipeliner, reserveMap map[string]*model.SwapCandle) {
+	ctx := context.Background()
+	for key, candle := range reserveMap {
+		mpkeySWR := "mp:swr" + key
+		blockSerial.SetSwapReserve(pipe, mpkeySWR, candle)
+		pipe.SAdd(ctx, "mp:keys", mpkeySWR)
+	}
+}
+
+// RemoveSwapReserveInRedis 删除内存池中swap池的储备
+func RemoveSwapReserveInRedis(pipe redis.Pipeliner, pools map[string]struct{}) {
+	ctx := context.Background()
+	for key := range pools {
+		pipe.Del(ctx, "mp:swr"+key)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sensibled/logger"
 	"sensibled/mempool/store"
 	"sensibled/model"
+	"sensibled/prune"
 
 	"go.uber.org/zap"
 )
@@ -11,6 +12,9 @@ import (
 // SyncBlockTx all tx in block height
 func SyncBlockTx(startIdx int, txs []*model.Tx) {
 	for txIdx, tx := range txs {
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
 		if _, err := store.SyncStmtTx.Exec(
 			string(tx.TxId),
 			tx.TxInCnt,
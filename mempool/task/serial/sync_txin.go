@@ -1,9 +1,11 @@
 package serial
 
 import (
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/mempool/store"
 	"sensibled/model"
+	"sensibled/prune"
 
 	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
 	"go.uber.org/zap"
@@ -16,6 +18,9 @@ func SyncBlockTxInputDetail(startIdx int, txs []*model.Tx, mpNewUtxo, removeUtxo
 	}
 
 	for txIdx, tx := range txs {
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
 		for vin, input := range tx.TxIns {
 			objData := commonObjData
 			if obj, ok := mpNewUtxo[input.InputOutpointKey]; ok {
@@ -48,18 +53,11 @@ func SyncBlockTxInputDetail(startIdx int, txs []*model.Tx, mpNewUtxo, removeUtxo
 
 			codehash := ""
 			genesis := ""
-			if objData.Data.CodeType != scriptDecoder.CodeType_NONE && objData.Data.CodeType != scriptDecoder.CodeType_SENSIBLE {
+			var dataValue uint64
+			if contract.IsToken(objData.Data) {
 				codehash = string(objData.Data.CodeHash[:])                          // 20 bytes
 				genesis = string(objData.Data.GenesisId[:objData.Data.GenesisIdLen]) // 20/36/40 bytes
-			}
-
-			var dataValue uint64
-			if objData.Data.CodeType == scriptDecoder.CodeType_NFT {
-				dataValue = objData.Data.NFT.TokenIndex
-			} else if objData.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-				dataValue = objData.Data.NFTSell.TokenIndex
-			} else if objData.Data.CodeType == scriptDecoder.CodeType_FT {
-				dataValue = objData.Data.FT.Amount
+				dataValue = contract.Get(objData.Data.CodeType).DataValue(objData.Data)
 			}
 
 			if _, err := store.SyncStmtTxIn.Exec(
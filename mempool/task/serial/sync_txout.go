@@ -1,19 +1,28 @@
 package serial
 
 import (
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/mempool/store"
 	"sensibled/model"
+	"sensibled/prune"
 
-	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
 	"go.uber.org/zap"
 )
 
 // SyncBlockTxOutputInfo all tx output info
 func SyncBlockTxOutputInfo(startIdx int, txs []*model.Tx) {
 	for txIdx, tx := range txs {
-		for vout, output := range tx.TxOuts {
+		for _, output := range tx.TxOuts {
 			tx.OutputsValue += output.Satoshi
+		}
+
+		// 只索引token时，跳过无关tx
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
+
+		for vout, output := range tx.TxOuts {
 
 			address := ""
 			codehash := ""
@@ -21,18 +30,11 @@ func SyncBlockTxOutputInfo(startIdx int, txs []*model.Tx) {
 			if output.Data.HasAddress {
 				address = string(output.Data.AddressPkh[:]) // 20 bytes
 			}
-			if output.Data.CodeType != scriptDecoder.CodeType_NONE && output.Data.CodeType != scriptDecoder.CodeType_SENSIBLE {
+			var dataValue uint64
+			if contract.IsToken(output.Data) {
 				codehash = string(output.Data.CodeHash[:])                         // 20 bytes
 				genesis = string(output.Data.GenesisId[:output.Data.GenesisIdLen]) // 20/36/40 bytes
-			}
-
-			var dataValue uint64
-			if output.Data.CodeType == scriptDecoder.CodeType_NFT {
-				dataValue = output.Data.NFT.TokenIndex
-			} else if output.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-				dataValue = output.Data.NFTSell.TokenIndex
-			} else if output.Data.CodeType == scriptDecoder.CodeType_FT {
-				dataValue = output.Data.FT.Amount
+				dataValue = contract.Get(output.Data.CodeType).DataValue(output.Data)
 			}
 
 			if _, err := store.SyncStmtTxOut.Exec(
@@ -3,10 +3,11 @@ package serial
 import (
 	"context"
 	"encoding/hex"
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
-	"strconv"
 
 	redis "github.com/go-redis/redis/v8"
 	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
@@ -20,10 +21,7 @@ func ParseGetSpentUtxoDataFromRedisSerial(
 	spentUtxoKeysMap map[string]struct{},
 	newUtxoDataMap, removeUtxoDataMap, spentUtxoDataMap map[string]*model.TxoData) {
 
-	pipe := rdb.RdbUtxoClient.Pipeline()
-	m := map[string]*redis.StringCmd{}
-	needExec := false
-	ctx := context.Background()
+	outpointKeys := make([]string, 0)
 	for outpointKey := range spentUtxoKeysMap {
 		if _, ok := newUtxoDataMap[outpointKey]; ok {
 			continue
@@ -35,35 +33,32 @@ func ParseGetSpentUtxoDataFromRedisSerial(
 		}
 
 		// 检查是否在区块缓存
-		if data, ok := model.GlobalNewUtxoDataMap[outpointKey]; ok {
+		if data, ok := model.GlobalNewUtxoDataMap.Get(outpointKey); ok {
 			spentUtxoDataMap[outpointKey] = data
-			// delete(model.GlobalNewUtxoDataMap, outpointKey)
+			// model.GlobalNewUtxoDataMap.Delete(outpointKey)
 			continue
 		}
 
-		needExec = true
-		m[outpointKey] = pipe.Get(ctx, "u"+outpointKey)
+		outpointKeys = append(outpointKeys, outpointKey)
 	}
 
-	if !needExec {
+	if len(outpointKeys) == 0 {
 		return
 	}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
+	utxoBufs, err := rdb.UtxoDB.Get(outpointKeys)
+	if err != nil {
 		panic(err)
 	}
-	for outpointKey, v := range m {
-		res, err := v.Result()
-		if err == redis.Nil {
+	for _, outpointKey := range outpointKeys {
+		res, ok := utxoBufs[outpointKey]
+		if !ok {
 			logger.Log.Error("parse mempool, but missing utxo from redis",
 				zap.String("outpoint", hex.EncodeToString([]byte(outpointKey))))
 			continue
-		} else if err != nil {
-			panic(err)
 		}
 		d := &model.TxoData{}
-		d.Unmarshal([]byte(res))
+		d.Unmarshal(res)
 
 		// 补充数据
 		d.ScriptType = scriptDecoder.GetLockingScriptType(d.PkScript)
@@ -73,6 +68,34 @@ func ParseGetSpentUtxoDataFromRedisSerial(
 	}
 }
 
+// MarkIndexedTxSerial 只索引token时，标记涉及sensible合约或关注地址的tx，并记录这些tx输出的address历史
+func MarkIndexedTxSerial(startIdx int, txs []*model.Tx, mpNewUtxo, removeUtxo, mpSpentUtxo map[string]*model.TxoData, addrPkhInTxMap map[string][]int) {
+	for txIdx, tx := range txs {
+		tx.IsIndexed = prune.IsTxOutputsIndexed(tx)
+		for _, input := range tx.TxIns {
+			if tx.IsIndexed {
+				break
+			}
+			if obj, ok := mpNewUtxo[input.InputOutpointKey]; ok {
+				tx.IsIndexed = prune.IsTxoIndexed(obj.Data)
+			} else if obj, ok := removeUtxo[input.InputOutpointKey]; ok {
+				tx.IsIndexed = prune.IsTxoIndexed(obj.Data)
+			} else if obj, ok := mpSpentUtxo[input.InputOutpointKey]; ok {
+				tx.IsIndexed = prune.IsTxoIndexed(obj.Data)
+			}
+		}
+		if !tx.IsIndexed {
+			continue
+		}
+		for _, output := range tx.TxOuts {
+			if output.Data.HasAddress {
+				address := string(output.Data.AddressPkh[:])
+				addrPkhInTxMap[address] = append(addrPkhInTxMap[address], startIdx+txIdx)
+			}
+		}
+	}
+}
+
 // UpdateUtxoInLocalMapSerial 顺序更新当前处理的一批内存池交易的utxo信息变化，删除产生又立即花费的utxo
 func UpdateUtxoInLocalMapSerial(spentUtxoKeysMap map[string]struct{},
 	newUtxoDataMap, removeUtxoDataMap map[string]*model.TxoData) {
@@ -97,81 +120,31 @@ func UpdateUtxoInLocalMapSerial(spentUtxoKeysMap map[string]struct{},
 	}
 }
 
-// UpdateUtxoInPika 批量更新redis utxo
+// UpdateUtxoInPika 批量更新全局utxo存储(pika或本地)
 func UpdateUtxoInPika(utxoToRestore, utxoToRemove map[string]*model.TxoData) bool {
 	logger.Log.Info("UpdateUtxoInPika",
 		zap.Int("add", len(utxoToRestore)),
 		zap.Int("del", len(utxoToRemove)))
 
-	ctx := context.Background()
-	// delete batch
-	outpointKeys := make([]string, len(utxoToRemove))
-	idx := 0
+	outpointKeys := make([]string, 0, len(utxoToRemove))
 	for outpointKey := range utxoToRemove {
-		outpointKeys[idx] = outpointKey
-		idx++
-	}
-	if len(utxoToRemove) > 0 {
-		sliceLen := 512
-		for idx := 0; idx < (len(outpointKeys)-1)/sliceLen+1; idx++ {
-
-			pikaPipe := rdb.RdbUtxoClient.Pipeline()
-			n := 0
-			for _, outpointKey := range outpointKeys[idx*sliceLen:] {
-				if n == sliceLen {
-					break
-				}
-				// redis全局utxo数据清除
-				pikaPipe.Del(ctx, "u"+outpointKey)
-				n++
-			}
-			if _, err := pikaPipe.Exec(ctx); err != nil && err != redis.Nil {
-				logger.Log.Error("pika delete exec failed", zap.Error(err))
-				return false
-			}
-		}
+		outpointKeys = append(outpointKeys, outpointKey)
 	}
 
-	// add batch
-	idx = 0
-	utxoBufToRestore := make([][]byte, len(utxoToRestore))
+	utxoBufToRestore := make(map[string][]byte, len(utxoToRestore))
 	for outpointKey, data := range utxoToRestore {
 		buf := make([]byte, 36+20+len(data.PkScript))
 		length := data.Marshal(buf)
-
-		buf = append(buf[:length], []byte(outpointKey)...)
-		utxoBufToRestore[idx] = buf[:length+36]
-		idx++
+		utxoBufToRestore[outpointKey] = buf[:length]
 	}
-	if len(utxoToRestore) > 0 {
-		sliceLen := 512
-		for idx := 0; idx < (len(utxoBufToRestore)-1)/sliceLen+1; idx++ {
-
-			pikaPipe := rdb.RdbUtxoClient.Pipeline()
-			n := 0
-			for _, utxoBuf := range utxoBufToRestore[idx*sliceLen:] {
-				if n == sliceLen {
-					break
-				}
-				length := len(utxoBuf)
-				// redis全局utxo数据添加，以便关联后续花费的input，无论是否识别地址都需要记录
-				pikaPipe.Set(ctx, "u"+string(utxoBuf[length-36:]), utxoBuf[:length-36], 0)
-				n++
-			}
-			if _, err := pikaPipe.Exec(ctx); err != nil && err != redis.Nil {
-				logger.Log.Error("pika store exec failed", zap.Error(err))
-				return false
-			}
-		}
+
+	if err := rdb.UtxoDB.Update(outpointKeys, utxoBufToRestore); err != nil {
+		logger.Log.Error("utxo store update failed", zap.Error(err))
+		return false
 	}
 
 	logger.Log.Info("UpdateUtxoInPika finished")
 	return true
-
-	// for outpointKey := range utxoToSpend {
-	// 	// redis全局utxo数据不能在这里清除，留给区块确认时去做
-	// 	pikaPipe.Del(ctx, "u"+outpointKey)
-	// }
 }
 
 // UpdateUtxoInRedis 批量更新redis utxo
@@ -213,9 +186,11 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, needReset bool, utxoToRestore, utxo
 	// 更新内存池数据
 	mpkeys := make([]string, 5*(len(utxoToRestore)+len(utxoToRemove)+len(utxoToSpend)))
 	for outpointKey, data := range utxoToRestore {
+		// 未关注的地址、genesis，以及只索引token时的无关输出不记录索引
+		if !prune.IsTxoWatched(data.Data) {
+			continue
+		}
 		strAddressPkh := string(data.Data.AddressPkh[:])
-		strCodeHash := string(data.Data.CodeHash[:])
-		strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
 
 		// redis有序utxo数据添加
 		member := &redis.Z{Score: float64(data.BlockHeight)*1000000000 + float64(data.TxIdx), Member: outpointKey}
@@ -258,109 +233,21 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, needReset bool, utxoToRestore, utxo
 		mpkeys = append(mpkeys, mpkeyCB)
 
 		// redis有序genesis utxo数据添加
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			mpkeyNU := "mp:{nu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyND := "mp:nd" + strCodeHash + strGenesisId
-			mpkeyNO := "mp:{no" + strGenesisId + strCodeHash + "}"
-			mpkeyNS := "mp:{ns" + strAddressPkh + "}"
-			mpkeys = append(mpkeys, mpkeyNU, mpkeyND, mpkeyNO, mpkeyNS)
-
-			member.Score = float64(data.Data.NFT.TokenIndex)
-			pipe.ZAdd(ctx, mpkeyNU, member)                         // nft:utxo
-			pipe.ZAdd(ctx, mpkeyND, member)                         // nft:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNO, 1, strAddressPkh)            // nft:owners
-			pipe.ZIncrBy(ctx, mpkeyNS, 1, strCodeHash+strGenesisId) // nft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
-			mpkeyNAU := "mp:{nau" + strAddressPkh + "}" + strCodeHash
-			mpkeyNAD := "mp:nad" + strCodeHash + strGenesisId
-			mpkeyNAS := "mp:{nas" + strAddressPkh + "}"
-			mpkeys = append(mpkeys, mpkeyNAU, mpkeyNAD, mpkeyNAS)
-
-			pipe.ZAdd(ctx, mpkeyNAU, member)            // nft:auction:utxo
-			pipe.ZAdd(ctx, mpkeyNAD, member)            // nft:auction:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNAS, 1, strCodeHash) // nft:auction:sender-summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			mpkeySUT := "mp:{sut}"
-			mpkeySUTA := "mp:{suta" + strAddressPkh + "}"
-			mpkeySUTC := "mp:{sutc" + strGenesisId + strCodeHash + "}"
-			mpkeySUP := "mp:{sup}"
-			mpkeySUPA := "mp:{supa" + strAddressPkh + "}"
-			mpkeySUPC := "mp:{supc" + strGenesisId + strCodeHash + "}"
-			mpkeySUI := "mp:{sui}"
-			mpkeySUIA := "mp:{suia" + strAddressPkh + "}"
-			mpkeySUIC := "mp:{suic" + strGenesisId + strCodeHash + "}"
-
-			mpkeys = append(mpkeys, mpkeySUT, mpkeySUTA, mpkeySUTC, mpkeySUP, mpkeySUPA, mpkeySUPC, mpkeySUI, mpkeySUIA, mpkeySUIC)
-
-			pipe.ZAdd(ctx, mpkeySUT, member)  // nft:sell:all:utxo, sort by time
-			pipe.ZAdd(ctx, mpkeySUTA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUTC, member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.Price)
-			pipe.ZAdd(ctx, mpkeySUP, member)  // nft:sell:all:utxo, sort by price
-			pipe.ZAdd(ctx, mpkeySUPA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUPC, member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.TokenIndex)
-			pipe.ZAdd(ctx, mpkeySUI, member)  // nft:sell:all:utxo, sort by token index
-			pipe.ZAdd(ctx, mpkeySUIA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUIC, member) // nft:sell
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			mpkeyFU := "mp:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyFB := "mp:{fb" + strGenesisId + strCodeHash + "}"
-			mpkeyFS := "mp:{fs" + strAddressPkh + "}"
-			mpkeys = append(mpkeys, mpkeyFU, mpkeyFB, mpkeyFS)
-
-			pipe.ZAdd(ctx, mpkeyFU, member)                                                    // ft:utxo
-			pipe.ZIncrBy(ctx, mpkeyFB, float64(data.Data.FT.Amount), strAddressPkh)            // ft:balance
-			pipe.ZIncrBy(ctx, mpkeyFS, float64(data.Data.FT.Amount), strCodeHash+strGenesisId) // ft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			mpkeyFU := "mp:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeys = append(mpkeys, mpkeyFU)
-
-			pipe.ZAdd(ctx, mpkeyFU, member) // ft:utxo
-
-		}
+		setKeys, counterKeys := contract.AddUtxoIndexes(ctx, pipe, outpointKey, data, member.Score, "mp:", "mp:", 1)
+		mpkeys = append(mpkeys, setKeys...)
+		mpkeys = append(mpkeys, counterKeys...)
 
 		// update token info
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			pipe.HSet(ctx, "nI"+strCodeHash+strGenesisId+strconv.Itoa(int(data.Data.NFT.TokenIndex)),
-				"metatxid", data.Data.NFT.MetaTxId[:],
-				"metavout", data.Data.NFT.MetaOutputIndex,
-				"supply", data.Data.NFT.TokenSupply,
-				"sensibleid", data.Data.NFT.SensibleId,
-			)
-			pipe.HSet(ctx, "ni"+strCodeHash+strGenesisId,
-				"supply", data.Data.NFT.TokenSupply,
-				"sensibleid", data.Data.NFT.SensibleId,
-			)
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			pipe.HSet(ctx, "fi"+strCodeHash+strGenesisId,
-				"decimal", data.Data.FT.Decimal,
-				"name", data.Data.FT.Name,
-				"symbol", data.Data.FT.Symbol,
-				"sensibleid", data.Data.FT.SensibleId,
-			)
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			pipe.HSet(ctx, "fi"+strCodeHash+strGenesisId,
-				"sensibleid", data.Data.Uniq.SensibleId,
-			)
-		}
-
+		contract.Get(data.Data.CodeType).UpdateInfo(ctx, pipe, data.Data)
 	}
 
-	addrToRemove := make(map[string]struct{}, 1)
-	tokenToRemove := make(map[string]struct{}, 1)
+	counterToClean := make(map[string]struct{}, 1)
 	for outpointKey, data := range utxoToRemove {
+		// 未关注的地址、genesis，以及只索引token时的无关输出不记录索引
+		if !prune.IsTxoWatched(data.Data) {
+			continue
+		}
 		strAddressPkh := string(data.Data.AddressPkh[:])
-		strCodeHash := string(data.Data.CodeHash[:])
-		strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
 
 		if data.Data.CodeType == scriptDecoder.CodeType_NONE {
 			// redis有序utxo数据清除
@@ -386,72 +273,20 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, needReset bool, utxoToRestore, utxo
 		pipe.DecrBy(ctx, mpkeyCB, int64(data.Satoshi))
 
 		// redis有序genesis utxo数据清除
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			mpkeyNU := "mp:{nu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyND := "mp:nd" + strCodeHash + strGenesisId
-			mpkeyNO := "mp:{no" + strGenesisId + strCodeHash + "}"
-			mpkeyNS := "mp:{ns" + strAddressPkh + "}"
-
-			pipe.ZRem(ctx, mpkeyNU, outpointKey)                     // nft:utxo
-			pipe.ZRem(ctx, mpkeyND, outpointKey)                     // nft:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNO, -1, strAddressPkh)            // nft:owners
-			pipe.ZIncrBy(ctx, mpkeyNS, -1, strCodeHash+strGenesisId) // nft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
-			mpkeyNAU := "mp:{nau" + strAddressPkh + "}" + strCodeHash
-			mpkeyNAD := "mp:nad" + strCodeHash + strGenesisId
-			mpkeyNAS := "mp:{nas" + strAddressPkh + "}"
-
-			pipe.ZRem(ctx, mpkeyNAU, outpointKey)        // nft:auction:utxo
-			pipe.ZRem(ctx, mpkeyNAD, outpointKey)        // nft:auction:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNAS, -1, strCodeHash) // nft:auction:sender-summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			mpkeySUT := "mp:{sut}"
-			mpkeySUTA := "mp:{suta" + strAddressPkh + "}"
-			mpkeySUTC := "mp:{sutc" + strGenesisId + strCodeHash + "}"
-			mpkeySUP := "mp:{sup}"
-			mpkeySUPA := "mp:{supa" + strAddressPkh + "}"
-			mpkeySUPC := "mp:{supc" + strGenesisId + strCodeHash + "}"
-			mpkeySUI := "mp:{sui}"
-			mpkeySUIA := "mp:{suia" + strAddressPkh + "}"
-			mpkeySUIC := "mp:{suic" + strGenesisId + strCodeHash + "}"
-
-			pipe.ZRem(ctx, mpkeySUT, outpointKey)  // nft:sell:all:utxo, sort by time
-			pipe.ZRem(ctx, mpkeySUTA, outpointKey) // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, mpkeySUTC, outpointKey) // nft:sell
-
-			pipe.ZRem(ctx, mpkeySUP, outpointKey)  // nft:sell:all:utxo, sort by price
-			pipe.ZRem(ctx, mpkeySUPA, outpointKey) // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, mpkeySUPC, outpointKey) // nft:sell
-
-			pipe.ZRem(ctx, mpkeySUI, outpointKey)  // nft:sell:all:utxo, sort by token index
-			pipe.ZRem(ctx, mpkeySUIA, outpointKey) // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, mpkeySUIC, outpointKey) // nft:sell
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			mpkeyFU := "mp:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyFB := "mp:{fb" + strGenesisId + strCodeHash + "}"
-			mpkeyFS := "mp:{fs" + strAddressPkh + "}"
-
-			pipe.ZRem(ctx, mpkeyFU, outpointKey)                                                // ft:utxo
-			pipe.ZIncrBy(ctx, mpkeyFB, -float64(data.Data.FT.Amount), strAddressPkh)            // ft:balance
-			pipe.ZIncrBy(ctx, mpkeyFS, -float64(data.Data.FT.Amount), strCodeHash+strGenesisId) // ft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			mpkeyFU := "mp:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			pipe.ZRem(ctx, mpkeyFU, outpointKey) // ft:utxo
-		}
+		_, counterKeys := contract.RemoveUtxoIndexes(ctx, pipe, outpointKey, data, "mp:", "mp:", -1)
 
 		// 记录key以备删除
-		tokenToRemove[strGenesisId+strCodeHash] = struct{}{}
-		addrToRemove[strAddressPkh] = struct{}{}
+		for _, key := range counterKeys {
+			counterToClean[key] = struct{}{}
+		}
 	}
 
 	for outpointKey, data := range utxoToSpend {
+		// 未关注的地址、genesis，以及只索引token时的无关输出不记录索引
+		if !prune.IsTxoWatched(data.Data) {
+			continue
+		}
 		strAddressPkh := string(data.Data.AddressPkh[:])
-		strCodeHash := string(data.Data.CodeHash[:])
-		strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
 
 		// redis有序utxo数据添加
 		member := &redis.Z{Score: float64(data.BlockHeight)*1000000000 + float64(data.TxIdx), Member: outpointKey}
@@ -482,92 +317,19 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, needReset bool, utxoToRestore, utxo
 		mpkeys = append(mpkeys, mpkeyCB)
 
 		// redis有序genesis utxo数据添加
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			member.Score = float64(data.Data.NFT.TokenIndex)
-
-			mpkeyNU := "mp:s:{nu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyND := "mp:s:nd" + strCodeHash + strGenesisId
-			mpkeyNO := "mp:{no" + strGenesisId + strCodeHash + "}"
-			mpkeyNS := "mp:{ns" + strAddressPkh + "}"
-
-			mpkeys = append(mpkeys, mpkeyNU, mpkeyND, mpkeyNO, mpkeyNS)
-
-			pipe.ZAdd(ctx, mpkeyNU, member)                          // nft:utxo
-			pipe.ZAdd(ctx, mpkeyND, member)                          // nft:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNO, -1, strAddressPkh)            // nft:owners
-			pipe.ZIncrBy(ctx, mpkeyNS, -1, strCodeHash+strGenesisId) // nft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
-			mpkeyNAU := "mp:s:{nau" + strAddressPkh + "}" + strCodeHash
-			mpkeyNAD := "mp:s:nad" + strCodeHash + strGenesisId
-			mpkeyNAS := "mp:{nas" + strAddressPkh + "}"
-
-			mpkeys = append(mpkeys, mpkeyNAU, mpkeyNAD, mpkeyNAS)
-
-			pipe.ZAdd(ctx, mpkeyNAU, member)             // nft:auction:utxo
-			pipe.ZAdd(ctx, mpkeyNAD, member)             // nft:auction:utxo-detail
-			pipe.ZIncrBy(ctx, mpkeyNAS, -1, strCodeHash) // nft:auction:sender-summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			mpkeySUT := "mp:s:{sut}"
-			mpkeySUTA := "mp:s:{suta" + strAddressPkh + "}"
-			mpkeySUTC := "mp:s:{sutc" + strGenesisId + strCodeHash + "}"
-			mpkeySUP := "mp:s:{sup}"
-			mpkeySUPA := "mp:s:{supa" + strAddressPkh + "}"
-			mpkeySUPC := "mp:s:{supc" + strGenesisId + strCodeHash + "}"
-			mpkeySUI := "mp:s:{sui}"
-			mpkeySUIA := "mp:s:{suia" + strAddressPkh + "}"
-			mpkeySUIC := "mp:s:{suic" + strGenesisId + strCodeHash + "}"
-
-			mpkeys = append(mpkeys, mpkeySUT, mpkeySUTA, mpkeySUTC, mpkeySUP, mpkeySUPA, mpkeySUPC, mpkeySUI, mpkeySUIA, mpkeySUIC)
-
-			pipe.ZAdd(ctx, mpkeySUT, member)  // nft:sell:all:utxo, sort by time
-			pipe.ZAdd(ctx, mpkeySUTA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUTC, member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.Price)
-			pipe.ZAdd(ctx, mpkeySUP, member)  // nft:sell:all:utxo, sort by price
-			pipe.ZAdd(ctx, mpkeySUPA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUPC, member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.TokenIndex)
-			pipe.ZAdd(ctx, mpkeySUI, member)  // nft:sell:all:utxo, sort by token index
-			pipe.ZAdd(ctx, mpkeySUIA, member) // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, mpkeySUIC, member) // nft:sell
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			mpkeyFU := "mp:s:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			mpkeyFB := "mp:{fb" + strGenesisId + strCodeHash + "}"
-			mpkeyFS := "mp:{fs" + strAddressPkh + "}"
-
-			mpkeys = append(mpkeys, mpkeyFU, mpkeyFB, mpkeyFS)
-
-			pipe.ZAdd(ctx, mpkeyFU, member)                                                     // ft:utxo
-			pipe.ZIncrBy(ctx, mpkeyFB, -float64(data.Data.FT.Amount), strAddressPkh)            // ft:balance
-			pipe.ZIncrBy(ctx, mpkeyFS, -float64(data.Data.FT.Amount), strCodeHash+strGenesisId) // ft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			mpkeyFU := "mp:s:{fu" + strAddressPkh + "}" + strCodeHash + strGenesisId
-			pipe.ZAdd(ctx, mpkeyFU, member) // ft:utxo
-
-			mpkeys = append(mpkeys, mpkeyFU)
-		}
+		setKeys, counterKeys := contract.AddUtxoIndexes(ctx, pipe, outpointKey, data, member.Score, "mp:s:", "mp:", -1)
+		mpkeys = append(mpkeys, setKeys...)
+		mpkeys = append(mpkeys, counterKeys...)
 
 		// 记录key以备删除
-		tokenToRemove[strGenesisId+strCodeHash] = struct{}{}
-		addrToRemove[strAddressPkh] = struct{}{}
+		for _, key := range counterKeys {
+			counterToClean[key] = struct{}{}
+		}
 	}
 
-	// 删除summary 为0的记录
-	for codeKey := range tokenToRemove {
-		pipe.ZRemRangeByScore(ctx, "mp:{no"+codeKey+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "mp:{fb"+codeKey+"}", "0", "0")
-	}
-	// 删除balance 为0的记录
-	for addr := range addrToRemove {
-		pipe.ZRemRangeByScore(ctx, "mp:{ns"+addr+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "mp:{fs"+addr+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "mp:{nas"+addr+"}", "0", "0")
+	// 删除balance、summary 为0的记录
+	for key := range counterToClean {
+		pipe.ZRemRangeByScore(ctx, key, "0", "0")
 	}
 
 	// 记录所有的mp:keys，以备区块确认后直接删除重来
@@ -575,3 +337,51 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, needReset bool, utxoToRestore, utxo
 		pipe.SAdd(ctx, "mp:keys", mpkey)
 	}
 }
+
+// RemoveSpentUtxoInRedis 撤销内存池对已确认utxo的花费记录
+// 用于内存池tx被区块确认或因冲突失效后，清除mp:s:相关记录并恢复内存池余额变化
+func RemoveSpentUtxoInRedis(pipe redis.Pipeliner, utxoToUnspend map[string]*model.TxoData) {
+	logger.Log.Info("RemoveSpentUtxoInRedis", zap.Int("nUnspend", len(utxoToUnspend)))
+	if len(utxoToUnspend) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	pipe.HIncrBy(ctx, "info",
+		"utxo_total_mempool", int64(len(utxoToUnspend)),
+	)
+
+	counterToClean := make(map[string]struct{}, 1)
+	for outpointKey, data := range utxoToUnspend {
+		strAddressPkh := string(data.Data.AddressPkh[:])
+
+		if data.Data.CodeType == scriptDecoder.CodeType_NONE {
+			if !data.Data.HasAddress {
+				// 无法识别地址，未记录utxo
+				continue
+			}
+
+			// redis有序address utxo花费记录清除
+			pipe.ZRem(ctx, "mp:s:{au"+strAddressPkh+"}", outpointKey)
+
+			// balance of address
+			pipe.IncrBy(ctx, "mp:bl"+strAddressPkh, int64(data.Satoshi))
+			continue
+		}
+
+		// contract balance of address
+		pipe.IncrBy(ctx, "mp:cb"+strAddressPkh, int64(data.Satoshi))
+
+		// redis有序genesis utxo花费记录清除
+		_, counterKeys := contract.RemoveUtxoIndexes(ctx, pipe, outpointKey, data, "mp:s:", "mp:", 1)
+
+		for _, key := range counterKeys {
+			counterToClean[key] = struct{}{}
+		}
+	}
+
+	// 删除balance、summary 为0的记录
+	for key := range counterToClean {
+		pipe.ZRemRangeByScore(ctx, key, "0", "0")
+	}
+}
@@ -5,3 +5,126 @@ type BlockDO struct {
 	Height  uint32 `db:"height"`
 	BlockId []byte `db:"blkid"`
 }
+
+// SpentByTx utxo的花费tx
+type SpentByTx struct {
+	TxId   []byte `db:"txid"`
+	Height uint32 `db:"height"`
+}
+
+// TxoSpentDO 已确认花费的utxo
+type TxoSpentDO struct {
+	UTxid    []byte `db:"utxid"`
+	Vout     uint32 `db:"vout"`
+	TxId     []byte `db:"txid"`
+	Height   uint32 `db:"height"`
+	Address  []byte `db:"address"`
+	CodeHash []byte `db:"codehash"`
+	Genesis  []byte `db:"genesis"`
+	CodeType uint32 `db:"code_type"`
+}
+
+// DoubleSpend 内存池中发现的重复花费
+type DoubleSpend struct {
+	UTxid          []byte
+	Vout           uint32
+	AddressPkh     []byte
+	CodeHash       []byte
+	GenesisId      []byte
+	CodeType       uint32
+	TxId           []byte // 新发现的tx
+	ConflictTxId   []byte // 已花费该utxo的tx
+	ConflictHeight uint32 // 已花费tx的高度，内存池为MEMPOOL_HEIGHT
+	Timestamp      uint32
+}
+
+// FTHolderDO ft持有人余额快照
+type FTHolderDO struct {
+	Height     uint32 `db:"height"`
+	AddressPkh []byte `db:"address"`
+	Balance    uint64 `db:"balance"`
+}
+
+// NFTTransferDO nft转移记录
+type NFTTransferDO struct {
+	Height      uint32 `db:"height"`
+	TxIdx       uint64 `db:"txidx"`
+	TxId        []byte `db:"txid"`
+	Vout        uint32 `db:"vout"`
+	FromAddress []byte `db:"from_address"`
+	Address     []byte `db:"address"`
+	Operation   uint32 `db:"operation"`
+}
+
+// NFTSellStatsDO nft出售合约成交统计
+type NFTSellStatsDO struct {
+	Trades     uint64 `db:"trades"`
+	Volume     uint64 `db:"volume"`
+	MinPrice   uint64 `db:"min_price"`
+	MaxPrice   uint64 `db:"max_price"`
+	LastPrice  uint64 `db:"last_price"`
+	LastHeight uint32 `db:"last_height"`
+	FloorPrice uint64 // 当前挂单最低价，无挂单为0
+	Listings   int64  // 当前挂单数量
+}
+
+// SwapCandleDO swap池K线
+type SwapCandleDO struct {
+	Ts       uint32  `db:"ts"`
+	Open     float64 `db:"open"`
+	High     float64 `db:"high"`
+	Low      float64 `db:"low"`
+	Close    float64 `db:"close"`
+	Volume1  uint64  `db:"volume1"`
+	Volume2  uint64  `db:"volume2"`
+	Trades   uint64  `db:"trades"`
+	Reserve1 uint64  `db:"reserve1"`
+	Reserve2 uint64  `db:"reserve2"`
+	Lp       uint64  `db:"lp"`
+	TVL      uint64  // 收盘时锁定价值，以token1计
+}
+
+// TxOutScriptDO 输出锁定脚本
+type TxOutScriptDO struct {
+	PkScript []byte `db:"script_pk"`
+	Height   uint32 `db:"height"`
+}
+
+// RichListDO 地址BSV余额排行
+type RichListDO struct {
+	AddressPkh      []byte `db:"address"`
+	Balance         uint64 `db:"balance"`
+	ContractBalance uint64 `db:"contract_balance"`
+}
+
+// GenesisHolderDO ft/nft持有人排行
+type GenesisHolderDO struct {
+	AddressPkh []byte `db:"address"`
+	Balance    uint64 `db:"balance"`
+}
+
+// AddressStatsDO 地址汇总统计
+type AddressStatsDO struct {
+	Height    uint32 `db:"height"`
+	Addresses uint64 `db:"addresses"`
+	Utxos     uint64 `db:"utxos"`
+}
+
+// UtxoBucketDO 地址utxo数量分布
+type UtxoBucketDO struct {
+	Bucket    uint64 `db:"bucket"`
+	Addresses uint64 `db:"addresses"`
+}
+
+// ActiveAddressDO 每日活跃地址数量
+type ActiveAddressDO struct {
+	Day       string `db:"day"`
+	Addresses uint64 `db:"addresses"`
+}
+
+// AddressTxDO 地址参与的tx
+type AddressTxDO struct {
+	AddressPkh []byte `db:"address"`
+	Height     uint32 `db:"height"`
+	TxIdx      uint64 `db:"txidx"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"bytes"
+)
+
+// FTToken ft登记信息，以首次出现为准
+type FTToken struct {
+	CodeHash   []byte
+	GenesisId  []byte
+	SensibleId []byte // genesis tx outpoint, 旧版本为genesis
+	Name       string
+	Symbol     string
+	Decimal    uint8
+	IssuerPkh  []byte // 首次出现tx的第一个输入地址
+	Height     uint32
+	TxIdx      uint64
+	TxId       []byte
+	Verified   bool // 首次出现的tx花费了SensibleId指向的genesis输出
+	Copycat    bool // 名称、符号与更早登记的已验证ft相同
+}
+
+// GenesisTxId SensibleId中的genesis txid，旧版本无法得到则返回nil
+func (t *FTToken) GenesisTxId() []byte {
+	if len(t.SensibleId) != 36 {
+		return nil
+	}
+	return t.SensibleId[:32]
+}
+
+// FTTokenNameKey 用于识别仿冒ft
+func FTTokenNameKey(name, symbol string) string {
+	return name + "\x00" + symbol
+}
+
+// IsEmptySensibleId genesis合约输出尚未发行，SensibleId为空
+func IsEmptySensibleId(sensibleId []byte) bool {
+	return len(bytes.Trim(sensibleId, "\x00")) == 0
+}
+
+var (
+	GlobalFTTokenRegistry map[string]*FTToken // 已登记的全部ft，key: CodeHash+GenesisId，nil表示需要从db加载
+	GlobalFTTokenNames    map[string]string   // 名称、符号的最早已验证ft，key: FTTokenNameKey
+
+	GlobalNewFTTokenMap map[string]*FTToken // 当前批次区块内新登记的ft，key: CodeHash+GenesisId
+)
+
+// InitFTTokenRegistry 从已登记ft初始化内存登记表，tokens需按首次出现顺序排列
+func InitFTTokenRegistry(tokens []*FTToken) {
+	GlobalFTTokenRegistry = make(map[string]*FTToken, len(tokens))
+	GlobalFTTokenNames = make(map[string]string, 0)
+	for _, token := range tokens {
+		RegisterFTToken(token)
+	}
+}
+
+// RegisterFTToken 登记ft，并判断是否仿冒
+func RegisterFTToken(token *FTToken) {
+	key := string(token.CodeHash) + string(token.GenesisId)
+	nameKey := FTTokenNameKey(token.Name, token.Symbol)
+	if owner, ok := GlobalFTTokenNames[nameKey]; ok && owner != key {
+		token.Copycat = true
+	} else if token.Verified {
+		GlobalFTTokenNames[nameKey] = key
+	}
+	GlobalFTTokenRegistry[key] = token
+}
@@ -11,6 +11,18 @@ import (
 
 const MEMPOOL_HEIGHT = 4294967295
 
+// nft转移类型
+const (
+	NFT_OP_MINT           = 0
+	NFT_OP_TRANSFER       = 1
+	NFT_OP_SELL_LIST      = 2
+	NFT_OP_SELL_CANCEL    = 3
+	NFT_OP_SOLD           = 4
+	NFT_OP_AUCTION_LIST   = 5
+	NFT_OP_AUCTION_SETTLE = 6
+	NFT_OP_AUCTION_CANCEL = 7
+)
+
 var FALSE_OP_RETURN []byte = []byte("\x00\x6a")
 
 type Tx struct {
@@ -27,6 +39,7 @@ type Tx struct {
 	TxIns        TxIns
 	TxOuts       TxOuts
 	IsSensible   bool
+	IsIndexed    bool // 只索引token时，tx涉及sensible合约或关注地址
 }
 
 type TxIn struct {
@@ -130,12 +143,20 @@ type TokenData struct {
 	GenesisId    []byte
 	NFTIdx       uint64 // nft tokenIndex
 	Decimal      uint8  // ft decimal
-	InDataValue  uint64 // ft / nft count
-	OutDataValue uint64 // ft / nft count
+	InDataValue  uint64 // ft amount / nft count
+	OutDataValue uint64 // ft amount / nft count
 	InSatoshi    uint64
 	OutSatoshi   uint64
 }
 
+// FTSupplyData ft增发和销毁数量
+type FTSupplyData struct {
+	CodeHash  []byte
+	GenesisId []byte
+	Minted    uint64
+	Burned    uint64
+}
+
 type TxData struct {
 	Raw  []byte
 	TxId []byte // 32
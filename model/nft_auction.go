@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+// nft拍卖状态变化
+const (
+	NFT_AUCTION_CREATED   = 0
+	NFT_AUCTION_BID       = 1
+	NFT_AUCTION_OUTBID    = 2 // 前一个出价人被超越
+	NFT_AUCTION_SETTLED   = 3
+	NFT_AUCTION_CANCELLED = 4
+)
+
+var emptyAddressPkh [20]byte
+
+// NFTAuctionEvent nft拍卖状态变化记录
+type NFTAuctionEvent struct {
+	AuctionId    []byte // 拍卖合约SensibleId, 36 bytes
+	CodeHash     []byte // 拍卖合约codehash
+	NFTCodeHash  []byte
+	NFTID        []byte
+	Event        uint32
+	SenderPkh    []byte
+	BidderPkh    []byte // 出价人/成交人，OUTBID为被超越的出价人
+	Price        uint64 // 出价/成交价
+	EndTimestamp uint64
+	Vout         uint32 // 拍卖合约输出位置，结束时为0
+	Height       uint32
+	TxId         []byte
+}
+
+func newNFTAuctionEvent(data *scriptDecoder.TxoData, event uint32, vout int) *NFTAuctionEvent {
+	auction := data.NFTAuction
+	return &NFTAuctionEvent{
+		AuctionId:    auction.SensibleId[:],
+		CodeHash:     data.CodeHash[:],
+		NFTCodeHash:  auction.NFTCodeHash[:],
+		NFTID:        auction.NFTID[:],
+		Event:        event,
+		SenderPkh:    auction.SenderAddressPkh[:],
+		BidderPkh:    auction.BidderAddressPkh[:],
+		Price:        auction.BidBsvPrice,
+		EndTimestamp: auction.EndTimestamp,
+		Vout:         uint32(vout),
+	}
+}
+
+func hasAuctionBid(auction *scriptDecoder.NFTAuctionData) bool {
+	return auction.BidBsvPrice > 0 && auction.BidderAddressPkh != emptyAddressPkh
+}
+
+// ParseNFTAuctionEvents 比较tx花费和产生的拍卖合约utxo，得到拍卖状态变化
+// getSpentTxo 返回tx输入所花费的utxo信息，未知则返回nil
+func ParseNFTAuctionEvents(tx *Tx, getSpentTxo func(outpointKey string) *TxoData) (events []*NFTAuctionEvent) {
+	auctionIn := make(map[string]*scriptDecoder.TxoData, 0)
+	for _, input := range tx.TxIns {
+		objData := getSpentTxo(input.InputOutpointKey)
+		if objData == nil || objData.Data.CodeType != scriptDecoder.CodeType_NFT_AUCTION {
+			continue
+		}
+		auctionIn[string(objData.Data.NFTAuction.SensibleId[:])] = objData.Data
+	}
+
+	auctionOut := make(map[string]struct{}, 0)
+	for vout, output := range tx.TxOuts {
+		if output.Data.CodeType != scriptDecoder.CodeType_NFT_AUCTION {
+			continue
+		}
+		auction := output.Data.NFTAuction
+		auctionOut[string(auction.SensibleId[:])] = struct{}{}
+
+		in, ok := auctionIn[string(auction.SensibleId[:])]
+		if !ok {
+			events = append(events, newNFTAuctionEvent(output.Data, NFT_AUCTION_CREATED, vout))
+			continue
+		}
+		if !hasAuctionBid(auction) ||
+			(in.NFTAuction.BidBsvPrice == auction.BidBsvPrice && bytes.Equal(in.NFTAuction.BidderAddressPkh[:], auction.BidderAddressPkh[:])) {
+			continue
+		}
+		if hasAuctionBid(in.NFTAuction) {
+			events = append(events, newNFTAuctionEvent(in, NFT_AUCTION_OUTBID, vout))
+		}
+		events = append(events, newNFTAuctionEvent(output.Data, NFT_AUCTION_BID, vout))
+	}
+
+	// 拍卖合约被花费且没有延续，有出价则成交，否则为取消
+	for _, input := range tx.TxIns {
+		objData := getSpentTxo(input.InputOutpointKey)
+		if objData == nil || objData.Data.CodeType != scriptDecoder.CodeType_NFT_AUCTION {
+			continue
+		}
+		auctionId := string(objData.Data.NFTAuction.SensibleId[:])
+		if _, ok := auctionOut[auctionId]; ok {
+			continue
+		}
+		auctionOut[auctionId] = struct{}{}
+		in := auctionIn[auctionId]
+		if hasAuctionBid(in.NFTAuction) {
+			events = append(events, newNFTAuctionEvent(in, NFT_AUCTION_SETTLED, 0))
+		} else {
+			events = append(events, newNFTAuctionEvent(in, NFT_AUCTION_CANCELLED, 0))
+		}
+	}
+	return events
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+// swap操作类型
+const (
+	SWAP_OP_SELL   = 0
+	SWAP_OP_BUY    = 1
+	SWAP_OP_ADD    = 2
+	SWAP_OP_REMOVE = 3
+)
+
+// SwapCandlePeriods K线周期，秒
+var SwapCandlePeriods = []uint32{60, 3600, 86400}
+
+// SwapCandle swap池在一段时间内的价格、成交量，以及收盘时的储备
+type SwapCandle struct {
+	CodeHash  []byte
+	GenesisId []byte
+	Open      float64 // 价格为token1/token2
+	High      float64
+	Low       float64
+	Close     float64
+	Volume1   uint64 // token1成交量，仅统计买卖
+	Volume2   uint64
+	Trades    uint32
+	Reserve1  uint64
+	Reserve2  uint64
+	Lp        uint64
+	Height    uint32
+	TxIdx     uint64 // 收盘tx
+	TxId      []byte
+}
+
+// ParseSwapTx 查找tx花费和产生的swap池合约，并判断操作类型，不是swap tx则返回nil
+// getSpentTxo 返回tx输入所花费的utxo信息，未知则返回nil
+func ParseSwapTx(tx *Tx, getSpentTxo func(outpointKey string) *TxoData) (swapIn, swapOut *scriptDecoder.TxoData, operation int) {
+	for _, input := range tx.TxIns {
+		objData := getSpentTxo(input.InputOutpointKey)
+		if objData == nil {
+			continue
+		}
+		if objData.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
+			if objData.Data.Uniq.Swap != nil {
+				swapIn = objData.Data
+				break
+			}
+		}
+	}
+	if swapIn == nil {
+		return nil, nil, 0
+	}
+
+	for _, output := range tx.TxOuts {
+		if output.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
+			if output.Data.Uniq.Swap != nil {
+				swapOut = output.Data
+				break
+			}
+		}
+	}
+	if swapOut == nil {
+		return nil, nil, 0
+	}
+
+	operation = SWAP_OP_SELL
+	if swapIn.Uniq.Swap.Token1Amount < swapOut.Uniq.Swap.Token1Amount {
+		if swapIn.Uniq.Swap.Token2Amount < swapOut.Uniq.Swap.Token2Amount {
+			operation = SWAP_OP_ADD
+		} else {
+			operation = SWAP_OP_BUY
+		}
+	} else {
+		if swapIn.Uniq.Swap.Token2Amount < swapOut.Uniq.Swap.Token2Amount {
+			operation = SWAP_OP_SELL
+		} else {
+			operation = SWAP_OP_REMOVE
+		}
+	}
+	return swapIn, swapOut, operation
+}
+
+// SwapPrice swap池价格，token1/token2
+func SwapPrice(swap *scriptDecoder.SwapData) float64 {
+	if swap.Token2Amount == 0 {
+		return 0
+	}
+	return float64(swap.Token1Amount) / float64(swap.Token2Amount)
+}
+
+func absDiff(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// NewSwapCandle 以swap tx开始新的K线，开盘价为tx之前的池价格
+func NewSwapCandle(swapIn, swapOut *scriptDecoder.TxoData) *SwapCandle {
+	open := SwapPrice(swapIn.Uniq.Swap)
+	return &SwapCandle{
+		CodeHash:  swapOut.CodeHash[:],
+		GenesisId: swapOut.GenesisId[:swapOut.GenesisIdLen],
+		Open:      open,
+		High:      open,
+		Low:       open,
+		Close:     open,
+	}
+}
+
+// AddSwap 将swap tx计入K线
+func (c *SwapCandle) AddSwap(swapIn, swapOut *scriptDecoder.TxoData, operation int, txIdx uint64, txId []byte) {
+	price := SwapPrice(swapOut.Uniq.Swap)
+	if price > c.High {
+		c.High = price
+	}
+	if price < c.Low {
+		c.Low = price
+	}
+	c.Close = price
+
+	if operation == SWAP_OP_SELL || operation == SWAP_OP_BUY {
+		c.Volume1 += absDiff(swapIn.Uniq.Swap.Token1Amount, swapOut.Uniq.Swap.Token1Amount)
+		c.Volume2 += absDiff(swapIn.Uniq.Swap.Token2Amount, swapOut.Uniq.Swap.Token2Amount)
+		c.Trades++
+	}
+	c.Reserve1 = swapOut.Uniq.Swap.Token1Amount
+	c.Reserve2 = swapOut.Uniq.Swap.Token2Amount
+	c.Lp = swapOut.Uniq.Swap.LpAmount
+	c.TxIdx = txIdx
+	c.TxId = txId
+}
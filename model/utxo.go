@@ -10,8 +10,16 @@ var (
 	GlobalConfirmedTxMap    map[string]struct{}
 	GlobalConfirmedTxOldMap map[string]struct{}
 
-	GlobalNewUtxoDataMap   map[string]*TxoData
-	GlobalSpentUtxoDataMap map[string]*TxoData
+	GlobalConfirmedSpentUtxoMap map[string]*SpentByTx // 最近确认区块内所有tx花费的utxo，用于识别内存池冲突tx
+
+	GlobalNewUtxoDataMap   *UtxoCache // 当前批次区块产生、尚未花费的utxo
+	GlobalSpentUtxoDataMap *UtxoCache // 当前批次区块花费的、之前批次产生的utxo
+
+	GlobalFTSupplyMap map[string]*FTSupplyData // 当前批次区块内ft增发和销毁数量，key: CodeHash+GenesisId
+
+	GlobalNFTAuctionMap map[string]*NFTAuctionEvent // 当前批次区块内各拍卖的最新状态，key: AuctionId
+
+	GlobalSwapReserveMap map[string]*SwapCandle // 当前批次区块内各swap池的最新储备，key: CodeHash+GenesisId
 
 	GlobalMempoolNewUtxoDataMap map[string]*TxoData
 )
@@ -31,6 +39,7 @@ func CleanConfirmedTxMap(force bool) {
 	if force {
 		GlobalConfirmedTxMap = nil
 		GlobalConfirmedTxMap = make(map[string]struct{}, 0)
+		GlobalConfirmedSpentUtxoMap = make(map[string]*SpentByTx, 0)
 	} else if cleanTimes < 10 {
 		cleanTimes++
 		return
@@ -41,16 +50,23 @@ func CleanConfirmedTxMap(force bool) {
 	runtime.GC()
 	GlobalConfirmedTxOldMap = GlobalConfirmedTxMap
 	GlobalConfirmedTxMap = make(map[string]struct{}, 0)
+	GlobalConfirmedSpentUtxoMap = make(map[string]*SpentByTx, 0)
 }
 
 // 清空本地map内存
 func CleanUtxoMap() {
-	GlobalNewUtxoDataMap = nil
-	GlobalSpentUtxoDataMap = nil
+	if GlobalNewUtxoDataMap != nil {
+		GlobalNewUtxoDataMap.Close()
+		GlobalSpentUtxoDataMap.Close()
+	}
 	runtime.GC()
 
-	GlobalNewUtxoDataMap = make(map[string]*TxoData, 0)
-	GlobalSpentUtxoDataMap = make(map[string]*TxoData, 0)
+	GlobalNewUtxoDataMap = NewUtxoCache("new")
+	GlobalSpentUtxoDataMap = NewUtxoCache("spent")
+	GlobalFTSupplyMap = make(map[string]*FTSupplyData, 0)
+	GlobalNFTAuctionMap = make(map[string]*NFTAuctionEvent, 0)
+	GlobalSwapReserveMap = make(map[string]*SwapCandle, 0)
+	GlobalNewFTTokenMap = make(map[string]*FTToken, 0)
 }
 
 // 清空本地map内存
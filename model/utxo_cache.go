@@ -0,0 +1,254 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	// 估算每个utxo在内存中的额外占用(TxoData、解码数据、map)
+	utxoEntryOverhead = 256
+
+	// 提交已溢出到磁盘的utxo缓存时，每次处理的utxo数量
+	UtxoCacheChunkSize = 1000000
+)
+
+var (
+	UtxoCacheMemBytes int                   // 每个utxo缓存的内存预算，超过后将较早的utxo溢出到磁盘，0为不限制
+	UtxoCachePath     string = "utxo_cache" // 溢出到磁盘的utxo存放目录，只在一个批次内有效
+)
+
+// UtxoCache 当前批次的utxo缓存。内存占用超过预算时，将区块高度较早的utxo溢出到磁盘，
+// 较新的utxo更可能很快被花费，保留在内存中。非并发安全，与原有的map使用方式相同
+type UtxoCache struct {
+	name        string
+	mem         map[string]*TxoData
+	memBytes    int
+	heightKeys  map[uint32][]string // 内存中各高度的utxo，溢出时按高度选取，无需遍历整个map。已删除的key在溢出时跳过
+	heightBytes map[uint32]int      // 内存中各高度utxo的内存占用
+	db          *leveldb.DB         // 首次溢出时打开
+	diskLen     int
+}
+
+func NewUtxoCache(name string) *UtxoCache {
+	return &UtxoCache{
+		name:        name,
+		mem:         make(map[string]*TxoData, 0),
+		heightKeys:  make(map[uint32][]string, 0),
+		heightBytes: make(map[uint32]int, 0),
+	}
+}
+
+func utxoEntrySize(outpointKey string, data *TxoData) int {
+	return len(outpointKey) + len(data.PkScript) + utxoEntryOverhead
+}
+
+// Len utxo数量，包括已溢出到磁盘的
+func (c *UtxoCache) Len() int {
+	return len(c.mem) + c.diskLen
+}
+
+// IsSpilled 是否有utxo已溢出到磁盘
+func (c *UtxoCache) IsSpilled() bool {
+	return c.diskLen > 0
+}
+
+func (c *UtxoCache) Get(outpointKey string) (data *TxoData, ok bool) {
+	if data, ok = c.mem[outpointKey]; ok || c.db == nil {
+		return data, ok
+	}
+	buf, err := c.db.Get([]byte(outpointKey), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false
+	} else if err != nil {
+		panic(err)
+	}
+	return decodeSpilledUtxo(buf), true
+}
+
+// removeMem 从内存中删除utxo，更新内存占用
+func (c *UtxoCache) removeMem(outpointKey string, data *TxoData) {
+	size := utxoEntrySize(outpointKey, data)
+	c.memBytes -= size
+	c.heightBytes[data.BlockHeight] -= size
+	if c.heightBytes[data.BlockHeight] <= 0 {
+		// 该高度已没有utxo，剩余的key都已删除
+		delete(c.heightBytes, data.BlockHeight)
+		delete(c.heightKeys, data.BlockHeight)
+	}
+	delete(c.mem, outpointKey)
+}
+
+func (c *UtxoCache) Set(outpointKey string, data *TxoData) {
+	old, ok := c.mem[outpointKey]
+	if ok {
+		c.removeMem(outpointKey, old)
+	}
+	if !ok || old.BlockHeight != data.BlockHeight || c.heightKeys[data.BlockHeight] == nil {
+		c.heightKeys[data.BlockHeight] = append(c.heightKeys[data.BlockHeight], outpointKey)
+	}
+	size := utxoEntrySize(outpointKey, data)
+	c.mem[outpointKey] = data
+	c.memBytes += size
+	c.heightBytes[data.BlockHeight] += size
+
+	if UtxoCacheMemBytes > 0 && c.memBytes > UtxoCacheMemBytes {
+		c.spill()
+	}
+}
+
+func (c *UtxoCache) Delete(outpointKey string) {
+	if data, ok := c.mem[outpointKey]; ok {
+		c.removeMem(outpointKey, data)
+		return
+	}
+	if c.db == nil {
+		return
+	}
+	key := []byte(outpointKey)
+	if ok, err := c.db.Has(key, nil); err != nil {
+		panic(err)
+	} else if !ok {
+		return
+	}
+	if err := c.db.Delete(key, nil); err != nil {
+		panic(err)
+	}
+	c.diskLen--
+}
+
+// Range 遍历所有utxo，包括已溢出到磁盘的，fn返回false则停止
+func (c *UtxoCache) Range(fn func(outpointKey string, data *TxoData) bool) {
+	for outpointKey, data := range c.mem {
+		if !fn(outpointKey, data) {
+			return
+		}
+	}
+	if c.db == nil {
+		return
+	}
+	iter := c.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !fn(string(iter.Key()), decodeSpilledUtxo(iter.Value())) {
+			return
+		}
+	}
+	if err := iter.Error(); err != nil {
+		panic(err)
+	}
+}
+
+// Close 清空缓存，删除磁盘数据
+func (c *UtxoCache) Close() {
+	c.mem = nil
+	c.memBytes = 0
+	c.heightKeys = nil
+	c.heightBytes = nil
+	if c.db != nil {
+		c.db.Close()
+		c.db = nil
+		os.RemoveAll(filepath.Join(UtxoCachePath, c.name))
+	}
+	c.diskLen = 0
+}
+
+// spill 按高度从低到高溢出utxo到磁盘，直到内存占用降到预算的3/4以下。较新的utxo保留在内存中
+func (c *UtxoCache) spill() {
+	if c.db == nil {
+		path := filepath.Join(UtxoCachePath, c.name)
+		// 上次运行残留的数据已无效
+		os.RemoveAll(path)
+		db, err := leveldb.OpenFile(path, &opt.Options{
+			Filter:      filter.NewBloomFilter(10),
+			WriteBuffer: 64 * opt.MiB,
+		})
+		if err != nil {
+			panic(err)
+		}
+		c.db = db
+	}
+
+	heights := make([]uint32, 0, len(c.heightBytes))
+	for height := range c.heightBytes {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	buf := make([]byte, 0)
+	for _, height := range heights {
+		if c.memBytes <= UtxoCacheMemBytes*3/4 {
+			break
+		}
+		batch := new(leveldb.Batch)
+		for _, outpointKey := range c.heightKeys[height] {
+			data, ok := c.mem[outpointKey]
+			if !ok || data.BlockHeight != height {
+				continue
+			}
+			if need := 36 + 20 + len(data.PkScript); cap(buf) < need {
+				buf = make([]byte, need)
+			}
+			length := data.Marshal(buf[:cap(buf)])
+			batch.Put([]byte(outpointKey), buf[:length])
+
+			c.removeMem(outpointKey, data)
+			c.diskLen++
+		}
+		if err := c.db.Write(batch, nil); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// decodeSpilledUtxo 与从redis读取utxo相同，需要重新解码锁定脚本
+func decodeSpilledUtxo(buf []byte) *TxoData {
+	d := &TxoData{}
+	d.Unmarshal(append([]byte{}, buf...))
+	d.ScriptType = scriptDecoder.GetLockingScriptType(d.PkScript)
+	d.Data = scriptDecoder.ExtractPkScriptForTxo(d.PkScript, d.ScriptType)
+	return d
+}
+
+// RangeUtxoChunks 分块遍历新增和花费的utxo，每块最多chunkSize个，新增的utxo在前，fn返回false则停止。
+// 都未溢出到磁盘时直接使用内存中的map，只调用一次fn
+func RangeUtxoChunks(newCache, spentCache *UtxoCache, chunkSize int, fn func(utxoToRestore, utxoToRemove map[string]*TxoData) bool) bool {
+	if !newCache.IsSpilled() && !spentCache.IsSpilled() {
+		return fn(newCache.mem, spentCache.mem)
+	}
+
+	empty := make(map[string]*TxoData, 0)
+	for idx, cache := range []*UtxoCache{newCache, spentCache} {
+		isNew := idx == 0
+		isOK := true
+		chunk := make(map[string]*TxoData, chunkSize)
+		flush := func() {
+			if isNew {
+				isOK = fn(chunk, empty)
+			} else {
+				isOK = fn(empty, chunk)
+			}
+			chunk = make(map[string]*TxoData, chunkSize)
+		}
+		cache.Range(func(outpointKey string, data *TxoData) bool {
+			chunk[outpointKey] = data
+			if len(chunk) >= chunkSize {
+				flush()
+			}
+			return isOK
+		})
+		if isOK && len(chunk) > 0 {
+			flush()
+		}
+		if !isOK {
+			return false
+		}
+	}
+	return true
+}
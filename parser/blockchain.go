@@ -179,7 +179,7 @@ func (bc *Blockchain) ParseLongestChainBlockStart(blocksDone chan struct{}, bloc
 			// 当串行执行到某个区块时，一定运行完毕了之前区块的所有任务和本区块的预处理任务
 			task.ParseBlockSerialStart(withMempool, block)
 			// block speed
-			utilsTask.ParseBlockSpeed(len(block.Txs), len(model.GlobalNewUtxoDataMap), len(model.GlobalSpentUtxoDataMap),
+			utilsTask.ParseBlockSpeed(len(block.Txs), model.GlobalNewUtxoDataMap.Len(), model.GlobalSpentUtxoDataMap.Len(),
 				block.Height, maxBlockHeight, block.FileIdx)
 
 			blocksStage <- block
@@ -278,7 +278,7 @@ func (bc *Blockchain) LoadAllBlockHeaders() {
 		}(rawblock, bc.BlockData.LastFileId, bc.BlockData.LastOffset)
 
 		// header speed
-		utilsTask.ParseBlockSpeed(0, len(model.GlobalNewUtxoDataMap), len(model.GlobalSpentUtxoDataMap), idx, 0, bc.BlockData.CurrentId)
+		utilsTask.ParseBlockSpeed(0, model.GlobalNewUtxoDataMap.Len(), model.GlobalSpentUtxoDataMap.Len(), idx, 0, bc.BlockData.CurrentId)
 	}
 	wg.Wait()
 }
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"bytes"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+	"sensibled/task"
+	"sensibled/utils"
+
+	"go.uber.org/zap"
+)
+
+// BackfillWatchedAddresses 只索引token时，新关注地址之前的无关tx未写入db。
+// 从blk文件按顺序重新扫描已同步的主链区块，补全涉及这些地址的tx、txin、txout
+func (bc *Blockchain) BackfillWatchedAddresses(addresses []string) bool {
+	commonHeight, _, _ := bc.GetBlockSyncCommonBlockHeight(-1)
+	if commonHeight < 0 {
+		logger.Log.Error("watch backfill, less blocks on disk")
+		return false
+	}
+	logger.Log.Info("watch backfill start",
+		zap.Int("nAddress", len(addresses)),
+		zap.Int("endHeight", commonHeight))
+
+	if !store.PrepareWatchBackfillCk() {
+		return false
+	}
+
+	addressMap := make(map[string]struct{}, len(addresses))
+	for _, strAddressPkh := range addresses {
+		addressMap[strAddressPkh] = struct{}{}
+	}
+	txos := make(map[string]*model.TxoData)
+	for height := 0; height <= commonHeight; height++ {
+		if model.NeedStop {
+			return false
+		}
+		chainBlock, ok := bc.BlocksOfChainByHeight[height]
+		if !ok {
+			logger.Log.Error("watch backfill, block not found", zap.Int("height", height))
+			return false
+		}
+
+		bc.BlockData.SkipTo(chainBlock.FileIdx, chainBlock.FileOffset)
+		rawblock, err := bc.BlockData.GetRawBlock()
+		if err != nil {
+			logger.Log.Error("get block error", zap.Error(err))
+			return false
+		}
+		if len(rawblock) < 80+9 { // block header + txn
+			continue
+		}
+
+		block := &model.Block{
+			FileIdx:    chainBlock.FileIdx,
+			FileOffset: chainBlock.FileOffset,
+			Height:     height,
+		}
+		InitBlock(block, rawblock)
+		if !bytes.Equal(chainBlock.Hash, block.Hash) {
+			logger.Log.Error("blkId not match hash(rawblk)",
+				zap.Int("height", height),
+				zap.String("blkId", utils.HashString(chainBlock.Hash)),
+				zap.String("blkHash", block.HashHex))
+			return false
+		}
+		block.Txs = NewTxs(bc.BlockData.StripMode, block.Raw[80:])
+		block.Raw = nil
+
+		task.BackfillWatchedBlock(block, addressMap, txos)
+
+		if height%10000 == 0 {
+			logger.Log.Info("watch backfill",
+				zap.Int("height", height),
+				zap.Int("nTxo", len(txos)))
+		}
+	}
+
+	if !store.CommitWatchBackfillCk() {
+		logger.Log.Error("watch backfill commit failed")
+		return false
+	}
+	logger.Log.Info("watch backfill finished")
+	return true
+}
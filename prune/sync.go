@@ -2,7 +2,9 @@ package prune
 
 import (
 	"fmt"
+	"sensibled/model"
 
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
 	"github.com/spf13/viper"
 )
 
@@ -12,6 +14,7 @@ var (
 	IsScriptSigPrune bool
 	IsOpReturnPrune  bool
 	IsHistoryPrune   bool
+	IsTokenOnly      bool
 )
 
 func Init() {
@@ -38,4 +41,28 @@ func Init() {
 	IsOpReturnPrune = viper.GetBool("opreturn")
 
 	IsHistoryPrune = viper.GetBool("history")
+
+	// 只索引涉及sensible合约或关注地址的tx，其余tx不写入db，utxo仍完整记录
+	IsTokenOnly = viper.GetBool("token_only")
+
+	// 地址关注列表
+	initWatchList()
+}
+
+// IsTxoIndexed 只索引token时，输出是sensible合约输出或属于关注地址
+func IsTxoIndexed(data *scriptDecoder.TxoData) bool {
+	if data.CodeType != scriptDecoder.CodeType_NONE {
+		return true
+	}
+	return IsWatchMode && data.HasAddress && watchList.IsAddressWatched(string(data.AddressPkh[:]))
+}
+
+// IsTxOutputsIndexed 只索引token时，tx有sensible合约输出或关注地址的输出
+func IsTxOutputsIndexed(tx *model.Tx) bool {
+	for _, output := range tx.TxOuts {
+		if IsTxoIndexed(output.Data) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,279 @@
+package prune
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/rdb"
+	"sensibled/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	// 设置关注列表后，地址相关的索引只为关注的地址和token genesis写入
+	IsWatchMode bool
+
+	watchFile           string
+	watchRedisKey       string
+	watchReloadInterval time.Duration
+
+	// 当前生效的关注列表，只在区块、内存池数据提交后切换
+	watchList *WatchList
+
+	// 重新加载后尚未生效的关注列表
+	pendingWatchList *WatchList
+	pendingMutex     sync.Mutex
+)
+
+// WatchItem 关注列表的一项，地址或token genesis
+type WatchItem struct {
+	Entry   string // 配置的原文
+	Address string // 20字节pkh
+	Genesis string // 20/36/40字节genesis
+}
+
+// WatchList 关注列表
+type WatchList struct {
+	Items     []WatchItem // 按Entry排序
+	Addresses map[string]struct{}
+	Genesis   map[string]struct{}
+}
+
+// NewWatchList 解析关注列表，地址为base58，genesis为hex
+func NewWatchList(entries []string) (*WatchList, error) {
+	w := &WatchList{
+		Addresses: make(map[string]struct{}),
+		Genesis:   make(map[string]struct{}),
+	}
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if _, ok := seen[entry]; ok {
+			continue
+		}
+		seen[entry] = struct{}{}
+		item := WatchItem{Entry: entry}
+		if decoded, err := utils.DecodeAddress(entry); err == nil && len(decoded) == 20 {
+			item.Address = string(decoded)
+			w.Addresses[item.Address] = struct{}{}
+		} else if decoded, err := hex.DecodeString(entry); err == nil && (len(decoded) == 20 || len(decoded) == 36 || len(decoded) == 40) {
+			item.Genesis = string(decoded)
+			w.Genesis[item.Genesis] = struct{}{}
+		} else {
+			return nil, fmt.Errorf("invalid watch entry: %s", entry)
+		}
+		w.Items = append(w.Items, item)
+	}
+	sort.Slice(w.Items, func(i, j int) bool {
+		return w.Items[i].Entry < w.Items[j].Entry
+	})
+	return w, nil
+}
+
+// Equal 两个关注列表是否一致
+func (w *WatchList) Equal(other *WatchList) bool {
+	if len(w.Items) != len(other.Items) {
+		return false
+	}
+	for idx, item := range w.Items {
+		if item.Entry != other.Items[idx].Entry {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply 将部分地址、genesis的关注状态更新为target中的状态，返回更新后的列表，以及新增、移除的项。
+// 关注列表变化时分批生效，每批之后的列表作为下一批的起点
+func (w *WatchList) Apply(target *WatchList, addresses, genesis []string) (applied *WatchList, added, removed []WatchItem) {
+	changed := make(map[string]struct{}, len(addresses)+len(genesis))
+	for _, key := range addresses {
+		changed["a"+key] = struct{}{}
+	}
+	for _, key := range genesis {
+		changed["g"+key] = struct{}{}
+	}
+	isChanged := func(item WatchItem) bool {
+		key := "g" + item.Genesis
+		if item.Address != "" {
+			key = "a" + item.Address
+		}
+		_, ok := changed[key]
+		return ok
+	}
+
+	applied = &WatchList{
+		Addresses: make(map[string]struct{}),
+		Genesis:   make(map[string]struct{}),
+	}
+	for _, item := range w.Items {
+		if isChanged(item) {
+			removed = append(removed, item)
+		} else {
+			applied.Items = append(applied.Items, item)
+		}
+	}
+	for _, item := range target.Items {
+		if isChanged(item) {
+			added = append(added, item)
+			applied.Items = append(applied.Items, item)
+		}
+	}
+	sort.Slice(applied.Items, func(i, j int) bool {
+		return applied.Items[i].Entry < applied.Items[j].Entry
+	})
+	for _, item := range applied.Items {
+		if item.Address != "" {
+			applied.Addresses[item.Address] = struct{}{}
+		} else {
+			applied.Genesis[item.Genesis] = struct{}{}
+		}
+	}
+	return applied, added, removed
+}
+
+// IsAddressWatched 地址是否被关注
+func (w *WatchList) IsAddressWatched(strAddressPkh string) bool {
+	_, ok := w.Addresses[strAddressPkh]
+	return ok
+}
+
+// IsTxoWatched 输出地址被关注，或为关注genesis的token输出
+func (w *WatchList) IsTxoWatched(data *scriptDecoder.TxoData) bool {
+	if data.HasAddress && w.IsAddressWatched(string(data.AddressPkh[:])) {
+		return true
+	}
+	if data.CodeType == scriptDecoder.CodeType_NONE || data.GenesisIdLen == 0 {
+		return false
+	}
+	_, ok := w.Genesis[string(data.GenesisId[:data.GenesisIdLen])]
+	return ok
+}
+
+// IsAddressWatched 未设置关注列表时所有地址都被关注
+func IsAddressWatched(strAddressPkh string) bool {
+	return !IsWatchMode || watchList.IsAddressWatched(strAddressPkh)
+}
+
+// IsTxoWatched 是否需要为输出写入地址相关的索引，未设置关注列表时都需要。
+// 只索引token时，无关输出也不写入
+func IsTxoWatched(data *scriptDecoder.TxoData) bool {
+	if IsTokenOnly && !IsTxoIndexed(data) {
+		return false
+	}
+	return !IsWatchMode || watchList.IsTxoWatched(data)
+}
+
+// GetWatchList 当前生效的关注列表
+func GetWatchList() *WatchList {
+	return watchList
+}
+
+// SetWatchList 切换生效的关注列表，需在区块、内存池数据提交后执行
+func SetWatchList(w *WatchList) {
+	watchList = w
+}
+
+// TakePendingWatchList 取出重新加载后有变化的关注列表，无变化则返回nil
+func TakePendingWatchList() *WatchList {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	w := pendingWatchList
+	pendingWatchList = nil
+	return w
+}
+
+// IsWatchListPending 是否有尚未生效的关注列表
+func IsWatchListPending() bool {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	return pendingWatchList != nil
+}
+
+func initWatchList() {
+	// 关注列表文件，每行一个地址或genesis
+	watchFile = viper.GetString("watch_file")
+	// 或者redis(rdb_balance)中的集合
+	watchRedisKey = viper.GetString("watch_redis_key")
+	viper.SetDefault("watch_reload_interval", time.Minute)
+	watchReloadInterval = viper.GetDuration("watch_reload_interval")
+
+	IsWatchMode = watchFile != "" || watchRedisKey != ""
+	if !IsWatchMode {
+		return
+	}
+	w, err := loadWatchList()
+	if err != nil {
+		panic(fmt.Errorf("Fatal error watch list: %s \n", err))
+	}
+	watchList = w
+}
+
+func loadWatchList() (*WatchList, error) {
+	var entries []string
+	if watchFile != "" {
+		f, err := os.Open(watchFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			entries = append(entries, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if watchRedisKey != "" {
+		members, err := rdb.RdbBalanceClient.SMembers(context.Background(), watchRedisKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, members...)
+	}
+	return NewWatchList(entries)
+}
+
+// StartWatchListReloader 定期重新加载关注列表，有变化时等待同步流程切换
+func StartWatchListReloader() {
+	if !IsWatchMode || watchReloadInterval <= 0 {
+		return
+	}
+	go func() {
+		latest := watchList
+		for {
+			time.Sleep(watchReloadInterval)
+			if model.NeedStop {
+				return
+			}
+			w, err := loadWatchList()
+			if err != nil {
+				logger.Log.Error("reload watch list failed", zap.Error(err))
+				continue
+			}
+			if w.Equal(latest) {
+				continue
+			}
+			logger.Log.Info("watch list changed", zap.Int("nItems", len(w.Items)))
+			latest = w
+			pendingMutex.Lock()
+			pendingWatchList = w
+			pendingMutex.Unlock()
+		}
+	}()
+}
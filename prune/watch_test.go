@@ -0,0 +1,77 @@
+package prune
+
+import (
+	"bytes"
+	"sensibled/utils"
+	"testing"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+func testWatchList(t *testing.T, entries ...string) *WatchList {
+	t.Helper()
+	w, err := NewWatchList(entries)
+	if err != nil {
+		t.Fatalf("new watch list: %v", err)
+	}
+	return w
+}
+
+func TestWatchListApplyBatches(t *testing.T) {
+	pkhA := bytes.Repeat([]byte{1}, 20)
+	pkhB := bytes.Repeat([]byte{2}, 20)
+	addrA := utils.EncodeAddress(pkhA, 0)
+	addrB := utils.EncodeAddress(pkhB, 0)
+	genesisOld := "0303030303030303030303030303030303030303"
+	genesisNew := "0404040404040404040404040404040404040404"
+
+	applied := testWatchList(t, addrB, genesisOld)
+	target := testWatchList(t, addrA, genesisNew)
+
+	// 地址A的token输出，genesis同时新关注，分在两个批次
+	txo := &scriptDecoder.TxoData{CodeType: scriptDecoder.CodeType_FT, HasAddress: true, GenesisIdLen: 20}
+	copy(txo.AddressPkh[:], pkhA)
+	copy(txo.GenesisId[:], bytes.Repeat([]byte{4}, 20))
+
+	next, added, removed := applied.Apply(target, []string{string(pkhA), string(pkhB)}, nil)
+	if len(added) != 1 || added[0].Entry != addrA || len(removed) != 1 || removed[0].Entry != addrB {
+		t.Fatalf("batch 1 added %v removed %v", added, removed)
+	}
+	if applied.IsTxoWatched(txo) || !next.IsTxoWatched(txo) {
+		t.Fatal("batch 1 should start watching txo")
+	}
+	if !next.IsAddressWatched(string(pkhA)) || next.IsAddressWatched(string(pkhB)) {
+		t.Fatal("batch 1 addresses not applied")
+	}
+
+	genesis := []string{string(bytes.Repeat([]byte{3}, 20)), string(bytes.Repeat([]byte{4}, 20))}
+	last, added, removed := next.Apply(target, nil, genesis)
+	if len(added) != 1 || added[0].Entry != genesisNew || len(removed) != 1 || removed[0].Entry != genesisOld {
+		t.Fatalf("batch 2 added %v removed %v", added, removed)
+	}
+	// 第一批已处理的utxo，第二批不再处理
+	if !next.IsTxoWatched(txo) || !last.IsTxoWatched(txo) {
+		t.Fatal("batch 2 should not change txo")
+	}
+	if !last.Equal(target) {
+		t.Fatal("applied list not equal to target after all batches")
+	}
+}
+
+func TestIsTxoWatchedTokenOnly(t *testing.T) {
+	isTokenOnly, isWatchMode := IsTokenOnly, IsWatchMode
+	defer func() { IsTokenOnly, IsWatchMode = isTokenOnly, isWatchMode }()
+	IsTokenOnly, IsWatchMode = true, false
+
+	// 只索引token时，普通输出不写入地址索引
+	plain := &scriptDecoder.TxoData{HasAddress: true}
+	ft := &scriptDecoder.TxoData{CodeType: scriptDecoder.CodeType_FT, HasAddress: true, GenesisIdLen: 20}
+	if IsTxoWatched(plain) || !IsTxoWatched(ft) {
+		t.Fatal("token only should index only token outputs")
+	}
+
+	IsTokenOnly = false
+	if !IsTxoWatched(plain) {
+		t.Fatal("all outputs should be indexed without token only")
+	}
+}
@@ -65,9 +65,12 @@ func FlushdbInRedis() {
 			return master.FlushDB(ctx).Err()
 		})
 		// todo: pika cluster flushdb
+		if _, ok := UtxoDB.(*localUtxoStore); ok && err == nil {
+			err = UtxoDB.Flush()
+		}
 	} else {
 		err = RdbBalanceClient.FlushDB(ctx).Err()
-		err = RdbUtxoClient.FlushDB(ctx).Err()
+		err = UtxoDB.Flush()
 		err = RdbAddrTxClient.FlushDB(ctx).Err()
 	}
 
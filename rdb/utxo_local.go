@@ -0,0 +1,99 @@
+package rdb
+
+import (
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// localUtxoStore utxo存储在本地leveldb，key为outpoint。单机部署时无需pika，查询没有网络往返
+type localUtxoStore struct {
+	path  string
+	mutex sync.RWMutex // Flush时需重新打开db
+	db    *leveldb.DB
+}
+
+func openLocalUtxoDB(path string) *leveldb.DB {
+	db, err := leveldb.OpenFile(path, &opt.Options{
+		Filter:             filter.NewBloomFilter(10),
+		BlockCacheCapacity: 256 * opt.MiB,
+		WriteBuffer:        64 * opt.MiB,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openLocalUtxoStore(path string) *localUtxoStore {
+	return &localUtxoStore{
+		path: path,
+		db:   openLocalUtxoDB(path),
+	}
+}
+
+func (s *localUtxoStore) Get(outpointKeys []string) (map[string][]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make(map[string][]byte, len(outpointKeys))
+	for _, outpointKey := range outpointKeys {
+		buf, err := s.db.Get([]byte(outpointKey), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[outpointKey] = buf
+	}
+	return result, nil
+}
+
+func (s *localUtxoStore) Exists(outpointKeys []string) (map[string]struct{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make(map[string]struct{}, len(outpointKeys))
+	for _, outpointKey := range outpointKeys {
+		ok, err := s.db.Has([]byte(outpointKey), nil)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result[outpointKey] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+// Update 删除和写入在同一个batch中原子提交
+func (s *localUtxoStore) Update(utxoToRemove []string, utxoToStore map[string][]byte) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	batch := new(leveldb.Batch)
+	for _, outpointKey := range utxoToRemove {
+		batch.Delete([]byte(outpointKey))
+	}
+	for outpointKey, buf := range utxoToStore {
+		batch.Put([]byte(outpointKey), buf)
+	}
+	return s.db.Write(batch, nil)
+}
+
+func (s *localUtxoStore) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.path); err != nil {
+		return err
+	}
+	s.db = openLocalUtxoDB(s.path)
+	return nil
+}
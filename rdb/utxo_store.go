@@ -0,0 +1,131 @@
+package rdb
+
+import (
+	"fmt"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+// UtxoStore 全局utxo存储，保存所有未花费的utxo，key为outpoint，value为TxoData.Marshal编码
+type UtxoStore interface {
+	// Get 批量查询utxo，不存在的outpoint不在结果中
+	Get(outpointKeys []string) (map[string][]byte, error)
+	// Exists 批量检查utxo是否存在，返回存在的outpoint
+	Exists(outpointKeys []string) (map[string]struct{}, error)
+	// Update 批量删除和写入utxo，先删除后写入
+	Update(utxoToRemove []string, utxoToStore map[string][]byte) error
+	// Flush 清空所有utxo
+	Flush() error
+}
+
+var UtxoDB UtxoStore
+
+// InitUtxoStore 按配置文件的store选择utxo存储：pika(默认)或local(本地嵌入式存储)
+func InitUtxoStore(filename string) {
+	viper.SetConfigFile(filename)
+	if err := viper.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+
+	if viper.GetString("store") == "local" {
+		viper.SetDefault("path", "utxo_db")
+		UtxoDB = openLocalUtxoStore(viper.GetString("path"))
+		return
+	}
+	RdbUtxoClient = Init(filename)
+	UtxoDB = &pikaUtxoStore{rds: RdbUtxoClient}
+}
+
+// pikaUtxoStore utxo存储在pika，key为"u"+outpoint
+type pikaUtxoStore struct {
+	rds redis.UniversalClient
+}
+
+// 每个pipeline的最大命令数
+const pikaSliceLen = 512
+
+func (s *pikaUtxoStore) Get(outpointKeys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(outpointKeys))
+	if len(outpointKeys) == 0 {
+		return result, nil
+	}
+	pipe := s.rds.Pipeline()
+	cmds := make(map[string]*redis.StringCmd, len(outpointKeys))
+	for _, outpointKey := range outpointKeys {
+		cmds[outpointKey] = pipe.Get(ctx, "u"+outpointKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for outpointKey, cmd := range cmds {
+		res, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[outpointKey] = res
+	}
+	return result, nil
+}
+
+func (s *pikaUtxoStore) Exists(outpointKeys []string) (map[string]struct{}, error) {
+	result := make(map[string]struct{}, len(outpointKeys))
+	if len(outpointKeys) == 0 {
+		return result, nil
+	}
+	pipe := s.rds.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(outpointKeys))
+	for _, outpointKey := range outpointKeys {
+		cmds[outpointKey] = pipe.Exists(ctx, "u"+outpointKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for outpointKey, cmd := range cmds {
+		if cmd.Val() > 0 {
+			result[outpointKey] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+func (s *pikaUtxoStore) Update(utxoToRemove []string, utxoToStore map[string][]byte) error {
+	// delete batch
+	for idx := 0; idx < len(utxoToRemove); idx += pikaSliceLen {
+		end := idx + pikaSliceLen
+		if end > len(utxoToRemove) {
+			end = len(utxoToRemove)
+		}
+		pikaPipe := s.rds.Pipeline()
+		for _, outpointKey := range utxoToRemove[idx:end] {
+			// redis全局utxo数据清除
+			pikaPipe.Del(ctx, "u"+outpointKey)
+		}
+		if _, err := pikaPipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	// add batch
+	n := 0
+	pikaPipe := s.rds.Pipeline()
+	for outpointKey, buf := range utxoToStore {
+		// redis全局utxo数据添加，以便关联后续花费的input，无论是否识别地址都需要记录
+		pikaPipe.Set(ctx, "u"+outpointKey, buf, 0)
+		n++
+		if n%pikaSliceLen != 0 && n != len(utxoToStore) {
+			continue
+		}
+		if _, err := pikaPipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+		pikaPipe = s.rds.Pipeline()
+	}
+	return nil
+}
+
+func (s *pikaUtxoStore) Flush() error {
+	return s.rds.FlushDB(ctx).Err()
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"strings"
+	"sync"
+	"time"
+
+	ch "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const batchSendRetry = 3
+
+var insertColumnsRe = regexp.MustCompile(`(?i)^INSERT INTO (\S+) \(([^)]+)\)`)
+
+// BatchWriter 按原生协议批量写入一个数据表，缓存行数达到clickhouse.BatchRows即发送，内存占用有上限。
+// 每次发送附带由高度范围生成的insert_deduplication_token，发送失败重试时不会重复插入
+type BatchWriter struct {
+	table     string
+	query     string
+	columns   []string
+	heightIdx int // height列在参数中的位置，没有则为-1
+
+	mutex     sync.Mutex
+	rows      [][]interface{}
+	minHeight uint32
+	maxHeight uint32
+	seq       int
+	err       error // 发送失败的行已丢弃，提交时需报告失败
+}
+
+// NewBatchWriter 创建写入器，query为带列名的INSERT语句
+func NewBatchWriter(query string) *BatchWriter {
+	w := &BatchWriter{
+		query:     query,
+		heightIdx: -1,
+	}
+	if match := insertColumnsRe.FindStringSubmatch(query); match != nil {
+		w.table = match[1]
+		for idx, column := range strings.Split(match[2], ",") {
+			column = strings.TrimSpace(column)
+			if column == "height" {
+				w.heightIdx = idx
+			}
+			w.columns = append(w.columns, column)
+		}
+	}
+	return w
+}
+
+// Exec 追加一行，参数顺序与INSERT语句的列一致，可并发调用
+func (w *BatchWriter) Exec(args ...interface{}) (sql.Result, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.heightIdx >= 0 && w.heightIdx < len(args) {
+		if height, ok := args[w.heightIdx].(uint32); ok {
+			if len(w.rows) == 0 || height < w.minHeight {
+				w.minHeight = height
+			}
+			if len(w.rows) == 0 || height > w.maxHeight {
+				w.maxHeight = height
+			}
+		}
+	}
+	w.rows = append(w.rows, args)
+	if len(w.rows) < clickhouse.BatchRows {
+		return driver.RowsAffected(1), nil
+	}
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// Flush 发送已缓存的行，返回本批次中任一次发送的失败
+func (w *BatchWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.err
+}
+
+func (w *BatchWriter) flush() (err error) {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	// 同一表、同一高度范围的第seq次发送，重试时token不变
+	token := fmt.Sprintf("%s-%d-%d-%d", w.table, w.minHeight, w.maxHeight, w.seq)
+	ctx := ch.Context(context.Background(), ch.WithSettings(ch.Settings{
+		"insert_deduplication_token": token,
+	}))
+	for retry := 0; retry < batchSendRetry; retry++ {
+		if err = w.send(ctx); err == nil {
+			break
+		}
+		logger.Log.Info("batch send failed",
+			zap.String("token", token), zap.Int("retry", retry), zap.Error(err))
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		logger.Log.Error("batch send failed",
+			zap.String("token", token), zap.Int("rows", len(w.rows)), zap.Error(err))
+		w.err = err
+	}
+	w.rows = nil
+	w.seq++
+	return err
+}
+
+func (w *BatchWriter) send(ctx context.Context) error {
+	if clickhouse.IsPostgres {
+		return w.sendPg()
+	}
+	batch, err := clickhouse.Native.PrepareBatch(ctx, w.query)
+	if err != nil {
+		return err
+	}
+	for _, row := range w.rows {
+		if err := batch.Append(row...); err != nil {
+			batch.Abort()
+			return err
+		}
+	}
+	return batch.Send()
+}
+
+// sendPg 使用COPY写入PostgreSQL，写入前创建所需的高度分区。在一个事务内写入，失败重试时不会重复插入
+func (w *BatchWriter) sendPg() error {
+	if w.heightIdx >= 0 && pgPartitionedTables[w.table] {
+		if err := ensurePartitionsPg(clickhouse.CK, w.table, int64(w.minHeight), int64(w.maxHeight)); err != nil {
+			return err
+		}
+	}
+
+	tx, err := clickhouse.CK.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(pq.CopyIn(w.table, w.columns...))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, row := range w.rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		tx.Rollback()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
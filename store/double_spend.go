@@ -0,0 +1,19 @@
+package store
+
+// SqlCreateDoubleSpendTable 内存池中发现的重复花费记录，按被花费的outpoint排序、索引
+// 同一冲突可能被重复发现，按(utxid, vout, txid, conflict_txid)去重，保留最新记录
+const SqlCreateDoubleSpendTable string = `
+CREATE TABLE IF NOT EXISTS double_spend (
+	utxid           FixedString(32),
+	vout            UInt32,
+	address         String,
+	codehash        String,
+	genesis         String,
+	code_type       UInt32,      -- 0: none, 1: ft, 2: unique, 3: nft
+	txid            FixedString(32),
+	conflict_txid   FixedString(32),
+	conflict_height UInt32,      -- 4294967295: mempool
+	timestamp       UInt32
+) engine=ReplacingMergeTree(timestamp)
+ORDER BY (utxid, vout, txid, conflict_txid)
+`
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+)
+
+const (
+	// 导出文件按高度分段，与数据表分区intDiv(height, 2100)一致
+	exportPartitionBlocks = 2100
+	// 分段的最后一个区块距离最新区块超过此深度才导出，之后不会再重组
+	exportSafeDepth = 100
+)
+
+// exportTable 导出的数据集，列与同步写入数据表的INSERT语句一致
+type exportTable struct {
+	name    string
+	table   string
+	pattern string
+	orderBy string
+}
+
+var (
+	exportTables = []exportTable{
+		{"blk", "blk_height", sqlBlkPattern, "height"},
+		{"tx", "blktx_height", sqlTxPattern, "height, txidx"},
+		{"txin", "txin", sqlTxInPattern, "height, txidx, idx"},
+		{"txout", "txout", sqlTxOutPattern, "height, utxidx, vout"},
+		{"contract", "blktx_contract_height", sqlTxContractPattern, "height, txidx"},
+	}
+
+	fixedStringRe = regexp.MustCompile(`^FixedString\(\d+\)$`)
+)
+
+func (t *exportTable) columns() string {
+	match := insertColumnsRe.FindStringSubmatch(fmt.Sprintf(t.pattern, t.table))
+	return match[2]
+}
+
+func (t *exportTable) partitionFile(dir string, partition int) string {
+	return filepath.Join(dir, t.name, fmt.Sprintf("%s-%05d.parquet", t.name, partition))
+}
+
+// parquetSchema clickhouse列类型对应的parquet列定义
+func parquetSchema(name, chType string) (string, error) {
+	switch {
+	case chType == "UInt8" || chType == "UInt16" || chType == "UInt32":
+		return fmt.Sprintf("name=%s, type=INT32, convertedtype=UINT_%s", name, chType[4:]), nil
+	case chType == "UInt64":
+		return fmt.Sprintf("name=%s, type=INT64, convertedtype=UINT_64", name), nil
+	case chType == "Int32":
+		return fmt.Sprintf("name=%s, type=INT32", name), nil
+	case chType == "Int64":
+		return fmt.Sprintf("name=%s, type=INT64", name), nil
+	case chType == "Float64":
+		return fmt.Sprintf("name=%s, type=DOUBLE", name), nil
+	case chType == "String" || fixedStringRe.MatchString(chType):
+		// 数据多为二进制，不标记为UTF8
+		return fmt.Sprintf("name=%s, type=BYTE_ARRAY", name), nil
+	}
+	return "", fmt.Errorf("unsupported column type %s: %s", name, chType)
+}
+
+// parquetValue clickhouse读取的值转换为parquet写入的类型，无符号整数按位保存
+func parquetValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case uint8:
+		return int32(v)
+	case uint16:
+		return int32(v)
+	case uint32:
+		return int32(v)
+	case uint64:
+		return int64(v)
+	}
+	return v
+}
+
+// exportPartitionCk 导出一个分段，先写入临时文件，完成后改名，中断后重新导出
+func exportPartitionCk(t *exportTable, dir string, partition int) error {
+	psql := fmt.Sprintf("SELECT %s FROM %s WHERE height >= %d AND height < %d AND %s ORDER BY %s",
+		t.columns(), t.table, partition*exportPartitionBlocks, (partition+1)*exportPartitionBlocks, SqlNotOrphan, t.orderBy)
+	rows, err := clickhouse.Native.Query(context.Background(), psql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columnTypes := rows.ColumnTypes()
+	md := make([]string, len(columnTypes))
+	vars := make([]interface{}, len(columnTypes))
+	for idx, ct := range columnTypes {
+		if md[idx], err = parquetSchema(ct.Name(), ct.DatabaseTypeName()); err != nil {
+			return err
+		}
+		vars[idx] = reflect.New(ct.ScanType()).Interface()
+	}
+
+	filename := t.partitionFile(dir, partition)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	tmpFilename := filename + ".tmp"
+	f, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilename)
+	defer f.Close()
+
+	buf := bufio.NewWriterSize(f, 4*1024*1024)
+	pw, err := writer.NewCSVWriterFromWriter(md, buf, 4)
+	if err != nil {
+		return err
+	}
+	nRows := 0
+	for rows.Next() {
+		if err := rows.Scan(vars...); err != nil {
+			return err
+		}
+		rec := make([]interface{}, len(vars))
+		for idx, v := range vars {
+			rec[idx] = parquetValue(reflect.ValueOf(v).Elem().Interface())
+		}
+		if err := pw.Write(rec); err != nil {
+			return err
+		}
+		nRows++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := pw.WriteStop(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return err
+	}
+	logger.Log.Info("export done", zap.String("file", filename), zap.Int("rows", nRows))
+	return nil
+}
+
+// ExportParquetCk 按高度分段导出区块、交易、输入、输出、合约数据到dir目录的parquet文件，
+// 每个数据集一个子目录，每个分段一个文件。已导出的分段跳过，可中断后继续，或定期执行增量导出。
+// 只导出[startHeight, endHeight)内已完整且不会再重组的分段，endHeight<0则不限制
+func ExportParquetCk(dir string, startHeight, endHeight int) bool {
+	if clickhouse.IsPostgres {
+		logger.Log.Error("export not supported on postgres")
+		return false
+	}
+	var (
+		nBlocks   uint64
+		maxHeight uint32
+	)
+	psql := "SELECT count(), max(height) FROM blk_height WHERE " + SqlNotOrphan
+	if _, err := clickhouse.ScanOne2(psql, []interface{}{&nBlocks, &maxHeight}); err != nil {
+		logger.Log.Error("query latest height failed", zap.Error(err))
+		return false
+	}
+	if nBlocks == 0 {
+		logger.Log.Info("export nothing, no block")
+		return true
+	}
+
+	safeHeight := int(maxHeight) + 1 - exportSafeDepth
+	if endHeight < 0 || endHeight > safeHeight {
+		endHeight = safeHeight
+	}
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	startPartition := startHeight / exportPartitionBlocks
+	endPartition := endHeight / exportPartitionBlocks // 不包括
+	logger.Log.Info("export parquet",
+		zap.String("dir", dir),
+		zap.Int("from", startPartition*exportPartitionBlocks),
+		zap.Int("to", endPartition*exportPartitionBlocks))
+
+	for idx := range exportTables {
+		t := &exportTables[idx]
+		for partition := startPartition; partition < endPartition; partition++ {
+			if _, err := os.Stat(t.partitionFile(dir, partition)); err == nil {
+				continue
+			}
+			if err := exportPartitionCk(t, dir, partition); err != nil {
+				logger.Log.Error("export failed",
+					zap.String("table", t.name), zap.Int("partition", partition), zap.Error(err))
+				return false
+			}
+		}
+	}
+	return true
+}
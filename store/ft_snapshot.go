@@ -0,0 +1,66 @@
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+
+	"go.uber.org/zap"
+)
+
+const sqlFTSnapshotPattern string = "INSERT INTO ft_holder_snapshot (height, codehash, genesis, address, balance, blkid) VALUES (?, ?, ?, ?, ?, ?)"
+
+// SaveFTSnapshotCk 保存ft在指定高度的持有人余额快照，记录主链区块blkid，重复保存同一区块会先删除旧快照
+func SaveFTSnapshotCk(codeHash, genesisId []byte, height int, holders map[string]uint64) bool {
+	if !ProcessSyncCk([]string{sqlCreateFTSnapshotTable}) {
+		return false
+	}
+	blkIdHex, ok := mainBlkIdCk(height)
+	if !ok {
+		return false
+	}
+	if !ProcessSyncCk([]string{
+		fmt.Sprintf("ALTER TABLE ft_holder_snapshot DELETE WHERE codehash = unhex('%s') AND genesis = unhex('%s') AND height = %d AND blkid = unhex('%s')",
+			hex.EncodeToString(codeHash), hex.EncodeToString(genesisId), height, blkIdHex),
+	}) {
+		return false
+	}
+	blkId, _ := hex.DecodeString(blkIdHex)
+
+	if clickhouse.IsPostgres {
+		if err := ensurePartitionsPg(clickhouse.CK, "ft_holder_snapshot", int64(height), int64(height)); err != nil {
+			logger.Log.Error("sync-partition-ft-snapshot", zap.Error(err))
+			return false
+		}
+	}
+
+	tx, err := clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync-begin-ft-snapshot", zap.Error(err))
+		return false
+	}
+	stmt, err := tx.Prepare(clickhouse.Rebind(sqlFTSnapshotPattern))
+	if err != nil {
+		logger.Log.Error("sync-prepare-ft-snapshot", zap.Error(err))
+		return false
+	}
+	for strAddressPkh, balance := range holders {
+		if _, err := stmt.Exec(
+			uint32(height),
+			string(codeHash),
+			string(genesisId),
+			strAddressPkh,
+			balance,
+			string(blkId),
+		); err != nil {
+			logger.Log.Error("sync-exec-ft-snapshot", zap.Error(err))
+			return false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("sync-commit-ft-snapshot", zap.Error(err))
+		return false
+	}
+	return true
+}
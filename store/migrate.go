@@ -0,0 +1,427 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+
+	"go.uber.org/zap"
+)
+
+// 数据库结构版本记录，每执行一个迁移插入一行，当前版本为最大version
+const sqlCreateSchemaVersionTable string = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version      UInt32,
+	name         String,
+	applied_at   DateTime DEFAULT now()
+) engine=MergeTree()
+ORDER BY version
+`
+
+// Migration 数据库结构升级，按Version顺序执行，只能追加，不能修改已发布的迁移
+type Migration struct {
+	Version int
+	Name    string
+	SQLs    []string
+}
+
+var migrations = []Migration{
+	{
+		// 引入版本记录之前的数据库结构
+		Version: 1,
+		Name:    "baseline",
+	},
+	{
+		// 后续增加的派生数据表，旧数据库在部分同步时才会创建
+		// 建表语句为该版本时的结构，之后的结构变化由后续迁移完成
+		Version: 2,
+		Name:    "derived tables",
+		SQLs: []string{
+			`
+CREATE TABLE IF NOT EXISTS blk_ft_supply_height (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	minted       UInt64,
+	burned       UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, txidx)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS ft_holder_snapshot (
+	height       UInt32,
+	codehash     String,
+	genesis      String,
+	address      String,
+	balance      UInt64
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, address)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS ft_token (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	sensibleid   String,
+	name         String,
+	symbol       String,
+	decimal      UInt8,
+	issuer       String,
+	verified     UInt8,       -- 首次出现的tx花费了sensibleid指向的genesis输出
+	copycat      UInt8,       -- 名称、符号与更早登记的已验证ft相同
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS nft_transfer_height (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	vout         UInt32,
+	codehash     String,
+	genesis      String,
+	token_idx    UInt64,
+	from_address String,
+	address      String,
+	operation    UInt32,      -- 0: mint, 1: transfer, 2: sell list, 3: sell cancel, 4: sold, 5: auction list, 6: auction settle, 7: auction cancel
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, token_idx, height, txidx)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS nft_sell_trade (
+	height       UInt32,
+	blocktime    UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	token_idx    UInt64,
+	seller       String,
+	buyer        String,
+	price        UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, txidx)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS nft_auction_event (
+	height        UInt32,
+	blocktime     UInt32,
+	txidx         UInt64,
+	txid          FixedString(32),
+	idx           UInt32,
+	auction_id    String,
+	codehash      String,
+	nft_codehash  String,
+	nft_id        String,
+	event         UInt32,      -- 0: created, 1: bid, 2: outbid, 3: settled, 4: cancelled
+	sender        String,
+	bidder        String,
+	price         UInt64,
+	end_timestamp UInt64,
+	vout          UInt32,
+	blkid         FixedString(32)
+) engine=MergeTree()
+ORDER BY (auction_id, height, txidx, idx)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS swap_candle (
+	height       UInt32,
+	period       UInt32,      -- 60: 1m, 3600: 1h, 86400: 1d
+	ts           UInt32,      -- 周期开始时间
+	codehash     String,
+	genesis      String,
+	open         Float64,     -- 价格为token1/token2
+	high         Float64,
+	low          Float64,
+	close        Float64,
+	volume1      UInt64,      -- token1成交量
+	volume2      UInt64,      -- token2成交量
+	trades       UInt32,
+	reserve1     UInt64,      -- 收盘时token1储备
+	reserve2     UInt64,
+	lp           UInt64,
+	txidx        UInt64,      -- 收盘tx
+	txid         FixedString(32),
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, period, ts, height, txidx)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS stat_rich_list (
+	height           UInt32,
+	address          String,
+	balance          UInt64,
+	contract_balance UInt64
+) engine=MergeTree()
+ORDER BY (height, address)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS stat_genesis_holder (
+	height       UInt32,
+	codehash     String,
+	genesis      String,
+	code_type    UInt32,
+	address      String,
+	balance      UInt64
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, address)
+PARTITION BY intDiv(height, 2100)
+`,
+			`
+CREATE TABLE IF NOT EXISTS stat_address (
+	height       UInt32,
+	addresses    UInt64,
+	utxos        UInt64
+) engine=MergeTree()
+ORDER BY height
+`,
+			`
+CREATE TABLE IF NOT EXISTS stat_utxo_distribution (
+	height       UInt32,
+	bucket       UInt64,
+	addresses    UInt64
+) engine=MergeTree()
+ORDER BY (height, bucket)
+`,
+			`
+CREATE TABLE IF NOT EXISTS stat_active_address (
+	height       UInt32,
+	day          Date,
+	addresses    UInt64
+) engine=MergeTree()
+ORDER BY (day, height)
+`,
+		},
+	},
+	{
+		// tx_height增加txidx，已有数据为0
+		Version: 3,
+		Name:    "tx_height txidx",
+		SQLs: []string{
+			"ALTER TABLE tx_height ADD COLUMN IF NOT EXISTS txidx UInt64",
+		},
+	},
+	{
+		// 区块重组时只记录孤块，不再删除数据。已有数据的blkid为空，视为主链
+		Version: 4,
+		Name:    "orphan blocks",
+		SQLs: []string{
+			`
+CREATE TABLE IF NOT EXISTS blk_orphan (
+	height       UInt32,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY height
+`,
+			"ALTER TABLE blktx_height ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txin ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txout ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+		},
+	},
+	{
+		// 批量写入按insert_deduplication_token去重，非复制表需要开启去重窗口
+		Version: 5,
+		Name:    "insert deduplication",
+		SQLs: []string{
+			"ALTER TABLE blk_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE blk_codehash_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE blktx_contract_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE blktx_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE txout MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE txin MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE blk_ft_supply_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE ft_token MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE nft_transfer_height MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE nft_sell_trade MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE nft_auction_event MODIFY SETTING non_replicated_deduplication_window = 1000",
+			"ALTER TABLE swap_candle MODIFY SETTING non_replicated_deduplication_window = 1000",
+		},
+	},
+	{
+		// 部分同步记录已完成的步骤，中断后可继续
+		Version: 6,
+		Name:    "part sync steps",
+		SQLs: []string{
+			`
+CREATE TABLE IF NOT EXISTS sync_part_step (
+	batch        String,
+	step         UInt32,      -- 0: 已处理复活的孤块，之后为partSteps的序号
+	done_at      DateTime DEFAULT now()
+) engine=MergeTree()
+ORDER BY (batch, step)
+TTL done_at + INTERVAL 30 DAY
+`,
+		},
+	},
+	{
+		// 重复花费记录改为按冲突去重，不再按月分区。旧表可能不存在，先按旧结构创建再复制。
+		// EXCHANGE TABLES需要Atomic数据库引擎(clickhouse 20.10之后的默认引擎)
+		Version: 7,
+		Name:    "double spend dedup",
+		SQLs: []string{
+			`
+CREATE TABLE IF NOT EXISTS double_spend (
+	utxid           FixedString(32),
+	vout            UInt32,
+	address         String,
+	codehash        String,
+	genesis         String,
+	code_type       UInt32,
+	txid            FixedString(32),
+	conflict_txid   FixedString(32),
+	conflict_height UInt32,
+	timestamp       UInt32
+) engine=MergeTree()
+ORDER BY (utxid, vout)
+PARTITION BY toYYYYMM(toDateTime(timestamp))
+`,
+			"DROP TABLE IF EXISTS double_spend_new",
+			`
+CREATE TABLE IF NOT EXISTS double_spend_new (
+	utxid           FixedString(32),
+	vout            UInt32,
+	address         String,
+	codehash        String,
+	genesis         String,
+	code_type       UInt32,
+	txid            FixedString(32),
+	conflict_txid   FixedString(32),
+	conflict_height UInt32,
+	timestamp       UInt32
+) engine=ReplacingMergeTree(timestamp)
+ORDER BY (utxid, vout, txid, conflict_txid)
+`,
+			"INSERT INTO double_spend_new SELECT * FROM double_spend",
+			// 原子交换后再删除旧表，任何一步中断，double_spend都保留完整的记录，重新执行时从它复制
+			"EXCHANGE TABLES double_spend_new AND double_spend",
+			"DROP TABLE IF EXISTS double_spend_new",
+		},
+	},
+	{
+		// 孤块标记改为只插入，重新成为主链时插入sign=-1，不再删除。
+		// 高度索引、统计、快照数据表增加blkid，查询时排除孤块。已有的行blkid为空，
+		// 此前区块重组时孤块数据会被删除，空blkid的行都属于主链，不需要按源表重建
+		Version: 8,
+		Name:    "orphan blkid",
+		SQLs: []string{
+			"ALTER TABLE blk_orphan ADD COLUMN IF NOT EXISTS sign Int32 DEFAULT 1",
+			"ALTER TABLE ft_holder_snapshot ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE stat_rich_list ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE stat_genesis_holder ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE stat_address ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE stat_utxo_distribution ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE stat_active_address ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE tx_height ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txin_spent ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txout_spent_height ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txin_genesis_height ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+			"ALTER TABLE txout_genesis_height ADD COLUMN IF NOT EXISTS blkid FixedString(32)",
+		},
+	},
+}
+
+// SchemaVersion 当前程序需要的数据库结构版本
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// GetSchemaVersionCk 数据库当前结构版本，没有版本记录返回0
+func GetSchemaVersionCk() (version int, err error) {
+	if !ProcessSyncCk([]string{sqlCreateSchemaVersionTable}) {
+		return 0, errors.New("create schema_version table failed")
+	}
+	psql := "SELECT max(version) FROM schema_version"
+	if clickhouse.IsPostgres {
+		psql = "SELECT coalesce(max(version), 0) FROM schema_version"
+	}
+	var maxVersion uint32
+	if _, err := clickhouse.ScanOne2(psql, &maxVersion); err != nil {
+		return 0, err
+	}
+	return int(maxVersion), nil
+}
+
+func setSchemaVersionCk(m *Migration) bool {
+	psql := fmt.Sprintf("INSERT INTO schema_version (version, name) VALUES (%d, '%s')", m.Version, m.Name)
+	if _, err := clickhouse.CK.Exec(psql); err != nil {
+		logger.Log.Error("set schema version failed", zap.Int("version", m.Version), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// CheckSchemaVersionCk 启动时检查数据库结构版本，不一致则拒绝同步
+func CheckSchemaVersionCk() bool {
+	version, err := GetSchemaVersionCk()
+	if err != nil {
+		logger.Log.Error("get schema version failed", zap.Error(err))
+		return false
+	}
+	if version < SchemaVersion() {
+		logger.Log.Error("schema outdated, run `sensibled migrate` first",
+			zap.Int("version", version), zap.Int("need", SchemaVersion()))
+		return false
+	}
+	if version > SchemaVersion() {
+		logger.Log.Error("schema newer than program, upgrade sensibled",
+			zap.Int("version", version), zap.Int("need", SchemaVersion()))
+		return false
+	}
+	return true
+}
+
+// MigrateCk 依次执行未执行的迁移
+func MigrateCk() bool {
+	if clickhouse.IsPostgres {
+		// PostgreSQL数据表由全量同步创建，已是最新结构
+		logger.Log.Error("migrate not supported on postgres, run full sync with -full")
+		return false
+	}
+	version, err := GetSchemaVersionCk()
+	if err != nil {
+		logger.Log.Error("get schema version failed", zap.Error(err))
+		return false
+	}
+	logger.Log.Info("migrate", zap.Int("from", version), zap.Int("to", SchemaVersion()))
+
+	for idx := range migrations {
+		m := &migrations[idx]
+		if m.Version <= version {
+			continue
+		}
+		logger.Log.Info(fmt.Sprintf("migrate %d: %s", m.Version, m.Name))
+		if !ProcessSyncCk(m.SQLs) {
+			return false
+		}
+		if !setSchemaVersionCk(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// markSchemaLatestCk 全量创建数据表后，已是最新结构
+func markSchemaLatestCk() bool {
+	if !ProcessSyncCk([]string{sqlCreateSchemaVersionTable}) {
+		logger.Log.Error("create schema version table failed")
+		return false
+	}
+	return setSchemaVersionCk(&migrations[len(migrations)-1])
+}
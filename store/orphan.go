@@ -0,0 +1,67 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+
+	"go.uber.org/zap"
+)
+
+// 被孤立的区块。区块重组时不删除数据，只记录孤块blkid，查询时排除孤块数据
+// sign为1表示被孤立，-1表示重新成为主链，按blkid求和大于0的为当前孤块。只插入不删除，避免等待mutation
+const sqlCreateBlkOrphanTable string = `
+CREATE TABLE IF NOT EXISTS blk_orphan (
+	height       UInt32,
+	blkid        FixedString(32),
+	sign         Int32 DEFAULT 1
+) engine=MergeTree()
+ORDER BY height
+`
+
+// SqlOrphanBlkIds 当前孤块的blkid
+const SqlOrphanBlkIds string = "SELECT blkid FROM blk_orphan GROUP BY blkid HAVING sum(sign) > 0"
+
+// SqlNotOrphan 查询带有blkid的数据表时排除孤块数据，内存池数据blkid为空，不受影响
+const SqlNotOrphan string = "blkid NOT IN (" + SqlOrphanBlkIds + ")"
+
+// sqlNotEverOrphan 部分同步写入时跳过曾被孤立的区块。孤块重新成为主链时，其数据仍保留在各表中，无需重复写入
+const sqlNotEverOrphan string = "blkid NOT IN (SELECT blkid FROM blk_orphan)"
+
+var (
+	// 标记孤块
+	markOrphanPartSQL = "INSERT INTO blk_orphan (height, blkid, sign) SELECT height, blkid, 1 FROM blk_height WHERE " + SqlNotOrphan + " AND height >= "
+
+	// 取消孤块标记，只处理当前孤块，重复执行不会重复取消
+	reviveOrphanPartSQL = "INSERT INTO blk_orphan (height, blkid, sign) SELECT height, blkid, -1 FROM blk_height_new WHERE blkid IN (" + SqlOrphanBlkIds + ")"
+)
+
+func blkIdResultSRF(rows *sql.Rows) (interface{}, error) {
+	var blkId []byte
+	if err := rows.Scan(&blkId); err != nil {
+		return nil, err
+	}
+	return blkId, nil
+}
+
+// mainBlkIdCk 主链上height高度的区块blkid，用于按高度生成的派生数据
+func mainBlkIdCk(height int) (blkIdHex string, ok bool) {
+	psql := fmt.Sprintf("SELECT blkid FROM blk_height WHERE height = %d AND %s LIMIT 1", height, SqlNotOrphan)
+	blkIdRet, err := clickhouse.ScanOne(psql, blkIdResultSRF)
+	if err != nil {
+		logger.Log.Error("query main block id failed", zap.Int("height", height), zap.Error(err))
+		return "", false
+	}
+	if blkIdRet == nil {
+		logger.Log.Error("main block not found", zap.Int("height", height))
+		return "", false
+	}
+	return hex.EncodeToString(blkIdRet.([]byte)), true
+}
+
+// reviveOrphanBlocksCk 曾被孤立的区块重新成为主链，取消孤块标记。该区块的旧数据仍在各表中，部分同步时不再重复写入
+func reviveOrphanBlocksCk() bool {
+	return ProcessSyncCk([]string{reviveOrphanPartSQL})
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 部分同步执行记录，每完成一步插入一行。中断后重启时从未完成的步骤继续
+// step为len(partSteps)表示已完成，被放弃的批次也记录为该值，不再继续
+const sqlCreateSyncPartStepTable string = `
+CREATE TABLE IF NOT EXISTS sync_part_step (
+	batch        String,
+	step         UInt32,      -- 0: 已处理复活的孤块，之后为partSteps的序号
+	done_at      DateTime DEFAULT now()
+) engine=MergeTree()
+ORDER BY (batch, step)
+TTL done_at + INTERVAL 30 DAY
+`
+
+// partStep 部分同步的一个步骤
+// 写入基础数据表的INSERT拆为两步：先写入暂存表，再将暂存表的分区逐个移动到目标表。
+// 写入暂存表可以重复执行；分区移动是原子的，重复执行只移动剩余的分区，因此都不会重复插入
+type partStep struct {
+	table string // INSERT的目标表，为空则直接执行sql
+	sql   string
+	move  bool
+}
+
+var (
+	insertSelectRe = regexp.MustCompile(`^INSERT INTO (\w+) (.+)$`)
+
+	partSteps = expandPartSteps(processPartSQLs, processPartSQLsForTxIn, processPartSQLsForTxOut)
+)
+
+func expandPartSteps(sqlsList ...[]string) (steps []partStep) {
+	for _, sqls := range sqlsList {
+		for _, psql := range sqls {
+			psql = strings.TrimSuffix(psql, ";")
+			match := insertSelectRe.FindStringSubmatch(psql)
+			if match == nil {
+				steps = append(steps, partStep{sql: psql})
+				continue
+			}
+			table := match[1]
+			steps = append(steps,
+				partStep{table: table, sql: fmt.Sprintf("INSERT INTO %s_stage %s", table, match[2])},
+				partStep{table: table, move: true},
+			)
+		}
+	}
+	return steps
+}
+
+func partitionIdResultSRF(rows *sql.Rows) (interface{}, error) {
+	var partitionId string
+	if err := rows.Scan(&partitionId); err != nil {
+		return nil, err
+	}
+	return partitionId, nil
+}
+
+func execPartStepCk(step *partStep) bool {
+	if step.table == "" {
+		return ProcessSyncCk([]string{step.sql})
+	}
+
+	stage := step.table + "_stage"
+	if !step.move {
+		return ProcessSyncCk([]string{
+			"DROP TABLE IF EXISTS " + stage,
+			fmt.Sprintf("CREATE TABLE %s AS %s", stage, step.table),
+			step.sql,
+		})
+	}
+
+	psql := fmt.Sprintf(`
+SELECT DISTINCT partition_id FROM system.parts
+   WHERE database = currentDatabase() AND table = '%s' AND active`, stage)
+	partitionsRet, err := clickhouse.ScanAll(psql, partitionIdResultSRF)
+	if err != nil {
+		logger.Log.Error("query stage partitions failed", zap.String("table", stage), zap.Error(err))
+		return false
+	}
+	sqls := []string{}
+	if partitionsRet != nil {
+		for _, partitionId := range partitionsRet.([]string) {
+			sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s MOVE PARTITION ID '%s' TO TABLE %s", stage, partitionId, step.table))
+		}
+	}
+	sqls = append(sqls, "DROP TABLE IF EXISTS "+stage)
+	return ProcessSyncCk(sqls)
+}
+
+func markPartStepCk(batch string, step int) bool {
+	psql := fmt.Sprintf("INSERT INTO sync_part_step (batch, step) VALUES ('%s', %d)", batch, step)
+	if _, err := clickhouse.CK.Exec(psql); err != nil {
+		logger.Log.Error("mark part sync step failed", zap.String("batch", batch), zap.Int("step", step), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// processPartStepsCk 执行doneStep之后的步骤
+func processPartStepsCk(batch string, doneStep int) bool {
+	for step := doneStep + 1; step <= len(partSteps); step++ {
+		if !execPartStepCk(&partSteps[step-1]) {
+			logger.Log.Error("part sync step failed", zap.String("batch", batch), zap.Int("step", step))
+			return false
+		}
+		if !markPartStepCk(batch, step) {
+			return false
+		}
+	}
+	return true
+}
+
+func ProcessPartSyncCk() bool {
+	logger.Log.Info("sync sql: part")
+	if clickhouse.IsPostgres {
+		return processPartSyncPg()
+	}
+	var heights string
+	psql := "SELECT concat(toString(min(height)), '-', toString(max(height))) FROM blk_height_new"
+	if _, err := clickhouse.ScanOne2(psql, &heights); err != nil {
+		logger.Log.Error("query part sync heights failed", zap.Error(err))
+		return false
+	}
+	batch := fmt.Sprintf("%s-%d", heights, time.Now().Unix())
+
+	// 之前失败的批次数据已被本批次的*_new表覆盖，不能再继续
+	if !abandonPartSyncBatchesCk(batch) {
+		return false
+	}
+	if !reviveOrphanBlocksCk() {
+		return false
+	}
+	if !markPartStepCk(batch, 0) {
+		return false
+	}
+	return processPartStepsCk(batch, 0)
+}
+
+// ResumePartSyncCk 启动时继续执行上次中断的部分同步。未记录任何步骤的同步无需继续，将重新同步
+func ResumePartSyncCk() bool {
+	if clickhouse.IsPostgres {
+		return true
+	}
+	if _, err := clickhouse.CK.Exec(sqlCreateSyncPartStepTable); err != nil {
+		logger.Log.Error("create part sync step table failed", zap.Error(err))
+		return false
+	}
+
+	var (
+		batch    string
+		doneStep uint32
+	)
+	psql := fmt.Sprintf(`
+SELECT batch, max(step) FROM sync_part_step
+   GROUP BY batch
+   HAVING max(step) < %d
+   ORDER BY max(done_at) DESC, batch DESC
+   LIMIT 1`, len(partSteps))
+	ok, err := clickhouse.ScanOne2(psql, []interface{}{&batch, &doneStep})
+	if err != nil {
+		logger.Log.Error("query part sync steps failed", zap.Error(err))
+		return false
+	}
+	if !ok {
+		return true
+	}
+	// 只有最近的批次对应当前的*_new表，更早未完成的批次放弃
+	if !abandonPartSyncBatchesCk(batch) {
+		return false
+	}
+	logger.Log.Info("resume part sync", zap.String("batch", batch), zap.Uint32("step", doneStep))
+	return processPartStepsCk(batch, int(doneStep))
+}
+
+// abandonPartSyncBatchesCk 将keepBatch以外未完成的批次记录为已结束，之后不再继续
+func abandonPartSyncBatchesCk(keepBatch string) bool {
+	psql := fmt.Sprintf(`
+INSERT INTO sync_part_step (batch, step)
+SELECT batch, %d FROM sync_part_step
+   WHERE batch != '%s'
+   GROUP BY batch
+   HAVING max(step) < %d`, len(partSteps), keepBatch, len(partSteps))
+	if _, err := clickhouse.CK.Exec(psql); err != nil {
+		logger.Log.Error("abandon part sync batches failed", zap.String("keep", keepBatch), zap.Error(err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/model"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// PostgreSQL存储后端(db.yaml中backend为postgres)，适合regtest/testnet或只索引token的小规模部署。
+// 数据表由clickhouse建表语句转换而来，带有height的数据表按高度声明式分区，分区在写入前按需创建。
+// 同步写入使用COPY，同步处理在一个事务内执行，区块重组时在事务内删除重组高度之后的数据，不再标记孤块
+
+// 每个分区的区块数量，与clickhouse的10个分区对应
+const pgPartitionBlocks = 21000
+
+var (
+	// 按高度分区的数据表
+	pgPartitionedTables = map[string]bool{
+		"blk_height":            true,
+		"blk":                   true,
+		"blk_codehash_height":   true,
+		"blk_ft_supply_height":  true,
+		"ft_holder_snapshot":    true,
+		"ft_token":              true,
+		"stat_rich_list":        true,
+		"stat_genesis_holder":   true,
+		"nft_transfer_height":   true,
+		"nft_sell_trade":        true,
+		"nft_auction_event":     true,
+		"swap_candle":           true,
+		"blktx_contract_height": true,
+		"blktx_height":          true,
+		"txout":                 true,
+		"txin_spent":            true,
+		"txin":                  true,
+		"tx_height":             true,
+		"txout_spent_height":    true,
+		"txin_genesis_height":   true,
+		"txout_genesis_height":  true,
+	}
+
+	// 区块重组时需删除重组高度之后数据的表，不包括内存池数据
+	pgReorgTables = []string{
+		"blk_height",
+		"blk",
+		"blk_codehash_height",
+		"blk_ft_supply_height",
+		"ft_holder_snapshot",
+		"ft_token",
+		"nft_transfer_height",
+		"nft_sell_trade",
+		"nft_auction_event",
+		"swap_candle",
+		"blktx_contract_height",
+		"blktx_height",
+		"txout",
+		"txin_spent",
+		"txin",
+		"tx_height",
+		"txout_spent_height",
+		"txin_genesis_height",
+		"txout_genesis_height",
+		"stat_rich_list",
+		"stat_genesis_holder",
+		"stat_address",
+		"stat_utxo_distribution",
+		"stat_active_address",
+	}
+
+	pgCreateTableRe   = regexp.MustCompile(`(?is)^CREATE TABLE IF NOT EXISTS (\w+) \((.*)\)\s*engine\s*=\s*(\w+)(.*)$`)
+	pgCreateAsRe      = regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?(\w+) AS (\w+)$`)
+	pgDropPartitionRe = regexp.MustCompile(`(?i)^ALTER TABLE (\w+) DROP PARTITION '2045222'$`)
+	pgAlterDeleteRe   = regexp.MustCompile(`(?is)^ALTER TABLE (\w+) DELETE WHERE (.*)$`)
+	pgOrderByRe       = regexp.MustCompile(`(?i)ORDER BY \(?([^)\n]+)\)?`)
+	pgUnhexRe         = regexp.MustCompile(`unhex\('([0-9a-fA-F]*)'\)`)
+	pgInsertFromRe    = regexp.MustCompile(`(?is)^INSERT INTO (\w+) .*?\bFROM (\w+)`)
+)
+
+// pgColumnType clickhouse列类型对应的PostgreSQL类型及其默认值。无符号整数扩大一级，UInt64使用numeric
+func pgColumnType(chType string) (string, string, error) {
+	switch {
+	case chType == "UInt8" || chType == "UInt16" || chType == "Int32":
+		return "integer", "0", nil
+	case chType == "UInt32" || chType == "Int64":
+		return "bigint", "0", nil
+	case chType == "UInt64":
+		return "numeric(20,0)", "0", nil
+	case chType == "Float64":
+		return "double precision", "0", nil
+	case chType == "String" || fixedStringRe.MatchString(chType):
+		return "bytea", "''", nil
+	case chType == "DateTime":
+		return "timestamp", "'epoch'", nil
+	case chType == "Date":
+		return "date", "'epoch'", nil
+	}
+	return "", "", fmt.Errorf("unsupported column type: %s", chType)
+}
+
+// splitColumns 按顶层逗号拆分列定义，去掉注释
+func splitColumns(body string) (columns []string) {
+	lines := strings.Split(body, "\n")
+	for idx, line := range lines {
+		if pos := strings.Index(line, "--"); pos >= 0 {
+			lines[idx] = line[:pos]
+		}
+	}
+	body = strings.Join(lines, "\n")
+
+	depth, start := 0, 0
+	for idx, ch := range body {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				columns = append(columns, strings.TrimSpace(body[start:idx]))
+				start = idx + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(body[start:]); last != "" {
+		columns = append(columns, last)
+	}
+	return columns
+}
+
+// pgCreateTable clickhouse建表语句转换为PostgreSQL建表、建索引语句
+// 列均为NOT NULL并带有零值默认值，与clickhouse省略列时一致。ORDER BY转换为索引，Memory表转换为UNLOGGED表
+func pgCreateTable(table, body, engine, settings string) ([]string, error) {
+	hasHeight := false
+	defs := []string{}
+	for _, column := range splitColumns(body) {
+		fields := strings.Fields(column)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid column of %s: %s", table, column)
+		}
+		pgType, pgDefault, err := pgColumnType(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 3 && strings.EqualFold(fields[2], "DEFAULT") {
+			pgDefault = strings.Join(fields[3:], " ")
+		}
+		if fields[0] == "height" {
+			hasHeight = true
+		}
+		defs = append(defs, fmt.Sprintf("\t%s %s NOT NULL DEFAULT %s", fields[0], pgType, pgDefault))
+	}
+
+	unlogged := ""
+	if strings.EqualFold(engine, "Memory") {
+		unlogged = "UNLOGGED "
+	}
+	psql := fmt.Sprintf("CREATE %sTABLE IF NOT EXISTS %s (\n%s\n)", unlogged, table, strings.Join(defs, ",\n"))
+	if hasHeight && pgPartitionedTables[table] {
+		psql += " PARTITION BY RANGE (height)"
+	}
+	sqls := []string{psql}
+	if match := pgOrderByRe.FindStringSubmatch(settings); match != nil {
+		sqls = append(sqls, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_order_idx ON %s (%s)", table, table, match[1]))
+	}
+	return sqls, nil
+}
+
+// pgStatements clickhouse语句转换为PostgreSQL语句，同步处理的INSERT SELECT、DROP TABLE等语句两者通用
+func pgStatements(psql string) ([]string, error) {
+	psql = strings.TrimSuffix(strings.TrimSpace(psql), ";")
+	psql = pgUnhexRe.ReplaceAllString(psql, "decode('$1', 'hex')")
+
+	if match := pgCreateTableRe.FindStringSubmatch(psql); match != nil {
+		return pgCreateTable(match[1], match[2], match[3], match[4])
+	}
+	if match := pgCreateAsRe.FindStringSubmatch(psql); match != nil {
+		// 暂存表不分区，不记录WAL
+		return []string{fmt.Sprintf("CREATE UNLOGGED TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS)", match[1], match[2])}, nil
+	}
+	if match := pgDropPartitionRe.FindStringSubmatch(psql); match != nil {
+		// 内存池数据
+		return []string{fmt.Sprintf("DELETE FROM %s WHERE height = %d", match[1], model.MEMPOOL_HEIGHT)}, nil
+	}
+	if match := pgAlterDeleteRe.FindStringSubmatch(psql); match != nil {
+		return []string{fmt.Sprintf("DELETE FROM %s WHERE %s", match[1], match[2])}, nil
+	}
+	return []string{psql}, nil
+}
+
+type pgExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ensurePartitionsPg 创建[minHeight, maxHeight]所在的分区
+func ensurePartitionsPg(db pgExecer, table string, minHeight, maxHeight int64) error {
+	for partition := minHeight / pgPartitionBlocks; partition <= maxHeight/pgPartitionBlocks; partition++ {
+		psql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_p%d PARTITION OF %s FOR VALUES FROM (%d) TO (%d)",
+			table, partition, table, partition*pgPartitionBlocks, (partition+1)*pgPartitionBlocks)
+		if _, err := db.Exec(psql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureInsertPartitionsPg INSERT SELECT写入分区表前，按源表的高度范围创建分区
+func ensureInsertPartitionsPg(tx *sql.Tx, table, source string) error {
+	var minHeight, maxHeight sql.NullInt64
+	psql := fmt.Sprintf("SELECT min(height), max(height) FROM %s", source)
+	if err := tx.QueryRow(psql).Scan(&minHeight, &maxHeight); err != nil {
+		return err
+	}
+	if !minHeight.Valid {
+		return nil
+	}
+	return ensurePartitionsPg(tx, table, minHeight.Int64, maxHeight.Int64)
+}
+
+// ProcessSyncPg 转换并在一个事务内执行clickhouse语句，失败则全部回滚
+func ProcessSyncPg(processSQLs []string) bool {
+	tx, err := clickhouse.CK.Begin()
+	if err != nil {
+		logger.Log.Error("sync begin err", zap.Error(err))
+		return false
+	}
+	for _, psql := range processSQLs {
+		pgsqls, err := pgStatements(psql)
+		if err != nil {
+			logger.Log.Error("sync convert err", zap.Error(err))
+			tx.Rollback()
+			return false
+		}
+		for _, pgsql := range pgsqls {
+			partLen := len(pgsql)
+			if partLen > 96 {
+				partLen = 96
+			}
+			if match := pgInsertFromRe.FindStringSubmatch(pgsql); match != nil && pgPartitionedTables[match[1]] {
+				if err := ensureInsertPartitionsPg(tx, match[1], match[2]); err != nil {
+					logger.Log.Info("sync partition err",
+						zap.String("sql", pgsql[:partLen]), zap.Error(err))
+					tx.Rollback()
+					return false
+				}
+			}
+			if _, err := tx.Exec(pgsql); err != nil {
+				logger.Log.Info("sync exec err",
+					zap.String("sql", pgsql[:partLen]), zap.Error(err))
+				tx.Rollback()
+				return false
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Log.Error("sync commit err", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// removeOrphanPartSyncPg 区块重组，在一个事务内删除重组高度之后的已确认数据
+func removeOrphanPartSyncPg(startBlockHeight int) bool {
+	sqls := make([]string, 0, len(pgReorgTables))
+	for _, table := range pgReorgTables {
+		sqls = append(sqls, fmt.Sprintf("DELETE FROM %s WHERE height >= %d AND height < %d",
+			table, startBlockHeight, model.MEMPOOL_HEIGHT))
+	}
+	return ProcessSyncPg(sqls)
+}
+
+// processPartSyncPg 暂存表数据在一个事务内写入各表，中断后没有未完成的步骤，无需继续
+func processPartSyncPg() bool {
+	sqls := append([]string{}, processPartSQLs...)
+	sqls = append(sqls, processPartSQLsForTxIn...)
+	sqls = append(sqls, processPartSQLsForTxOut...)
+	return ProcessSyncPg(sqls)
+}
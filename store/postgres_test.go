@@ -0,0 +1,176 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sensibled/loader/clickhouse"
+	"sensibled/model"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// PostgreSQL集成测试，需设置该环境变量指向专用的空数据库，测试会删除并重建所有数据表
+const testPostgresDSNEnv = "SENSIBLED_TEST_POSTGRES_DSN"
+
+func initTestPostgres(t *testing.T) {
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", testPostgresDSNEnv)
+	}
+	viper.Set("postgres_dsn", dsn)
+	clickhouse.InitPostgres()
+	t.Cleanup(func() {
+		clickhouse.CK.Close()
+		clickhouse.IsPostgres = false
+	})
+
+	if !CreateAllSyncCk() {
+		t.Fatal("create tables failed")
+	}
+}
+
+// testPgId 构造测试用32字节id
+func testPgId(name string) string {
+	return name + strings.Repeat("_", 32-len(name))
+}
+
+type testPgTx struct {
+	txid  string
+	spend *testPgTxo // 花费的txo，nil为coinbase
+}
+
+type testPgTxo struct {
+	height uint32
+	txid   string
+}
+
+// writeTestPgBlock 按同步时的参数类型写入一个区块，每个tx一个输出
+func writeTestPgBlock(height uint32, txs []testPgTx) {
+	blkid := testPgId(fmt.Sprintf("blk%d", height))
+	SyncStmtBlk.Exec(height, blkid, testPgId("prev"), testPgId("merkle"),
+		uint64(len(txs)), uint64(0), uint64(0), uint64(50), uint32(1600000000)+height, uint32(0), uint32(200))
+
+	for txIdx, tx := range txs {
+		nIn := uint32(0)
+		if tx.spend != nil {
+			nIn = 1
+		}
+		SyncStmtTx.Exec(tx.txid, nIn, uint32(1), uint32(100), uint32(0), uint64(0), uint64(50),
+			"rawtx", height, uint64(txIdx), blkid)
+		SyncStmtTxOut.Exec(tx.txid, uint32(0), "address", "", "", uint32(0), uint64(0), uint64(50),
+			"p2pkh", "script", height, uint64(txIdx), blkid)
+		if tx.spend == nil {
+			continue
+		}
+		SyncStmtTxIn.Exec(height, uint64(txIdx), tx.txid, uint32(0), "sig", uint32(0xffffffff),
+			tx.spend.height, uint64(0), tx.spend.txid, uint32(0), "address", "", "", uint32(0), uint64(0), uint64(50),
+			"p2pkh", "script", blkid)
+	}
+}
+
+func countTestPg(t *testing.T, psql string) uint64 {
+	t.Helper()
+	var n uint64
+	if _, err := clickhouse.ScanOne2(psql, &n); err != nil {
+		t.Fatalf("query %s failed: %v", psql, err)
+	}
+	return n
+}
+
+func expectTestPgCount(t *testing.T, psql string, want uint64) {
+	t.Helper()
+	if n := countTestPg(t, psql); n != want {
+		t.Fatalf("%s: %d, want %d", psql, n, want)
+	}
+}
+
+func TestPostgresSyncAndReorg(t *testing.T) {
+	initTestPostgres(t)
+
+	batchRows := clickhouse.BatchRows
+	clickhouse.BatchRows = 2 // 每2行发送一次COPY，跨分区写入
+	defer func() { clickhouse.BatchRows = batchRows }()
+
+	// 全量同步，高度跨越两个分区
+	PrepareFullSyncCk()
+	for _, height := range []uint32{0, 1, 2, 21000} {
+		writeTestPgBlock(height, []testPgTx{{txid: testPgId(fmt.Sprintf("coinbase%d", height))}})
+	}
+	writeTestPgBlock(21001, []testPgTx{
+		{txid: testPgId("coinbase21001")},
+		{txid: testPgId("spend21001"), spend: &testPgTxo{height: 0, txid: testPgId("coinbase0")}},
+	})
+	if !CommitSyncCk() {
+		t.Fatal("copy failed")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk_height", 5)
+	expectTestPgCount(t, "SELECT count(*) FROM blktx_height", 6)
+	expectTestPgCount(t, "SELECT count(*) FROM txout", 6)
+	expectTestPgCount(t, "SELECT count(*) FROM txin", 1)
+	expectTestPgCount(t, "SELECT count(*) FROM pg_inherits WHERE inhparent = 'blk_height'::regclass", 2)
+	expectTestPgCount(t, "SELECT count(*) FROM pg_inherits WHERE inhparent = 'txin'::regclass", 1)
+
+	if !ProcessAllSyncCk() {
+		t.Fatal("process all failed")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk", 5)
+	expectTestPgCount(t, "SELECT count(*) FROM tx_height", 6)
+	expectTestPgCount(t, "SELECT count(*) FROM txin_spent", 1)
+	expectTestPgCount(t, "SELECT count(*) FROM txout_spent_height", 1)
+
+	// 部分同步，写入*_new暂存表后在一个事务内合并
+	if !CreatePartSyncCk() {
+		t.Fatal("create part tables failed")
+	}
+	PreparePartSyncCk()
+	writeTestPgBlock(21002, []testPgTx{{txid: testPgId("coinbase21002")}})
+	if !CommitSyncCk() {
+		t.Fatal("copy part failed")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk_height_new", 1)
+	if !ProcessPartSyncCk() {
+		t.Fatal("process part failed")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk_height", 6)
+	expectTestPgCount(t, "SELECT count(*) FROM tx_height", 7)
+	expectTestPgCount(t, "SELECT count(*) FROM pg_tables WHERE tablename = 'blk_height_new'", 0)
+
+	// 内存池数据写入最高的分区，重组时保留
+	w := NewBatchWriter("INSERT INTO txout (utxid, vout, address, codehash, genesis, code_type, data_value, satoshi, script_type, script_pk, height, utxidx, blkid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	w.Exec(testPgId("mempool"), uint32(0), "address", "", "", uint32(0), uint64(0), uint64(50),
+		"p2pkh", "script", uint32(model.MEMPOOL_HEIGHT), uint64(0), "")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("copy mempool failed: %v", err)
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM txout", 8)
+
+	// 重组删除失败时整体回滚
+	if !ProcessSyncPg([]string{"DROP TABLE stat_active_address"}) {
+		t.Fatal("drop table failed")
+	}
+	if RemoveOrphanPartSyncCk(21000) {
+		t.Fatal("reorg should fail without stat_active_address")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk_height", 6)
+	expectTestPgCount(t, "SELECT count(*) FROM txout", 8)
+	if !ProcessSyncPg([]string{sqlCreateStatActiveAddressTable}) {
+		t.Fatal("recreate table failed")
+	}
+
+	if !RemoveOrphanPartSyncCk(21000) {
+		t.Fatal("reorg failed")
+	}
+	expectTestPgCount(t, "SELECT count(*) FROM blk_height", 3)
+	expectTestPgCount(t, "SELECT count(*) FROM blk", 3)
+	expectTestPgCount(t, "SELECT count(*) FROM blktx_height", 3)
+	expectTestPgCount(t, "SELECT count(*) FROM tx_height", 3)
+	expectTestPgCount(t, "SELECT count(*) FROM txout", 4)
+	expectTestPgCount(t, "SELECT count(*) FROM txout WHERE height = 4294967295", 1)
+	expectTestPgCount(t, "SELECT count(*) FROM txin", 0)
+	expectTestPgCount(t, "SELECT count(*) FROM txin_spent", 0)
+	expectTestPgCount(t, "SELECT count(*) FROM txout_spent_height", 0)
+	// PostgreSQL直接删除数据，不记录孤块
+	expectTestPgCount(t, "SELECT count(*) FROM blk_orphan", 0)
+}
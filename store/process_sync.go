@@ -8,6 +8,152 @@ import (
 	"go.uber.org/zap"
 )
 
+// ft增发和销毁记录，按ft排序、索引。兼容已有数据库，部分同步时也需要创建
+const sqlCreateFTSupplyTable string = `
+CREATE TABLE IF NOT EXISTS blk_ft_supply_height (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	minted       UInt64,
+	burned       UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, txidx)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// ft登记信息，每个ft一行，记录首次出现的tx。按codehash+genesis查询
+const sqlCreateFTTokenTable string = `
+CREATE TABLE IF NOT EXISTS ft_token (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	sensibleid   String,
+	name         String,
+	symbol       String,
+	decimal      UInt8,
+	issuer       String,
+	verified     UInt8,       -- 首次出现的tx花费了sensibleid指向的genesis输出
+	copycat      UInt8,       -- 名称、符号与更早登记的已验证ft相同
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// nft转移历史，每个nft输出一行，按nft排序、索引。按codehash+genesis+token_idx查询
+const sqlCreateNFTTransferTable string = `
+CREATE TABLE IF NOT EXISTS nft_transfer_height (
+	height       UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	vout         UInt32,
+	codehash     String,
+	genesis      String,
+	token_idx    UInt64,
+	from_address String,
+	address      String,
+	operation    UInt32,      -- 0: mint, 1: transfer, 2: sell list, 3: sell cancel, 4: sold, 5: auction list, 6: auction settle, 7: auction cancel
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, token_idx, height, txidx)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// nft出售合约成交记录，按nft排序、索引。按codehash+genesis查询
+const sqlCreateNFTTradeTable string = `
+CREATE TABLE IF NOT EXISTS nft_sell_trade (
+	height       UInt32,
+	blocktime    UInt32,
+	txidx        UInt64,
+	txid         FixedString(32),
+	codehash     String,
+	genesis      String,
+	token_idx    UInt64,
+	seller       String,
+	buyer        String,
+	price        UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, txidx)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// nft拍卖状态变化记录，按拍卖合约排序、索引。按auction_id查询，内存池数据也写入此表
+const SqlCreateNFTAuctionTable string = `
+CREATE TABLE IF NOT EXISTS nft_auction_event (
+	height        UInt32,
+	blocktime     UInt32,
+	txidx         UInt64,
+	txid          FixedString(32),
+	idx           UInt32,
+	auction_id    String,
+	codehash      String,
+	nft_codehash  String,
+	nft_id        String,
+	event         UInt32,      -- 0: created, 1: bid, 2: outbid, 3: settled, 4: cancelled
+	sender        String,
+	bidder        String,
+	price         UInt64,
+	end_timestamp UInt64,
+	vout          UInt32,
+	blkid         FixedString(32)
+) engine=MergeTree()
+ORDER BY (auction_id, height, txidx, idx)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// swap池K线，每个区块内每个池在各周期各一条，按池+周期+时间排序、索引。
+// 查询时按ts聚合同一周期内多个区块的记录，内存池数据每个tx一条，也写入此表
+const SqlCreateSwapCandleTable string = `
+CREATE TABLE IF NOT EXISTS swap_candle (
+	height       UInt32,
+	period       UInt32,      -- 60: 1m, 3600: 1h, 86400: 1d
+	ts           UInt32,      -- 周期开始时间
+	codehash     String,
+	genesis      String,
+	open         Float64,     -- 价格为token1/token2
+	high         Float64,
+	low          Float64,
+	close        Float64,
+	volume1      UInt64,      -- token1成交量
+	volume2      UInt64,      -- token2成交量
+	trades       UInt32,
+	reserve1     UInt64,      -- 收盘时token1储备
+	reserve2     UInt64,
+	lp           UInt64,
+	txidx        UInt64,      -- 收盘tx
+	txid         FixedString(32),
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, period, ts, height, txidx)
+PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
+`
+
+// ft持有人余额快照，由工具按需生成，按ft+高度排序、索引
+const sqlCreateFTSnapshotTable string = `
+CREATE TABLE IF NOT EXISTS ft_holder_snapshot (
+	height       UInt32,
+	codehash     String,
+	genesis      String,
+	address      String,
+	balance      UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, address)
+PARTITION BY intDiv(height, 2100)
+`
+
 var (
 	createAllSQLs = []string{
 		// block list
@@ -29,8 +175,20 @@ CREATE TABLE IF NOT EXISTS blk_height (
 ) engine=MergeTree()
 ORDER BY height
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
+		// 孤块记录
+		"DROP TABLE IF EXISTS blk_orphan",
+		sqlCreateBlkOrphanTable,
+
+		// 部分同步执行记录
+		"DROP TABLE IF EXISTS sync_part_step",
+		sqlCreateSyncPartStepTable,
+
+		// 内存池重复花费记录与区块数据无关，全量同步时保留
+		SqlCreateDoubleSpendTable,
+
 		"DROP TABLE IF EXISTS blk",
 		`
 CREATE TABLE IF NOT EXISTS blk (
@@ -66,8 +224,48 @@ CREATE TABLE IF NOT EXISTS blk_codehash_height (
 ) engine=MergeTree()
 ORDER BY (height, codehash, genesis)
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
+		// ft增发和销毁记录，每个tx中每个ft一行，按ft排序。按codehash+genesis查询
+		"DROP TABLE IF EXISTS blk_ft_supply_height",
+		sqlCreateFTSupplyTable,
+
+		"DROP TABLE IF EXISTS ft_holder_snapshot",
+		sqlCreateFTSnapshotTable,
+
+		// ft登记信息
+		"DROP TABLE IF EXISTS ft_token",
+		sqlCreateFTTokenTable,
+
+		// 统计数据
+		"DROP TABLE IF EXISTS stat_rich_list",
+		sqlCreateStatRichListTable,
+		"DROP TABLE IF EXISTS stat_genesis_holder",
+		sqlCreateStatGenesisHolderTable,
+		"DROP TABLE IF EXISTS stat_address",
+		sqlCreateStatAddressTable,
+		"DROP TABLE IF EXISTS stat_utxo_distribution",
+		sqlCreateStatUtxoDistributionTable,
+		"DROP TABLE IF EXISTS stat_active_address",
+		sqlCreateStatActiveAddressTable,
+
+		// nft转移历史
+		"DROP TABLE IF EXISTS nft_transfer_height",
+		sqlCreateNFTTransferTable,
+
+		// nft出售成交记录
+		"DROP TABLE IF EXISTS nft_sell_trade",
+		sqlCreateNFTTradeTable,
+
+		// nft拍卖状态变化记录
+		"DROP TABLE IF EXISTS nft_auction_event",
+		SqlCreateNFTAuctionTable,
+
+		// swap池K线
+		"DROP TABLE IF EXISTS swap_candle",
+		SqlCreateSwapCandleTable,
+
 		// tx contract
 		// ================================================================
 		// 区块包含的交易中的contract记录，分区内按区块高度height排序、索引。按blk height查询时可确定分区 (快)
@@ -92,6 +290,7 @@ CREATE TABLE IF NOT EXISTS blktx_contract_height (
 ) engine=MergeTree()
 ORDER BY (height, code_type, codehash, genesis)
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
 		// tx list
@@ -109,10 +308,12 @@ CREATE TABLE IF NOT EXISTS blktx_height (
 	outvalue     UInt64,
 	rawtx        String,
 	height       UInt32,
-	txidx        UInt64
+	txidx        UInt64,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY (height, txid)
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
 		// txout
@@ -133,10 +334,12 @@ CREATE TABLE IF NOT EXISTS txout (
 	script_type  String,
 	script_pk    String,
 	height       UInt32,
-	utxidx       UInt64
+	utxidx       UInt64,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY (utxid, vout)
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
 		// txin
@@ -150,7 +353,8 @@ CREATE TABLE IF NOT EXISTS txin_spent (
 	txid         FixedString(32),
 	idx          UInt32,
 	utxid        FixedString(12),
-	vout         UInt32
+	vout         UInt32,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY (utxid, vout)
 PARTITION BY intDiv(height, 2100)
@@ -179,44 +383,47 @@ CREATE TABLE IF NOT EXISTS txin (
 	data_value   UInt64,
 	satoshi      UInt64,
 	script_type  String,
-	script_pk    String
+	script_pk    String,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY (txid, idx)
 PARTITION BY intDiv(height, 2100)
+SETTINGS non_replicated_deduplication_window = 1000
 `,
 
 		// ================================================================
 		// tx在哪个高度被打包，按txid首字节分区，分区内按交易txid排序、索引。按txid查询时可确定分区（快）
-		// 此数据表不能保证和最长链一致，而是包括所有已打包tx的height信息，其中可能存在已被孤立的块高度
+		// 包括所有已打包tx的height信息，其中可能存在已被孤立的块，查询需附带SqlNotOrphan条件
 		// 主要用于从txid确定所在区块height。配合其他表查询
-		// todo: ADD COLUMN txidx        UInt64,         // new
-
 		"DROP TABLE IF EXISTS tx_height",
 		`
 CREATE TABLE IF NOT EXISTS tx_height (
 	txid         FixedString(12),
-	height       UInt32
+	height       UInt32,
+	txidx        UInt64,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY txid
 PARTITION BY substring(txid, 1, 1)
 `,
 
 		// txout在哪个高度被花费，按txid首字节分区，分区内按交易txid+idx排序、索引。按txid+idx查询时可确定分区 (快)
-		// 此数据表不能保证和最长链一致，而是包括所有已打包tx的height信息，其中可能存在已被孤立的块高度
+		// 包括所有已打包tx的height信息，其中可能存在已被孤立的块，查询需附带SqlNotOrphan条件
 		// 主要用于从txid+idx确定花费所在区块height。配合其他表查询
 		"DROP TABLE IF EXISTS txout_spent_height",
 		`
 CREATE TABLE IF NOT EXISTS txout_spent_height (
 	height       UInt32,
 	utxid        FixedString(12),
-	vout         UInt32
+	vout         UInt32,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 ORDER BY (utxid, vout)
 PARTITION BY substring(utxid, 1, 1)
 `,
 
 		// genesis在哪些高度的tx中出现，按genesis首字节分区，分区内按genesis+address+height排序，按genesis索引。按genesis查询时可确定分区 (快)
-		// 此数据表不能保证和最长链一致，而是包括所有已打包tx的height信息，其中可能存在已被孤立的块高度
+		// 包括所有已打包tx的height信息，其中可能存在已被孤立的块，查询需附带SqlNotOrphan条件
 		// 主要用于从genesis确定所在区块height。配合txin源表查询
 		"DROP TABLE IF EXISTS txin_genesis_height",
 		`
@@ -227,7 +434,8 @@ CREATE TABLE IF NOT EXISTS txin_genesis_height (
 	idx          UInt32,
 	address      String,
 	codehash     String,
-	genesis      String
+	genesis      String,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 PRIMARY KEY address
 ORDER BY (address, codehash, genesis, height, txidx)
@@ -235,23 +443,24 @@ PARTITION BY substring(address, 1, 1)
 `,
 
 		// genesis在哪些高度的tx中出现，按genesis首字节分区，分区内按genesis+address+height排序，按genesis索引。按genesis查询时可确定分区 (快)
-		// 此数据表不能保证和最长链一致，而是包括所有已打包tx的height信息，其中可能存在已被孤立的块高度
+		// 包括所有已打包tx的height信息，其中可能存在已被孤立的块，查询需附带SqlNotOrphan条件
 		// 主要用于从genesis确定所在区块height。配合txout源表查询
 		"DROP TABLE IF EXISTS txout_genesis_height",
 		`
 CREATE TABLE IF NOT EXISTS txout_genesis_height (
-height       UInt32,
+	height       UInt32,
 	utxidx       UInt64,
 	utxid        FixedString(12),
 	vout         UInt32,
 	address      String,
 	codehash     String,
-	genesis      String
+	genesis      String,
+	blkid        FixedString(32)
 ) engine=MergeTree()
 PRIMARY KEY address
 ORDER BY (address, codehash, genesis, height, utxidx)
 PARTITION BY substring(address, 1, 1)
- `,
+`,
 	}
 
 	processAllSQLs = []string{
@@ -259,41 +468,35 @@ PARTITION BY substring(address, 1, 1)
 		"INSERT INTO blk SELECT * FROM blk_height",
 
 		// 生成tx到区块高度索引
-		"INSERT INTO tx_height SELECT substring(txid, 1, 12), height FROM blktx_height",
+		"INSERT INTO tx_height (txid, height, txidx, blkid) SELECT substring(txid, 1, 12), height, txidx, blkid FROM blktx_height",
 
 		// 生成txo被花费的tx索引
-		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout FROM txin",
+		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout, blkid FROM txin",
 		// 生成txo被花费的tx区块高度索引
-		"INSERT INTO txout_spent_height SELECT height, utxid, vout FROM txin_spent",
+		"INSERT INTO txout_spent_height SELECT height, utxid, vout, blkid FROM txin_spent",
 
 		// 生成溯源ID参与的输出索引
-		"INSERT INTO txout_genesis_height SELECT height, utxidx, substring(utxid, 1, 12), vout, address, codehash, genesis FROM txout WHERE codehash != ''",
+		"INSERT INTO txout_genesis_height SELECT height, utxidx, substring(utxid, 1, 12), vout, address, codehash, genesis, blkid FROM txout WHERE codehash != ''",
 		// 生成溯源ID参与输入的相关tx区块高度索引
-		"INSERT INTO txin_genesis_height SELECT height, txidx, substring(txid, 1, 12), idx, address, codehash, genesis FROM txin WHERE codehash != ''",
-	}
-
-	removeOrphanPartSQLs = []string{
-		// ================ 如果没有孤块，则无需处理
-		"ALTER TABLE blk_height DELETE WHERE height >= ",
-		"ALTER TABLE blk DELETE WHERE height >= ",
-		"ALTER TABLE blk_codehash_height DELETE WHERE height >= ",
-
-		"ALTER TABLE blktx_contract_height DELETE WHERE height >= ",
-		"ALTER TABLE blktx_height DELETE WHERE height >= ",
-
-		"ALTER TABLE txin_spent DELETE WHERE height >= ",
-
-		"ALTER TABLE txin DELETE WHERE height >= ",
-		"ALTER TABLE txout DELETE WHERE height >= ",
+		"INSERT INTO txin_genesis_height SELECT height, txidx, substring(txid, 1, 12), idx, address, codehash, genesis, blkid FROM txin WHERE codehash != ''",
 	}
 
 	createPartSQLs = []string{
+		sqlCreateBlkOrphanTable,
+		sqlCreateSyncPartStepTable,
+
 		"DROP TABLE IF EXISTS blk_height_new",
 		"DROP TABLE IF EXISTS blk_codehash_height_new",
 		"DROP TABLE IF EXISTS blktx_contract_height_new",
 		"DROP TABLE IF EXISTS blktx_height_new",
 		"DROP TABLE IF EXISTS txout_new",
 		"DROP TABLE IF EXISTS txin_new",
+		"DROP TABLE IF EXISTS blk_ft_supply_height_new",
+		"DROP TABLE IF EXISTS ft_token_new",
+		"DROP TABLE IF EXISTS nft_transfer_height_new",
+		"DROP TABLE IF EXISTS nft_sell_trade_new",
+		"DROP TABLE IF EXISTS nft_auction_event_new",
+		"DROP TABLE IF EXISTS swap_candle_new",
 
 		"CREATE TABLE IF NOT EXISTS blk_height_new AS blk_height",
 		"CREATE TABLE IF NOT EXISTS blk_codehash_height_new AS blk_codehash_height",
@@ -301,55 +504,90 @@ PARTITION BY substring(address, 1, 1)
 		"CREATE TABLE IF NOT EXISTS blktx_height_new AS blktx_height",
 		"CREATE TABLE IF NOT EXISTS txout_new AS txout",
 		"CREATE TABLE IF NOT EXISTS txin_new AS txin",
+		sqlCreateFTSupplyTable,
+		"CREATE TABLE IF NOT EXISTS blk_ft_supply_height_new AS blk_ft_supply_height",
+		sqlCreateFTSnapshotTable,
+		sqlCreateFTTokenTable,
+		"CREATE TABLE IF NOT EXISTS ft_token_new AS ft_token",
+		sqlCreateNFTTransferTable,
+		"CREATE TABLE IF NOT EXISTS nft_transfer_height_new AS nft_transfer_height",
+		sqlCreateNFTTradeTable,
+		"CREATE TABLE IF NOT EXISTS nft_sell_trade_new AS nft_sell_trade",
+		SqlCreateNFTAuctionTable,
+		"CREATE TABLE IF NOT EXISTS nft_auction_event_new AS nft_auction_event",
+		SqlCreateSwapCandleTable,
+		"CREATE TABLE IF NOT EXISTS swap_candle_new AS swap_candle",
+		sqlCreateStatRichListTable,
+		sqlCreateStatGenesisHolderTable,
+		sqlCreateStatAddressTable,
+		sqlCreateStatUtxoDistributionTable,
+		sqlCreateStatActiveAddressTable,
 	}
 
 	// 更新现有基础数据表txin、txout
+	// 曾被孤立的区块数据已存在，跳过
 	processPartSQLsForTxIn = []string{
-		"INSERT INTO txin SELECT * FROM txin_new",
+		"INSERT INTO txin SELECT * FROM txin_new WHERE " + sqlNotEverOrphan,
 		// 更新txo被花费的tx索引
-		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout FROM txin_new",
-		// 更新txo被花费的tx区块高度索引，注意这里并未清除孤立区块的数据
-		"INSERT INTO txout_spent_height SELECT height, substring(utxid, 1, 12), vout FROM txin_new ORDER BY utxid",
+		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout, blkid FROM txin_new WHERE " + sqlNotEverOrphan,
+		// 更新txo被花费的tx区块高度索引
+		"INSERT INTO txout_spent_height SELECT height, substring(utxid, 1, 12), vout, blkid FROM txin_new WHERE " + sqlNotEverOrphan + " ORDER BY utxid",
 
-		// 更新溯源ID参与输入的相关tx区块高度索引，注意这里并未清除孤立区块的数据
-		"INSERT INTO txin_genesis_height SELECT height, txidx, substring(txid, 1, 12), idx, address, codehash, genesis FROM txin_new WHERE codehash != '' ORDER BY codehash",
+		// 更新溯源ID参与输入的相关tx区块高度索引
+		"INSERT INTO txin_genesis_height SELECT height, txidx, substring(txid, 1, 12), idx, address, codehash, genesis, blkid FROM txin_new WHERE codehash != '' AND " + sqlNotEverOrphan + " ORDER BY codehash",
 
 		"DROP TABLE IF EXISTS txin_new",
 	}
 	processPartSQLsForTxOut = []string{
-		"INSERT INTO txout SELECT * FROM txout_new;",
+		"INSERT INTO txout SELECT * FROM txout_new WHERE " + sqlNotEverOrphan,
 
-		// 更新溯源ID参与的输出索引，注意这里并未清除孤立区块的数据
-		"INSERT INTO txout_genesis_height SELECT height, utxidx, substring(utxid, 1, 12), vout, address, codehash, genesis FROM txout_new WHERE codehash != '' ORDER BY codehash",
+		// 更新溯源ID参与的输出索引
+		"INSERT INTO txout_genesis_height SELECT height, utxidx, substring(utxid, 1, 12), vout, address, codehash, genesis, blkid FROM txout_new WHERE codehash != '' AND " + sqlNotEverOrphan + " ORDER BY codehash",
 
 		"DROP TABLE IF EXISTS txout_new",
 	}
 
 	processPartSQLs = []string{
-		"INSERT INTO blk_height SELECT * FROM blk_height_new;",
-		"INSERT INTO blk_codehash_height SELECT * FROM blk_codehash_height_new;",
-		"INSERT INTO blktx_contract_height SELECT * FROM blktx_contract_height_new;",
-		"INSERT INTO blktx_height SELECT * FROM blktx_height_new;",
+		// 曾被孤立的区块数据已存在，跳过
+		"INSERT INTO blk_height SELECT * FROM blk_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO blk_codehash_height SELECT * FROM blk_codehash_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO blktx_contract_height SELECT * FROM blktx_contract_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO blktx_height SELECT * FROM blktx_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO blk_ft_supply_height SELECT * FROM blk_ft_supply_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO ft_token SELECT * FROM ft_token_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO nft_transfer_height SELECT * FROM nft_transfer_height_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO nft_sell_trade SELECT * FROM nft_sell_trade_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO nft_auction_event SELECT * FROM nft_auction_event_new WHERE " + sqlNotEverOrphan,
+		"INSERT INTO swap_candle SELECT * FROM swap_candle_new WHERE " + sqlNotEverOrphan,
 
 		// 优化blk表，以便统一按height排序查询
 		// "OPTIMIZE TABLE blk_height FINAL",
 
 		// 更新区块id索引
-		"INSERT INTO blk SELECT * FROM blk_height_new",
+		"INSERT INTO blk SELECT * FROM blk_height_new WHERE " + sqlNotEverOrphan,
 
-		// 更新tx到区块高度索引，注意这里并未清除孤立区块的数据
-		"INSERT INTO tx_height SELECT substring(txid, 1, 12), height FROM blktx_height_new ORDER BY txid",
+		// 更新tx到区块高度索引
+		"INSERT INTO tx_height (txid, height, txidx, blkid) SELECT substring(txid, 1, 12), height, txidx, blkid FROM blktx_height_new WHERE " + sqlNotEverOrphan + " ORDER BY txid",
 
 		"DROP TABLE IF EXISTS blk_height_new",
 		"DROP TABLE IF EXISTS blk_codehash_height_new",
 		"DROP TABLE IF EXISTS blktx_contract_height_new",
 		"DROP TABLE IF EXISTS blktx_height_new",
+		"DROP TABLE IF EXISTS blk_ft_supply_height_new",
+		"DROP TABLE IF EXISTS ft_token_new",
+		"DROP TABLE IF EXISTS nft_transfer_height_new",
+		"DROP TABLE IF EXISTS nft_sell_trade_new",
+		"DROP TABLE IF EXISTS nft_auction_event_new",
+		"DROP TABLE IF EXISTS swap_candle_new",
 	}
 )
 
 func CreateAllSyncCk() bool {
 	logger.Log.Info("create sql: all")
-	return ProcessSyncCk(createAllSQLs)
+	if !ProcessSyncCk(createAllSQLs) {
+		return false
+	}
+	return markSchemaLatestCk()
 }
 
 func ProcessAllSyncCk() bool {
@@ -359,13 +597,14 @@ func ProcessAllSyncCk() bool {
 
 func RemoveOrphanPartSyncCk(startBlockHeight int) bool {
 	logger.Log.Info("remove sql: part")
-	removeOrphanPartSQLsWithHeight := []string{}
-	for _, psql := range removeOrphanPartSQLs {
-		removeOrphanPartSQLsWithHeight = append(removeOrphanPartSQLsWithHeight,
-			psql+strconv.Itoa(startBlockHeight),
-		)
+	if clickhouse.IsPostgres {
+		return removeOrphanPartSyncPg(startBlockHeight)
 	}
-	return ProcessSyncCk(removeOrphanPartSQLsWithHeight)
+	// 只标记孤块，不删除数据
+	return ProcessSyncCk([]string{
+		sqlCreateBlkOrphanTable,
+		markOrphanPartSQL + strconv.Itoa(startBlockHeight),
+	})
 }
 
 func CreatePartSyncCk() bool {
@@ -373,18 +612,10 @@ func CreatePartSyncCk() bool {
 	return ProcessSyncCk(createPartSQLs)
 }
 
-func ProcessPartSyncCk() bool {
-	logger.Log.Info("sync sql: part")
-	if !ProcessSyncCk(processPartSQLs) {
-		return false
-	}
-	if !ProcessSyncCk(processPartSQLsForTxIn) {
-		return false
-	}
-	return ProcessSyncCk(processPartSQLsForTxOut)
-}
-
 func ProcessSyncCk(processSQLs []string) bool {
+	if clickhouse.IsPostgres {
+		return ProcessSyncPg(processSQLs)
+	}
 	for _, psql := range processSQLs {
 		partLen := len(psql)
 		if partLen > 96 {
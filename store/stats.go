@@ -0,0 +1,181 @@
+package store
+
+import (
+	"fmt"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// 统计数据表，由后台任务定期生成，每次生成记录统计时的区块高度和blkid，查询时排除孤块，取最新高度
+
+// 地址BSV余额排行，balance为普通输出余额，contract_balance为合约输出余额
+const sqlCreateStatRichListTable string = `
+CREATE TABLE IF NOT EXISTS stat_rich_list (
+	height           UInt32,
+	address          String,
+	balance          UInt64,
+	contract_balance UInt64,
+	blkid            FixedString(32)
+) engine=MergeTree()
+ORDER BY (height, address)
+PARTITION BY intDiv(height, 2100)
+`
+
+// 各ft/nft持有人排行，ft为数量，nft为个数
+const sqlCreateStatGenesisHolderTable string = `
+CREATE TABLE IF NOT EXISTS stat_genesis_holder (
+	height       UInt32,
+	codehash     String,
+	genesis      String,
+	code_type    UInt32,
+	address      String,
+	balance      UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (codehash, genesis, height, address)
+PARTITION BY intDiv(height, 2100)
+`
+
+// 地址汇总，余额不为0的地址数量、可识别地址的utxo总数
+const sqlCreateStatAddressTable string = `
+CREATE TABLE IF NOT EXISTS stat_address (
+	height       UInt32,
+	addresses    UInt64,
+	utxos        UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY height
+`
+
+// 地址utxo数量分布，bucket为utxo数量下限: 1, 10, 100...
+const sqlCreateStatUtxoDistributionTable string = `
+CREATE TABLE IF NOT EXISTS stat_utxo_distribution (
+	height       UInt32,
+	bucket       UInt64,
+	addresses    UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (height, bucket)
+`
+
+// 每日活跃地址数量，只重新统计最近的日期，同一日期取最新高度
+const sqlCreateStatActiveAddressTable string = `
+CREATE TABLE IF NOT EXISTS stat_active_address (
+	height       UInt32,
+	day          Date,
+	addresses    UInt64,
+	blkid        FixedString(32)
+) engine=MergeTree()
+ORDER BY (day, height)
+`
+
+var (
+	statTables = []string{
+		"stat_rich_list",
+		"stat_genesis_holder",
+		"stat_address",
+		"stat_utxo_distribution",
+		"stat_active_address",
+	}
+
+	createStatSQLs = []string{
+		sqlCreateStatRichListTable,
+		sqlCreateStatGenesisHolderTable,
+		sqlCreateStatAddressTable,
+		sqlCreateStatUtxoDistributionTable,
+		sqlCreateStatActiveAddressTable,
+	}
+)
+
+// 地址在height(含)的余额变化，txout增加、txin减少
+const sqlAddressValuePattern string = `
+   SELECT address, code_type, toInt64(satoshi) AS value, toInt64(1) AS utxo FROM txout
+      WHERE address != '' AND height <= %d AND ` + SqlNotOrphan + `
+   UNION ALL
+   SELECT address, code_type, -toInt64(satoshi) AS value, toInt64(-1) AS utxo FROM txin
+      WHERE address != '' AND height <= %d AND ` + SqlNotOrphan
+
+// RefreshStatsCk 生成height高度的统计数据，每日活跃地址从dayStartHeight开始重新统计，需为某日的第一个区块
+func RefreshStatsCk(height, dayStartHeight, topN int) bool {
+	logger.Log.Info("refresh stats", zap.Int("height", height), zap.Int("dayStart", dayStartHeight))
+	if clickhouse.IsPostgres {
+		logger.Log.Error("stats not supported on postgres")
+		return false
+	}
+
+	if !ProcessSyncCk(createStatSQLs) {
+		return false
+	}
+	blkIdHex, ok := mainBlkIdCk(height)
+	if !ok {
+		return false
+	}
+	blkId := fmt.Sprintf("unhex('%s')", blkIdHex)
+
+	// 上次统计中断后重复统计同一区块，先删除旧数据。重组后的新区块blkid不同，无需删除
+	sqls := []string{}
+	for _, table := range statTables {
+		sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s DELETE WHERE height = %d AND blkid = %s", table, height, blkId))
+	}
+
+	addressValue := fmt.Sprintf(sqlAddressValuePattern, height, height)
+	sqls = append(sqls,
+		fmt.Sprintf(`
+INSERT INTO stat_rich_list
+SELECT %d, address, toUInt64(sumIf(value, code_type = %d)), toUInt64(sumIf(value, code_type != %d)), %s FROM (%s
+) GROUP BY address
+   HAVING sum(value) > 0
+   ORDER BY sum(value) DESC
+   LIMIT %d`, height, scriptDecoder.CodeType_NONE, scriptDecoder.CodeType_NONE, blkId, addressValue, topN),
+
+		fmt.Sprintf(`
+INSERT INTO stat_address
+SELECT %d, countIf(balance > 0), toUInt64(sum(utxos)), %s FROM (
+   SELECT address, sum(value) AS balance, sum(utxo) AS utxos FROM (%s
+   ) GROUP BY address
+)`, height, blkId, addressValue),
+
+		fmt.Sprintf(`
+INSERT INTO stat_utxo_distribution
+SELECT %d, toUInt64(exp10(floor(log10(utxos)))) AS bucket, count(), %s FROM (
+   SELECT address, sum(utxo) AS utxos FROM (%s
+   ) GROUP BY address
+   HAVING utxos > 0
+) GROUP BY bucket`, height, blkId, addressValue),
+
+		fmt.Sprintf(`
+INSERT INTO stat_genesis_holder
+SELECT %d, codehash, genesis, any(code_type), address, toUInt64(sum(value)) AS balance, %s FROM (
+   SELECT codehash, genesis, code_type, address, if(code_type = %d, toInt64(1), toInt64(data_value)) AS value FROM txout
+      WHERE code_type IN (%d, %d) AND address != '' AND height <= %d AND %s
+   UNION ALL
+   SELECT codehash, genesis, code_type, address, if(code_type = %d, toInt64(-1), -toInt64(data_value)) AS value FROM txin
+      WHERE code_type IN (%d, %d) AND address != '' AND height <= %d AND %s
+) GROUP BY codehash, genesis, address
+   HAVING balance > 0
+   ORDER BY codehash, genesis, balance DESC
+   LIMIT %d BY codehash, genesis`, height, blkId,
+			scriptDecoder.CodeType_NFT, scriptDecoder.CodeType_FT, scriptDecoder.CodeType_NFT, height, SqlNotOrphan,
+			scriptDecoder.CodeType_NFT, scriptDecoder.CodeType_FT, scriptDecoder.CodeType_NFT, height, SqlNotOrphan,
+			topN),
+
+		// 从上次统计的区块所在日期开始重新统计
+		fmt.Sprintf(`
+INSERT INTO stat_active_address
+SELECT %d, day, uniqExact(address), %s FROM (
+   SELECT height, address FROM txout WHERE address != '' AND height >= %d AND height <= %d AND %s
+   UNION ALL
+   SELECT height, address FROM txin WHERE address != '' AND height >= %d AND height <= %d AND %s
+) AS t INNER JOIN (
+   SELECT height, toDate(blocktime) AS day FROM blk_height WHERE height >= %d AND height <= %d AND %s
+) AS b USING height
+GROUP BY day`, height, blkId,
+			dayStartHeight, height, SqlNotOrphan,
+			dayStartHeight, height, SqlNotOrphan,
+			dayStartHeight, height, SqlNotOrphan),
+	)
+	return ProcessSyncCk(sqls)
+}
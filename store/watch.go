@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sensibled/logger"
+	"sensibled/prune"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 已生效的关注列表，用于生成*_genesis_height索引时过滤。重启后与配置比较，补全或清理变化的部分
+const sqlCreateWatchListTable string = `
+CREATE TABLE IF NOT EXISTS watch_list (
+	entry        String,
+	address      String,
+	genesis      String
+) engine=MergeTree()
+ORDER BY entry
+`
+
+const (
+	// 只为关注的地址、genesis生成*_genesis_height索引
+	sqlWatchListFilter = "(address IN (SELECT address FROM watch_list WHERE address != '') OR genesis IN (SELECT genesis FROM watch_list WHERE genesis != ''))"
+
+	// 关注列表变化时，每批处理的地址、genesis数量
+	watchKeysBatch = 500
+)
+
+// 迁移v8之前写入的高度索引行blkid为空
+var sqlEmptyBlkId = "unhex('" + strings.Repeat("0", 64) + "')"
+
+// EnableWatchListFilterCk 设置关注列表后，*_genesis_height只记录关注的地址和genesis。需在同步开始前执行
+func EnableWatchListFilterCk() {
+	for _, sqls := range [][]string{processAllSQLs, processPartSQLsForTxIn, processPartSQLsForTxOut} {
+		for idx, psql := range sqls {
+			if strings.Contains(psql, "_genesis_height SELECT") {
+				sqls[idx] = strings.Replace(psql, "WHERE codehash != ''", "WHERE codehash != '' AND "+sqlWatchListFilter, 1)
+			}
+		}
+	}
+	partSteps = expandPartSteps(processPartSQLs, processPartSQLsForTxIn, processPartSQLsForTxOut)
+}
+
+// WatchKeysCondition 匹配地址或genesis的查询条件
+func WatchKeysCondition(addresses, genesis []string) string {
+	conds := make([]string, 0, 2)
+	for _, item := range []struct {
+		column string
+		keys   []string
+	}{{"address", addresses}, {"genesis", genesis}} {
+		if len(item.keys) == 0 {
+			continue
+		}
+		values := make([]string, len(item.keys))
+		for idx, key := range item.keys {
+			values[idx] = fmt.Sprintf("unhex('%s')", hex.EncodeToString([]byte(key)))
+		}
+		conds = append(conds, fmt.Sprintf("%s IN (%s)", item.column, strings.Join(values, ", ")))
+	}
+	if len(conds) == 0 {
+		return "0 = 1"
+	}
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
+
+// SplitWatchKeys 将变化的地址、genesis分批处理，避免sql过长
+func SplitWatchKeys(addresses, genesis []string, fn func(addresses, genesis []string) bool) bool {
+	for len(addresses) > 0 || len(genesis) > 0 {
+		nAddr := len(addresses)
+		if nAddr > watchKeysBatch {
+			nAddr = watchKeysBatch
+		}
+		nGenesis := len(genesis)
+		if nGenesis > watchKeysBatch-nAddr {
+			nGenesis = watchKeysBatch - nAddr
+		}
+		if !fn(addresses[:nAddr], genesis[:nGenesis]) {
+			return false
+		}
+		addresses = addresses[nAddr:]
+		genesis = genesis[nGenesis:]
+	}
+	return true
+}
+
+// SaveWatchListCk 记录已生效的关注列表
+func SaveWatchListCk(w *prune.WatchList) bool {
+	sqls := []string{sqlCreateWatchListTable, "TRUNCATE TABLE watch_list"}
+	values := make([]string, 0, watchKeysBatch)
+	flush := func() {
+		if len(values) > 0 {
+			sqls = append(sqls, "INSERT INTO watch_list (entry, address, genesis) VALUES "+strings.Join(values, ", "))
+			values = values[:0]
+		}
+	}
+	for _, item := range w.Items {
+		values = append(values, fmt.Sprintf("('%s', unhex('%s'), unhex('%s'))",
+			item.Entry, hex.EncodeToString([]byte(item.Address)), hex.EncodeToString([]byte(item.Genesis))))
+		if len(values) == watchKeysBatch {
+			flush()
+		}
+	}
+	flush()
+	return ProcessSyncCk(sqls)
+}
+
+// DropWatchListCk 未设置关注列表时全量同步，清除已生效的关注列表
+func DropWatchListCk() bool {
+	return ProcessSyncCk([]string{"DROP TABLE IF EXISTS watch_list"})
+}
+
+// UpdateWatchGenesisHeightCk 关注列表变化后，重新生成涉及变化地址、genesis的*_genesis_height索引，需在SaveWatchListCk之后执行。
+// 删除只影响已存在的数据，不会删除之后插入的索引
+func UpdateWatchGenesisHeightCk(addresses, genesis []string) bool {
+	return SplitWatchKeys(addresses, genesis, func(addresses, genesis []string) bool {
+		cond := WatchKeysCondition(addresses, genesis)
+		return ProcessSyncCk([]string{
+			"ALTER TABLE txout_genesis_height DELETE WHERE " + cond,
+			"ALTER TABLE txin_genesis_height DELETE WHERE " + cond,
+			"INSERT INTO txout_genesis_height SELECT height, utxidx, substring(utxid, 1, 12), vout, address, codehash, genesis, blkid FROM txout WHERE codehash != '' AND " +
+				cond + " AND " + sqlWatchListFilter,
+			"INSERT INTO txin_genesis_height SELECT height, txidx, substring(txid, 1, 12), idx, address, codehash, genesis, blkid FROM txin WHERE codehash != '' AND " +
+				cond + " AND " + sqlWatchListFilter,
+		})
+	})
+}
+
+// 只索引token时，新关注地址之前的无关tx未写入db，从blk文件补全的数据先写入暂存表，扫描完成后合并。
+// 合并时跳过目标表中已存在的行，中断后重新补全不会重复插入。迁移前写入的高度索引blkid为空，同样视为已存在
+var (
+	createWatchBackfillSQLs = []string{
+		"DROP TABLE IF EXISTS blktx_height_watch",
+		"DROP TABLE IF EXISTS txout_watch",
+		"DROP TABLE IF EXISTS txin_watch",
+		"CREATE TABLE IF NOT EXISTS blktx_height_watch AS blktx_height",
+		"CREATE TABLE IF NOT EXISTS txout_watch AS txout",
+		"CREATE TABLE IF NOT EXISTS txin_watch AS txin",
+	}
+
+	processWatchBackfillSQLs = []string{
+		"INSERT INTO blktx_height SELECT * FROM blktx_height_watch WHERE (txid, blkid) NOT IN (SELECT txid, blkid FROM blktx_height WHERE height IN (SELECT height FROM blktx_height_watch))",
+		"INSERT INTO tx_height (txid, height, txidx, blkid) SELECT substring(txid, 1, 12), height, txidx, blkid FROM blktx_height_watch WHERE (substring(txid, 1, 12), blkid) NOT IN (SELECT txid, blkid FROM tx_height WHERE height IN (SELECT height FROM blktx_height_watch)) AND (substring(txid, 1, 12), height) NOT IN (SELECT txid, height FROM tx_height WHERE blkid = " + sqlEmptyBlkId + ") ORDER BY txid",
+
+		"INSERT INTO txout SELECT * FROM txout_watch WHERE (utxid, vout, blkid) NOT IN (SELECT utxid, vout, blkid FROM txout WHERE height IN (SELECT height FROM txout_watch))",
+
+		"INSERT INTO txin SELECT * FROM txin_watch WHERE (txid, idx, blkid) NOT IN (SELECT txid, idx, blkid FROM txin WHERE height IN (SELECT height FROM txin_watch))",
+		"INSERT INTO txin_spent SELECT height, txid, idx, substring(utxid, 1, 12), vout, blkid FROM txin_watch WHERE (txid, idx, blkid) NOT IN (SELECT txid, idx, blkid FROM txin_spent WHERE height IN (SELECT height FROM txin_watch)) AND (txid, idx) NOT IN (SELECT txid, idx FROM txin_spent WHERE blkid = " + sqlEmptyBlkId + " AND height IN (SELECT height FROM txin_watch))",
+		"INSERT INTO txout_spent_height SELECT height, substring(utxid, 1, 12), vout, blkid FROM txin_watch WHERE (substring(utxid, 1, 12), vout, blkid) NOT IN (SELECT utxid, vout, blkid FROM txout_spent_height WHERE height IN (SELECT height FROM txin_watch)) AND (substring(utxid, 1, 12), vout) NOT IN (SELECT utxid, vout FROM txout_spent_height WHERE blkid = " + sqlEmptyBlkId + " AND height IN (SELECT height FROM txin_watch)) ORDER BY utxid",
+
+		"DROP TABLE IF EXISTS blktx_height_watch",
+		"DROP TABLE IF EXISTS txout_watch",
+		"DROP TABLE IF EXISTS txin_watch",
+	}
+)
+
+// PrepareWatchBackfillCk 创建补全暂存表，tx、txin、txout改为写入暂存表。之后的同步需重新PreparePartSyncCk
+func PrepareWatchBackfillCk() bool {
+	if !ProcessSyncCk(createWatchBackfillSQLs) {
+		return false
+	}
+	SyncStmtTx = NewBatchWriter(fmt.Sprintf(sqlTxPattern, "blktx_height_watch"))
+	SyncStmtTxOut = NewBatchWriter(fmt.Sprintf(sqlTxOutPattern, "txout_watch"))
+	SyncStmtTxIn = NewBatchWriter(fmt.Sprintf(sqlTxInPattern, "txin_watch"))
+	return true
+}
+
+// CommitWatchBackfillCk 发送暂存表剩余的缓存行，合并到各表
+func CommitWatchBackfillCk() bool {
+	for _, w := range []*BatchWriter{SyncStmtTx, SyncStmtTxOut, SyncStmtTxIn} {
+		if err := w.Flush(); err != nil {
+			logger.Log.Error("watch backfill commit", zap.String("table", w.table), zap.Error(err))
+			return false
+		}
+	}
+	return ProcessSyncCk(processWatchBackfillSQLs)
+}
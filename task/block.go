@@ -7,8 +7,10 @@ import (
 	memTask "sensibled/mempool/task"
 	memSerial "sensibled/mempool/task/serial"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
 	"sensibled/store"
+	"sensibled/task/meta"
 	"sensibled/task/parallel"
 	"sensibled/task/serial"
 	"sync"
@@ -55,7 +57,10 @@ func ParseBlockParallel(block *model.Block) {
 	}
 
 	// DB更新txout，比较独立，可以并行更新
-	serial.SyncBlockTxOutputInfo(block)
+	// 只索引token时，需要先依赖txin的utxo信息确定相关tx
+	if !prune.IsTokenOnly {
+		serial.SyncBlockTxOutputInfo(block)
+	}
 }
 
 // ParseBlockSerialStart 再串行处理区块
@@ -66,9 +71,31 @@ func ParseBlockSerialStart(withMempool bool, block *model.Block) {
 	// 从redis中补全查询当前block内所有Tx花费的utxo信息来使用
 	serial.ParseGetSpentUtxoDataFromRedisSerial(block.ParseData)
 
+	if prune.IsTokenOnly {
+		// 标记相关tx，依赖txin的utxo信息
+		serial.MarkIndexedTxSerial(block)
+		// DB更新txout
+		serial.SyncBlockTxOutputInfo(block)
+	}
+
 	// DB更新txin，需要前序和当前区块的txout处理完毕，且依赖从redis查来的utxo。
 	serial.SyncBlockTxInputDetail(block)
 
+	// DB更新ft增发、销毁记录，依赖txin的utxo信息
+	serial.SyncBlockFTSupply(block)
+
+	// DB更新ft登记信息，依赖txin的utxo信息
+	if model.GlobalFTTokenRegistry == nil {
+		loadFTTokenRegistry()
+	}
+	serial.SyncBlockFTToken(block)
+
+	// DB更新nft拍卖状态变化，依赖txin的utxo信息
+	serial.SyncBlockNFTAuction(block)
+
+	// DB更新swap池K线，依赖txin的utxo信息
+	serial.SyncBlockSwapCandle(block)
+
 	// 需要串行，更新当前区块的utxo信息变化到程序内存缓存
 	serial.UpdateUtxoInMapSerial(block.ParseData)
 
@@ -76,6 +103,16 @@ func ParseBlockSerialStart(withMempool bool, block *model.Block) {
 	serial.UpdateAddrPkhInTxMapSerial(block.ParseData.Height, block.ParseData.AddrPkhInTxMap)
 }
 
+// loadFTTokenRegistry 从db加载已登记的ft，启动或重组后执行
+func loadFTTokenRegistry() {
+	tokens, err := loader.GetFTTokens()
+	if err != nil {
+		// 旧数据库可能尚无此表
+		logger.Log.Error("load ft token registry failed", zap.Error(err))
+	}
+	model.InitFTTokenRegistry(tokens)
+}
+
 // ParseBlockParallelEnd 再并行处理区块
 func ParseBlockParallelEnd(block *model.Block) {
 	// DB更新block, 需要依赖txout、txin执行完毕，以统计区块Fee
@@ -83,6 +120,8 @@ func ParseBlockParallelEnd(block *model.Block) {
 	// DB更新tx, 需要依赖txout、txin执行完毕，以统计Tx Fee
 	serial.SyncBlockTx(block)
 	serial.SyncBlockTxContract(block)
+	// DB更新nft转移历史, 依赖txin的utxo信息
+	serial.SyncBlockNFTTransfer(block)
 
 	block.Txs = nil
 	block.ParseData = nil
@@ -106,6 +145,9 @@ func ParseEnd(isFull bool) bool {
 func RemoveBlocksForReorg(startBlockHeight int) bool {
 	// 在更新之前，如果有上次已导入但是当前被孤立的块，需要先删除这些块的数据。
 	logger.Log.Info("remove...")
+	// 避免统计结果写入被孤立的高度
+	waitStats()
+
 	utxoToRestore, err := loader.GetSpentUTXOAfterBlockHeight(startBlockHeight, 0) // 已花费的utxo需要回滚
 	if err != nil {
 		logger.Log.Error("get utxo to restore failed", zap.Error(err))
@@ -116,6 +158,31 @@ func RemoveBlocksForReorg(startBlockHeight int) bool {
 		logger.Log.Error("get utxo to remove failed", zap.Error(err))
 		return false
 	}
+	ftSupplyToRevert, err := loader.GetFTSupplyAfterBlockHeight(startBlockHeight) // ft增发、销毁需要回滚
+	if err != nil {
+		logger.Log.Error("get ft supply to revert failed", zap.Error(err))
+		return false
+	}
+	ftTokenToRemove, err := loader.GetFTTokensAfterBlockHeight(startBlockHeight) // ft登记需要回滚
+	if err != nil {
+		logger.Log.Error("get ft token to remove failed", zap.Error(err))
+		return false
+	}
+	auctionIdsToRestore, auctionToRestore, err := loader.GetNFTAuctionBeforeBlockHeight(startBlockHeight) // nft拍卖状态需要回滚
+	if err != nil {
+		logger.Log.Error("get nft auction to restore failed", zap.Error(err))
+		return false
+	}
+	swapPoolsToRestore, swapReserveToRestore, err := loader.GetSwapReserveBeforeBlockHeight(startBlockHeight) // swap池储备需要回滚
+	if err != nil {
+		logger.Log.Error("get swap reserve to restore failed", zap.Error(err))
+		return false
+	}
+	metaToRequeue, err := meta.GetTokensToRequeue(startBlockHeight) // nft元数据需要重新解析
+	if err != nil {
+		logger.Log.Error("get nft meta to requeue failed", zap.Error(err))
+		return false
+	}
 
 	var wg sync.WaitGroup
 	// ck
@@ -123,8 +190,12 @@ func RemoveBlocksForReorg(startBlockHeight int) bool {
 	go func() {
 		defer wg.Done()
 
-		// 清除db
-		store.RemoveOrphanPartSyncCk(startBlockHeight)
+		// 标记db中的孤块，失败则孤块数据会一直可见
+		if ok := store.RemoveOrphanPartSyncCk(startBlockHeight); !ok {
+			logger.Log.Error("mark orphan blocks failed")
+			model.NeedStop = true
+			return
+		}
 		model.CleanConfirmedTxMap(true)
 
 		logger.Log.Info("ck done")
@@ -159,6 +230,11 @@ func RemoveBlocksForReorg(startBlockHeight int) bool {
 		rdsPipe := rdb.RdbBalanceClient.TxPipeline()
 		addressBalanceCmds := make(map[string]*redis.IntCmd, 0)
 		serial.UpdateUtxoInRedis(rdsPipe, startBlockHeight, addressBalanceCmds, utxoToRestore, utxoToRemove, true)
+		serial.UpdateFTSupplyInRedis(rdsPipe, ftSupplyToRevert, true)
+		serial.RemoveFTTokenInRedis(rdsPipe, ftTokenToRemove)
+		serial.RestoreNFTAuctionInRedis(rdsPipe, auctionIdsToRestore, auctionToRestore)
+		serial.RestoreSwapReserveInRedis(rdsPipe, swapPoolsToRestore, swapReserveToRestore)
+		meta.RequeueInRedis(rdsPipe, metaToRequeue)
 		if _, err = rdsPipe.Exec(ctx); err != nil {
 			logger.Log.Error("redis exec failed", zap.Error(err))
 			model.NeedStop = true
@@ -172,6 +248,9 @@ func RemoveBlocksForReorg(startBlockHeight int) bool {
 	}()
 	wg.Wait()
 
+	// ft登记表需要重新加载
+	model.GlobalFTTokenRegistry = nil
+
 	if model.NeedStop {
 		return false
 	}
@@ -199,7 +278,8 @@ func SubmitBlocksWithoutMempool(isFull bool, stageBlockHeight int) {
 	go func() {
 		defer wg.Done()
 
-		if ok := memSerial.UpdateUtxoInPika(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap); !ok {
+		if ok := model.RangeUtxoChunks(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap,
+			model.UtxoCacheChunkSize, memSerial.UpdateUtxoInPika); !ok {
 			model.NeedStop = true
 			return
 		}
@@ -213,8 +293,14 @@ func SubmitBlocksWithoutMempool(isFull bool, stageBlockHeight int) {
 		rdsPipe := rdb.RdbBalanceClient.TxPipeline()
 		addressBalanceCmds := make(map[string]*redis.IntCmd, 0)
 		// 批量更新redis utxo
-		serial.UpdateUtxoInRedis(rdsPipe, stageBlockHeight, addressBalanceCmds,
-			model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap, false)
+		if ok := serial.UpdateUtxoCacheInRedis(rdsPipe, stageBlockHeight, addressBalanceCmds, isFull); !ok {
+			model.NeedStop = true
+			return
+		}
+		serial.UpdateFTSupplyInRedis(rdsPipe, model.GlobalFTSupplyMap, false)
+		serial.UpdateFTTokenInRedis(rdsPipe, model.GlobalNewFTTokenMap)
+		serial.UpdateNFTAuctionInRedis(rdsPipe, model.GlobalNFTAuctionMap)
+		serial.UpdateSwapReserveInRedis(rdsPipe, model.GlobalSwapReserveMap)
 		if _, err := rdsPipe.Exec(ctx); err != nil {
 			logger.Log.Error("redis exec failed", zap.Error(err))
 			model.NeedStop = true
@@ -245,7 +331,7 @@ func SubmitBlocksWithMempool(isFull bool, stageBlockHeight int, mempool *memTask
 		defer wg.Done()
 
 		if needSaveMempool {
-			needReset := true
+			needReset := mempool.IsFullReload
 			if ok := memSerial.SaveAddressTxHistoryIntoPika(needReset, mempool.AddrPkhInTxMap); !ok {
 				model.NeedStop = true
 				return
@@ -283,7 +369,8 @@ func SubmitBlocksWithMempool(isFull bool, stageBlockHeight int, mempool *memTask
 
 		// 批量更新redis utxo
 		if needSaveBlock {
-			if ok := memSerial.UpdateUtxoInPika(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap); !ok {
+			if ok := model.RangeUtxoChunks(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap,
+				model.UtxoCacheChunkSize, memSerial.UpdateUtxoInPika); !ok {
 				model.NeedStop = true
 				return
 			}
@@ -307,16 +394,23 @@ func SubmitBlocksWithMempool(isFull bool, stageBlockHeight int, mempool *memTask
 		addressBalanceCmds := make(map[string]*redis.IntCmd, 0)
 		if needSaveBlock {
 			// 批量更新redis utxo
-			serial.UpdateUtxoInRedis(rdsPipe, stageBlockHeight, addressBalanceCmds,
-				model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap, false)
-
+			if ok := serial.UpdateUtxoCacheInRedis(rdsPipe, stageBlockHeight, addressBalanceCmds, isFull); !ok {
+				model.NeedStop = true
+				return
+			}
+			serial.UpdateFTSupplyInRedis(rdsPipe, model.GlobalFTSupplyMap, false)
+			serial.UpdateFTTokenInRedis(rdsPipe, model.GlobalNewFTTokenMap)
+			serial.UpdateNFTAuctionInRedis(rdsPipe, model.GlobalNFTAuctionMap)
+			serial.UpdateSwapReserveInRedis(rdsPipe, model.GlobalSwapReserveMap)
 		}
 		// for txin dump
 		// 6 dep 2 4
-		initSyncMempool := true
 		if needSaveMempool {
-			memSerial.UpdateUtxoInRedis(rdsPipe, initSyncMempool,
+			needReset := mempool.IsFullReload
+			memSerial.UpdateUtxoInRedis(rdsPipe, needReset,
 				mempool.NewUtxoDataMap, mempool.RemoveUtxoDataMap, mempool.SpentUtxoDataMap)
+			memSerial.UpdateNFTAuctionInRedis(rdsPipe, mempool.NFTAuctionMap)
+			memSerial.UpdateSwapReserveInRedis(rdsPipe, mempool.SwapReserveMap)
 		}
 		if _, err := rdsPipe.Exec(ctx); err != nil {
 			logger.Log.Error("redis exec failed", zap.Error(err))
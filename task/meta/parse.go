@@ -0,0 +1,215 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sensibled/utils"
+	"strings"
+)
+
+const (
+	OP_0         = 0x00
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_PUSHDATA4 = 0x4e
+	OP_RETURN    = 0x6a
+
+	PREFIX_B   = "19HxigV4QyBv3tHpQVcUEQyq1pzZVdoAut" // B:// 协议
+	PREFIX_MAP = "1PuQa7K62MiKCtssSLKy1kh56WWU7MtUR5" // MAP 协议
+)
+
+// Metadata nft元数据
+type Metadata struct {
+	Name        string
+	Description string
+	Image       string
+	ContentType string
+}
+
+func (m *Metadata) IsEmpty() bool {
+	return m.Name == "" && m.Description == "" && m.Image == "" && m.ContentType == ""
+}
+
+// parsePushes 解析OP_RETURN之后的数据push，遇到非push操作码则停止
+func parsePushes(script []byte) (pushes [][]byte) {
+	idx := bytes.IndexByte(script, OP_RETURN)
+	if idx < 0 {
+		return nil
+	}
+	script = script[idx+1:]
+
+	for len(script) > 0 {
+		op := script[0]
+		script = script[1:]
+
+		var size int
+		switch {
+		case op == OP_0:
+			size = 0
+		case op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if len(script) < 1 {
+				return pushes
+			}
+			size = int(script[0])
+			script = script[1:]
+		case op == OP_PUSHDATA2:
+			if len(script) < 2 {
+				return pushes
+			}
+			size = int(binary.LittleEndian.Uint16(script))
+			script = script[2:]
+		case op == OP_PUSHDATA4:
+			if len(script) < 4 {
+				return pushes
+			}
+			size = int(binary.LittleEndian.Uint32(script))
+			script = script[4:]
+		default:
+			return pushes
+		}
+		if size > len(script) {
+			return pushes
+		}
+		pushes = append(pushes, script[:size])
+		script = script[size:]
+	}
+	return pushes
+}
+
+// splitProtocols 按"|"分割多个协议段
+func splitProtocols(pushes [][]byte) (segments [][][]byte) {
+	segment := make([][]byte, 0)
+	for _, push := range pushes {
+		if string(push) == "|" {
+			segments = append(segments, segment)
+			segment = make([][]byte, 0)
+			continue
+		}
+		segment = append(segment, push)
+	}
+	return append(segments, segment)
+}
+
+// parseJSON 从json对象中读取元数据字段
+func parseJSON(data []byte, meta *Metadata) bool {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &obj); err != nil {
+		return false
+	}
+	getString := func(keys ...string) string {
+		for _, key := range keys {
+			if value, ok := obj[key].(string); ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	meta.Name = getString("name")
+	meta.Description = getString("description", "desc")
+	meta.Image = getString("image", "icon", "uri")
+	if contentType := getString("content_type", "contentType", "type"); contentType != "" {
+		meta.ContentType = contentType
+	}
+	return true
+}
+
+// ParseMetadata 解析元数据输出的锁定脚本，支持OP_RETURN直接存放json、B://、MAP
+// txid为元数据tx，用于生成B://引用
+func ParseMetadata(script []byte, txid []byte) (meta *Metadata, ok bool) {
+	pushes := parsePushes(script)
+	if len(pushes) == 0 {
+		return nil, false
+	}
+
+	meta = &Metadata{}
+	for _, segment := range splitProtocols(pushes) {
+		if len(segment) == 0 {
+			continue
+		}
+		switch string(segment[0]) {
+		case PREFIX_B:
+			// B:// data media_type encoding filename
+			if len(segment) < 3 {
+				continue
+			}
+			mediaType := string(segment[2])
+			if strings.HasPrefix(mediaType, "application/json") {
+				parseJSON(segment[1], meta)
+				continue
+			}
+			meta.ContentType = mediaType
+			if meta.Image == "" {
+				meta.Image = "b://" + utils.HashString(txid)
+			}
+			if meta.Name == "" && len(segment) >= 5 {
+				meta.Name = string(segment[4])
+			}
+		case PREFIX_MAP:
+			// MAP SET key value key value ...
+			if len(segment) < 2 || string(segment[1]) != "SET" {
+				continue
+			}
+			for i := 2; i+1 < len(segment); i += 2 {
+				value := string(segment[i+1])
+				switch string(segment[i]) {
+				case "name":
+					meta.Name = value
+				case "description", "desc":
+					meta.Description = value
+				case "image", "icon", "uri":
+					meta.Image = value
+				case "content_type", "contentType", "type":
+					meta.ContentType = value
+				}
+			}
+		default:
+			// 直接存放json
+			for _, push := range segment {
+				if len(push) > 0 && push[0] == '{' && parseJSON(push, meta) {
+					break
+				}
+			}
+		}
+	}
+	if meta.IsEmpty() {
+		return nil, false
+	}
+	return meta, true
+}
+
+// txOutScript 从原始tx中读取指定输出的锁定脚本
+func txOutScript(rawtx []byte, vout uint32) (script []byte, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			script, ok = nil, false
+		}
+	}()
+
+	offset := uint(4)
+	txincnt, size := utils.DecodeVarIntForBlock(rawtx[offset:])
+	offset += size
+	for i := uint(0); i < txincnt; i++ {
+		offset += 36
+		scriptsig, size := utils.DecodeVarIntForBlock(rawtx[offset:])
+		offset += size + scriptsig + 4
+	}
+
+	txoutcnt, size := utils.DecodeVarIntForBlock(rawtx[offset:])
+	offset += size
+	if uint(vout) >= txoutcnt {
+		return nil, false
+	}
+	for i := uint(0); i < txoutcnt; i++ {
+		offset += 8
+		pkscript, size := utils.DecodeVarIntForBlock(rawtx[offset:])
+		offset += size
+		if i == uint(vout) {
+			return rawtx[offset : offset+pkscript], true
+		}
+		offset += pkscript
+	}
+	return nil, false
+}
@@ -0,0 +1,172 @@
+package meta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sensibled/loader"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/rdb"
+	"sensibled/utils"
+	"strconv"
+	"time"
+
+	memLoader "sensibled/mempool/loader"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// nmq: 集合，等待解析元数据的nft，member为tokenIndex(8 bytes LE) + codehash + genesis
+// nmh: 有序集合，已解析的nft，score为元数据tx高度，重组时据此重新解析
+const (
+	KEY_META_QUEUE  = "nmq"
+	KEY_META_HEIGHT = "nmh"
+
+	resolveBatch = 100
+)
+
+var ctx = context.Background()
+
+// metaNotify 元数据解析通知内容
+type metaNotify struct {
+	CodeHash    string `json:"codehash"`
+	Genesis     string `json:"genesis"`
+	TokenIndex  uint64 `json:"tokenIndex"`
+	Status      string `json:"status"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	ContentType string `json:"contentType"`
+}
+
+// StartResolver 后台解析nft元数据，需要在rpc初始化之后调用
+func StartResolver() {
+	go func() {
+		for {
+			if model.NeedStop {
+				return
+			}
+			members, err := rdb.RdbBalanceClient.SPopN(ctx, KEY_META_QUEUE, resolveBatch).Result()
+			if err != nil {
+				logger.Log.Info("pop nft meta queue failed", zap.Error(err))
+			}
+			if len(members) == 0 {
+				time.Sleep(time.Second * 5)
+				continue
+			}
+			for _, member := range members {
+				resolveToken(member)
+			}
+		}
+	}()
+}
+
+// resolveToken 解析一个nft的元数据，并保存到nI
+func resolveToken(member string) {
+	if len(member) <= 8+20 {
+		return
+	}
+	tokenIndex := binary.LittleEndian.Uint64([]byte(member[:8]))
+	codeHash := member[8 : 8+20]
+	genesisId := member[8+20:]
+	key := "nI" + codeHash + genesisId + strconv.Itoa(int(tokenIndex))
+
+	vals, err := rdb.RdbBalanceClient.HMGet(ctx, key, "metatxid", "metavout", "meta_status").Result()
+	if err != nil {
+		logger.Log.Info("get nft info failed", zap.Error(err))
+		return
+	}
+	metaTxId, ok := vals[0].(string)
+	if !ok || len(metaTxId) != 32 {
+		return
+	}
+	if status, ok := vals[2].(string); ok && status == "ok" {
+		return
+	}
+	metaVout := 0
+	if strVout, ok := vals[1].(string); ok {
+		metaVout, _ = strconv.Atoi(strVout)
+	}
+
+	// MetaTxId字节序不同版本不一致，两种都尝试
+	txids := [][]byte{[]byte(metaTxId), utils.ReverseBytes([]byte(metaTxId))}
+	script, txid, height := getMetaScript(txids, uint32(metaVout))
+
+	status := "missing"
+	meta, ok := ParseMetadata(script, txid)
+	if ok {
+		status = "ok"
+	} else {
+		meta = &Metadata{}
+		height = model.MEMPOOL_HEIGHT // 未找到，任意重组都重新解析
+	}
+
+	content, _ := json.Marshal(&metaNotify{
+		CodeHash:    hex.EncodeToString([]byte(codeHash)),
+		Genesis:     hex.EncodeToString([]byte(genesisId)),
+		TokenIndex:  tokenIndex,
+		Status:      status,
+		Name:        meta.Name,
+		Description: meta.Description,
+		Image:       meta.Image,
+		ContentType: meta.ContentType,
+	})
+
+	pipe := rdb.RdbBalanceClient.Pipeline()
+	pipe.HSet(ctx, key,
+		"name", meta.Name,
+		"desc", meta.Description,
+		"image", meta.Image,
+		"content_type", meta.ContentType,
+		"meta_status", status,
+		"meta_height", height,
+	)
+	pipe.ZAdd(ctx, KEY_META_HEIGHT, &redis.Z{Score: float64(height), Member: member})
+	pipe.Publish(ctx, "nft_meta", content)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Info("save nft meta failed", zap.Error(err))
+	}
+}
+
+// getMetaScript 查找元数据输出锁定脚本，db中已裁剪则通过rpc读取
+func getMetaScript(txids [][]byte, vout uint32) (script, txid []byte, height uint32) {
+	for _, txid := range txids {
+		scriptRsp, err := loader.GetTxOutScriptFromDB(txid, vout)
+		if err != nil || scriptRsp == nil {
+			continue
+		}
+		if len(scriptRsp.PkScript) > 0 && !bytes.Equal(scriptRsp.PkScript, model.FALSE_OP_RETURN) {
+			return scriptRsp.PkScript, txid, scriptRsp.Height
+		}
+		rawtx := memLoader.GetRawTxRPC(utils.HashString(txid))
+		if rawtx == nil {
+			continue
+		}
+		if script, ok := txOutScript(rawtx, vout); ok {
+			return script, txid, scriptRsp.Height
+		}
+	}
+	return nil, nil, 0
+}
+
+// GetTokensToRequeue 元数据tx在重组高度之后的nft
+func GetTokensToRequeue(startBlockHeight int) (members []string, err error) {
+	return rdb.RdbBalanceClient.ZRangeByScore(ctx, KEY_META_HEIGHT, &redis.ZRangeBy{
+		Min: strconv.Itoa(startBlockHeight),
+		Max: "+inf",
+	}).Result()
+}
+
+// RequeueInRedis 重组后重新解析元数据
+func RequeueInRedis(pipe redis.Pipeliner, members []string) {
+	for _, member := range members {
+		tokenIndex := binary.LittleEndian.Uint64([]byte(member[:8]))
+		pipe.HSet(ctx, "nI"+member[8:8+20]+member[8+20:]+strconv.Itoa(int(tokenIndex)), "meta_status", "")
+		pipe.SAdd(ctx, KEY_META_QUEUE, member)
+		pipe.ZRem(ctx, KEY_META_HEIGHT, member)
+	}
+}
@@ -2,6 +2,7 @@ package parallel
 
 import (
 	"encoding/binary"
+	"sensibled/contract"
 	"sensibled/model"
 	"sensibled/prune"
 
@@ -25,35 +26,14 @@ func ParseTxFirst(tx *model.Tx, isCoinbase bool, block *model.ProcessBlock) {
 		output.ScriptType = scriptDecoder.GetLockingScriptType(output.PkScript)
 		output.Data = scriptDecoder.ExtractPkScriptForTxo(output.PkScript, output.ScriptType)
 
-		if output.Data.CodeType == scriptDecoder.CodeType_NONE || output.Data.CodeType == scriptDecoder.CodeType_SENSIBLE {
+		if !contract.IsToken(output.Data) {
 			// not token
 			continue
 		}
 
 		// update token summary
-		buf := make([]byte, 12, 12+20+40)
-		binary.LittleEndian.PutUint32(buf, output.Data.CodeType)
-		if output.Data.CodeType == scriptDecoder.CodeType_NFT {
-			binary.LittleEndian.PutUint64(buf[4:], output.Data.NFT.TokenIndex)
-		} else if output.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			binary.LittleEndian.PutUint64(buf[4:], output.Data.NFTSell.TokenIndex)
-		}
-
-		buf = append(buf, output.Data.CodeHash[:]...)
-		buf = append(buf, output.Data.GenesisId[:output.Data.GenesisIdLen]...)
-
-		var tokenIndex uint64
-		var decimal uint8
-		switch output.Data.CodeType {
-		case scriptDecoder.CodeType_NFT:
-			tokenIndex = output.Data.NFT.TokenIndex
-		case scriptDecoder.CodeType_NFT_SELL:
-			tokenIndex = output.Data.NFTSell.TokenIndex
-		case scriptDecoder.CodeType_FT:
-			decimal = output.Data.FT.Decimal
-		}
-
-		tokenKey := string(buf)
+		tokenIndex, decimal, dataValue := contract.Get(output.Data.CodeType).TokenSummary(output.Data)
+		tokenKey := contract.TokenSummaryKey(output.Data, tokenIndex)
 
 		tokenSummary, ok := block.TokenSummaryMap[tokenKey]
 		if !ok {
@@ -68,7 +48,7 @@ func ParseTxFirst(tx *model.Tx, isCoinbase bool, block *model.ProcessBlock) {
 		}
 
 		tokenSummary.OutSatoshi += output.Satoshi
-		tokenSummary.OutDataValue += 1
+		tokenSummary.OutDataValue += dataValue
 	}
 }
 
@@ -105,7 +85,8 @@ func ParseUpdateNewUtxoInTxParallel(txIdx uint64, tx *model.Tx, block *model.Pro
 
 // ParseUpdateAddressInTxParallel address tx历史记录
 func ParseUpdateAddressInTxParallel(txIdx uint64, tx *model.Tx, block *model.ProcessBlock) {
-	if prune.IsHistoryPrune {
+	// 只索引token时，在确定tx是否相关后再记录
+	if prune.IsHistoryPrune || prune.IsTokenOnly {
 		return
 	}
 	for _, output := range tx.TxOuts {
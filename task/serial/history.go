@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sensibled/logger"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
 	"sort"
 	"time"
@@ -35,6 +36,10 @@ func UpdateAddrPkhInTxMapSerial(blockHeight uint32, addrPkhInTxMap map[string][]
 			logger.Log.Info("UpdateAddrPkhInTxMapSerial(1/2) pause ...")
 			time.Sleep(5 * time.Second)
 		}
+		// 未关注的地址不记录历史
+		if !prune.IsAddressWatched(strAddressPkh) {
+			continue
+		}
 
 		sort.Ints(listTxidx)
 		txZSetMembers := make([]*redis.Z, 0)
@@ -127,3 +132,27 @@ func RemoveAddressTxHistoryFromPikaForReorg(height int, utxoToRestore, utxoToRem
 		model.NeedStop = true
 	}
 }
+
+// UpdateWatchedAddressHistoryInPika 关注列表变化后，补全新关注地址的tx历史，清除取消关注地址的tx历史
+func UpdateWatchedAddressHistoryInPika(addressTxs []*model.AddressTxDO, addressesToRemove []string) bool {
+	logger.Log.Info("UpdateWatchedAddressHistoryInPika",
+		zap.Int("add", len(addressTxs)),
+		zap.Int("del", len(addressesToRemove)))
+
+	ctx := context.Background()
+	pikaPipe := rdb.RdbAddrTxClient.Pipeline()
+	for _, strAddressPkh := range addressesToRemove {
+		pikaPipe.Del(ctx, "{ah"+strAddressPkh+"}")
+	}
+	for _, addressTx := range addressTxs {
+		key := fmt.Sprintf("%d:%d", addressTx.Height, addressTx.TxIdx)
+		score := float64(uint64(addressTx.Height)*1000000000 + addressTx.TxIdx)
+		// 有序address tx history数据添加
+		pikaPipe.ZAdd(ctx, "{ah"+string(addressTx.AddressPkh)+"}", &redis.Z{Score: score, Member: key})
+	}
+	if _, err := pikaPipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Log.Error("pika address exec failed", zap.Error(err))
+		return false
+	}
+	return true
+}
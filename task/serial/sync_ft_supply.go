@@ -0,0 +1,115 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// SyncBlockFTSupply 统计区块内每个tx的ft增发、销毁数量，需要依赖txin的utxo信息
+// tx内同一ft的输出总量大于输入总量为增发，小于为销毁
+func SyncBlockFTSupply(block *model.Block) {
+	for txIdx, tx := range block.Txs {
+		if txIdx == 0 {
+			continue
+		}
+		for model.NeedPauseStage < 3 {
+			logger.Log.Info("SyncBlockFTSupply pause ...")
+			time.Sleep(5 * time.Second)
+		}
+
+		inAmount := make(map[string]uint64, 0)
+		outAmount := make(map[string]uint64, 0)
+		tokens := make(map[string]*model.FTSupplyData, 0)
+		for _, input := range tx.TxIns {
+			objData, ok := block.ParseData.SpentUtxoDataMap[input.InputOutpointKey]
+			if !ok || objData.Data.CodeType != scriptDecoder.CodeType_FT {
+				continue
+			}
+			key := addFTSupplyToken(tokens, objData.Data)
+			inAmount[key] += objData.Data.FT.Amount
+		}
+		for _, output := range tx.TxOuts {
+			if output.Data.CodeType != scriptDecoder.CodeType_FT {
+				continue
+			}
+			key := addFTSupplyToken(tokens, output.Data)
+			outAmount[key] += output.Data.FT.Amount
+		}
+
+		for key, token := range tokens {
+			var minted, burned uint64
+			if outAmount[key] > inAmount[key] {
+				minted = outAmount[key] - inAmount[key]
+			} else if outAmount[key] < inAmount[key] {
+				burned = inAmount[key] - outAmount[key]
+			} else {
+				continue
+			}
+
+			if _, err := store.SyncStmtFTSupply.Exec(
+				uint32(block.Height),
+				uint64(txIdx),
+				string(tx.TxId),
+				string(token.CodeHash),
+				string(token.GenesisId),
+				minted,
+				burned,
+				string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-ft-supply-err",
+					zap.String("sync", "ft supply err"),
+					zap.String("txid", tx.TxIdHex),
+					zap.String("err", err.Error()),
+				)
+			}
+
+			supply, ok := model.GlobalFTSupplyMap[key]
+			if !ok {
+				supply = &model.FTSupplyData{
+					CodeHash:  token.CodeHash,
+					GenesisId: token.GenesisId,
+				}
+				model.GlobalFTSupplyMap[key] = supply
+			}
+			supply.Minted += minted
+			supply.Burned += burned
+		}
+	}
+}
+
+func addFTSupplyToken(tokens map[string]*model.FTSupplyData, data *scriptDecoder.TxoData) string {
+	codehash := data.CodeHash[:]
+	genesis := data.GenesisId[:data.GenesisIdLen]
+	key := string(codehash) + string(genesis)
+	if _, ok := tokens[key]; !ok {
+		tokens[key] = &model.FTSupplyData{
+			CodeHash:  codehash,
+			GenesisId: genesis,
+		}
+	}
+	return key
+}
+
+// UpdateFTSupplyInRedis 更新ft增发、销毁、流通量，isReorg=true时回滚
+func UpdateFTSupplyInRedis(pipe redis.Pipeliner, ftSupplyMap map[string]*model.FTSupplyData, isReorg bool) {
+	ctx := context.Background()
+	for _, supply := range ftSupplyMap {
+		minted := int64(supply.Minted)
+		burned := int64(supply.Burned)
+		if isReorg {
+			minted, burned = -minted, -burned
+		}
+		strCodeHash := string(supply.CodeHash)
+		strGenesisId := string(supply.GenesisId)
+		pipe.HIncrBy(ctx, "fi"+strCodeHash+strGenesisId, "minted", minted)
+		pipe.HIncrBy(ctx, "fi"+strCodeHash+strGenesisId, "burned", burned)
+		pipe.HIncrBy(ctx, "fi"+strCodeHash+strGenesisId, "supply", minted-burned) // 流通量
+	}
+}
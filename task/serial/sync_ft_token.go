@@ -0,0 +1,126 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// spendsGenesis tx是否花费了SensibleId指向的genesis输出
+func spendsGenesis(tx *model.Tx, sensibleId []byte) bool {
+	if len(sensibleId) != 36 {
+		return false
+	}
+	for _, input := range tx.TxIns {
+		if input.InputOutpointKey == string(sensibleId) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncBlockFTToken 登记区块内首次出现的ft，需要依赖txin的utxo信息，以及已加载的ft登记表
+func SyncBlockFTToken(block *model.Block) {
+	for txIdx, tx := range block.Txs {
+		if txIdx == 0 {
+			continue
+		}
+		for _, output := range tx.TxOuts {
+			if output.Data.CodeType != scriptDecoder.CodeType_FT {
+				continue
+			}
+			ft := output.Data.FT
+			if model.IsEmptySensibleId(ft.SensibleId) {
+				continue // genesis合约，尚未发行
+			}
+			codeHash := output.Data.CodeHash[:]
+			genesisId := output.Data.GenesisId[:output.Data.GenesisIdLen]
+			key := string(codeHash) + string(genesisId)
+			if _, ok := model.GlobalFTTokenRegistry[key]; ok {
+				continue
+			}
+
+			token := &model.FTToken{
+				CodeHash:   codeHash,
+				GenesisId:  genesisId,
+				SensibleId: ft.SensibleId,
+				Name:       ft.Name,
+				Symbol:     ft.Symbol,
+				Decimal:    ft.Decimal,
+				Height:     uint32(block.Height),
+				TxIdx:      uint64(txIdx),
+				TxId:       tx.TxId,
+				Verified:   spendsGenesis(tx, ft.SensibleId),
+			}
+			if objData, ok := block.ParseData.SpentUtxoDataMap[tx.TxIns[0].InputOutpointKey]; ok && objData.Data.HasAddress {
+				token.IssuerPkh = objData.Data.AddressPkh[:]
+			}
+			model.RegisterFTToken(token)
+			model.GlobalNewFTTokenMap[key] = token
+
+			var verified, copycat uint8
+			if token.Verified {
+				verified = 1
+			}
+			if token.Copycat {
+				copycat = 1
+			}
+			if _, err := store.SyncStmtFTToken.Exec(
+				token.Height,
+				token.TxIdx,
+				string(token.TxId),
+				string(token.CodeHash),
+				string(token.GenesisId),
+				string(token.SensibleId),
+				token.Name,
+				token.Symbol,
+				token.Decimal,
+				string(token.IssuerPkh),
+				verified,
+				copycat,
+				string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-ft-token-err",
+					zap.String("txid", tx.TxIdHex),
+					zap.String("err", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// UpdateFTTokenInRedis 保存新登记ft的信息，以首次出现为准
+// fi<codehash><genesis>: 登记信息覆盖utxo中读到的名称等
+// ftr: 有序集合，已登记ft，score为首次出现高度
+func UpdateFTTokenInRedis(pipe redis.Pipeliner, tokens map[string]*model.FTToken) {
+	ctx := context.Background()
+	for key, token := range tokens {
+		pipe.HSet(ctx, "fi"+key,
+			"decimal", token.Decimal,
+			"name", token.Name,
+			"symbol", token.Symbol,
+			"sensibleid", token.SensibleId,
+			"genesis_txid", token.GenesisTxId(),
+			"first_height", token.Height,
+			"issuer", token.IssuerPkh,
+			"verified", token.Verified,
+			"copycat", token.Copycat,
+		)
+		pipe.ZAdd(ctx, "ftr", &redis.Z{Score: float64(token.Height), Member: key})
+	}
+}
+
+// RemoveFTTokenInRedis 回滚重组区块内登记的ft，重新确认时会再次登记
+func RemoveFTTokenInRedis(pipe redis.Pipeliner, tokens []*model.FTToken) {
+	ctx := context.Background()
+	for _, token := range tokens {
+		key := string(token.CodeHash) + string(token.GenesisId)
+		pipe.HDel(ctx, "fi"+key, "genesis_txid", "first_height", "issuer", "verified", "copycat")
+		pipe.ZRem(ctx, "ftr", key)
+	}
+}
@@ -0,0 +1,91 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// SyncBlockNFTAuction 记录区块内nft拍卖状态变化，需要依赖txin的utxo信息
+func SyncBlockNFTAuction(block *model.Block) {
+	getSpentTxo := func(outpointKey string) *model.TxoData {
+		return block.ParseData.SpentUtxoDataMap[outpointKey]
+	}
+	for txIdx, tx := range block.Txs {
+		if txIdx == 0 { // skip coinbase
+			continue
+		}
+		events := model.ParseNFTAuctionEvents(tx, getSpentTxo)
+		for idx, event := range events {
+			event.Height = uint32(block.Height)
+			event.TxId = tx.TxId
+			if _, err := store.SyncStmtNFTAuction.Exec(
+				uint32(block.Height),
+				block.BlockTime,
+				uint64(txIdx),
+				string(tx.TxId),
+				uint32(idx),
+				string(event.AuctionId),
+				string(event.CodeHash),
+				string(event.NFTCodeHash),
+				string(event.NFTID),
+				event.Event,
+				string(event.SenderPkh),
+				string(event.BidderPkh),
+				event.Price,
+				event.EndTimestamp,
+				event.Vout,
+				string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-nft-auction-err",
+					zap.String("txid", tx.TxIdHex),
+					zap.String("err", err.Error()),
+				)
+			}
+
+			if event.Event != model.NFT_AUCTION_OUTBID {
+				model.GlobalNFTAuctionMap[string(event.AuctionId)] = event
+			}
+		}
+	}
+}
+
+// SetNFTAuctionState 更新拍卖的最新状态
+// nai<auctionId>: status, sender, bidder, price, end, codehash, nft_codehash, nft_id, height, txid
+func SetNFTAuctionState(pipe redis.Pipeliner, key string, event *model.NFTAuctionEvent) {
+	ctx := context.Background()
+	pipe.HSet(ctx, key,
+		"status", event.Event,
+		"sender", event.SenderPkh,
+		"bidder", event.BidderPkh,
+		"price", event.Price,
+		"end", event.EndTimestamp,
+		"codehash", event.CodeHash,
+		"nft_codehash", event.NFTCodeHash,
+		"nft_id", event.NFTID,
+		"height", event.Height,
+		"txid", event.TxId,
+	)
+}
+
+// UpdateNFTAuctionInRedis 更新区块内拍卖的最新状态
+func UpdateNFTAuctionInRedis(pipe redis.Pipeliner, auctionMap map[string]*model.NFTAuctionEvent) {
+	for auctionId, event := range auctionMap {
+		SetNFTAuctionState(pipe, "nai"+auctionId, event)
+	}
+}
+
+// RestoreNFTAuctionInRedis 回滚区块重组影响的拍卖状态，没有之前状态的拍卖直接删除
+func RestoreNFTAuctionInRedis(pipe redis.Pipeliner, auctionIds []string, auctionMap map[string]*model.NFTAuctionEvent) {
+	ctx := context.Background()
+	for _, auctionId := range auctionIds {
+		pipe.Del(ctx, "nai"+auctionId)
+		if event, ok := auctionMap[auctionId]; ok {
+			SetNFTAuctionState(pipe, "nai"+auctionId, event)
+		}
+	}
+}
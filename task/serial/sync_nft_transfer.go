@@ -0,0 +1,193 @@
+package serial
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// nftTokenKey codehash + genesis + tokenIndex
+func nftTokenKey(data *scriptDecoder.TxoData, tokenIndex uint64) string {
+	buf := make([]byte, 8, 8+20+40)
+	binary.LittleEndian.PutUint64(buf, tokenIndex)
+	buf = append(buf, data.CodeHash[:]...)
+	buf = append(buf, data.GenesisId[:data.GenesisIdLen]...)
+	return string(buf)
+}
+
+// nftSellTokenIndex 返回出售合约中的nft tokenIndex
+func nftSellTokenIndex(data *scriptDecoder.TxoData) (tokenIndex uint64, ok bool) {
+	if data.CodeType == scriptDecoder.CodeType_NFT_SELL {
+		return data.NFTSell.TokenIndex, true
+	}
+	if data.CodeType == scriptDecoder.CodeType_NFT_SELL_V2 {
+		return data.NFTSellV2.TokenIndex, true
+	}
+	return 0, false
+}
+
+// nftSellPrice 返回出售合约中的nft价格
+func nftSellPrice(data *scriptDecoder.TxoData) uint64 {
+	if data.CodeType == scriptDecoder.CodeType_NFT_SELL_V2 {
+		return data.NFTSellV2.Price
+	}
+	return data.NFTSell.Price
+}
+
+// isNFTSellPaid 卖家是否在tx中收到了出售价格
+func isNFTSellPaid(tx *model.Tx, sell *scriptDecoder.TxoData) bool {
+	price := nftSellPrice(sell)
+	for _, output := range tx.TxOuts {
+		if output.Data.CodeType != scriptDecoder.CodeType_NONE || !output.Data.HasAddress {
+			continue
+		}
+		if output.Satoshi >= price && bytes.Equal(output.Data.AddressPkh[:], sell.AddressPkh[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// findNFTAuction 查找和nft相关的拍卖合约。拍卖合约只记录了nft codehash，按codehash匹配
+func findNFTAuction(auctions []*scriptDecoder.TxoData, nft *scriptDecoder.TxoData) *scriptDecoder.TxoData {
+	for _, auction := range auctions {
+		if bytes.Equal(auction.NFTAuction.NFTCodeHash[:], nft.CodeHash[:]) {
+			return auction
+		}
+	}
+	return nil
+}
+
+// SyncBlockNFTTransfer 记录区块内每个nft输出的转移历史，需要依赖txin的utxo信息
+// 花费出售合约，nft转给其他地址且卖家收到出售价格，则记录为成交
+func SyncBlockNFTTransfer(block *model.Block) {
+	for txIdx, tx := range block.Txs {
+		if txIdx == 0 { // skip coinbase
+			continue
+		}
+
+		hasNFTOutput := false
+		for _, output := range tx.TxOuts {
+			if output.Data.CodeType == scriptDecoder.CodeType_NFT {
+				hasNFTOutput = true
+				break
+			}
+		}
+		if !hasNFTOutput {
+			continue
+		}
+
+		nftIn := make(map[string]*scriptDecoder.TxoData, 0)
+		sellIn := make(map[string]*scriptDecoder.TxoData, 0)
+		auctionIn := make([]*scriptDecoder.TxoData, 0)
+		for _, input := range tx.TxIns {
+			objData, ok := block.ParseData.SpentUtxoDataMap[input.InputOutpointKey]
+			if !ok {
+				continue
+			}
+			if objData.Data.CodeType == scriptDecoder.CodeType_NFT {
+				nftIn[nftTokenKey(objData.Data, objData.Data.NFT.TokenIndex)] = objData.Data
+			} else if tokenIndex, ok := nftSellTokenIndex(objData.Data); ok {
+				sellIn[nftTokenKey(objData.Data, tokenIndex)] = objData.Data
+			} else if objData.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
+				auctionIn = append(auctionIn, objData.Data)
+			}
+		}
+
+		sellOut := make(map[string]struct{}, 0)
+		auctionOut := make([]*scriptDecoder.TxoData, 0)
+		for _, output := range tx.TxOuts {
+			if tokenIndex, ok := nftSellTokenIndex(output.Data); ok {
+				sellOut[nftTokenKey(output.Data, tokenIndex)] = struct{}{}
+			} else if output.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
+				auctionOut = append(auctionOut, output.Data)
+			}
+		}
+
+		for vout, output := range tx.TxOuts {
+			if output.Data.CodeType != scriptDecoder.CodeType_NFT {
+				continue
+			}
+			key := nftTokenKey(output.Data, output.Data.NFT.TokenIndex)
+
+			fromAddress := ""
+			from, hasFrom := nftIn[key]
+			if hasFrom && from.HasAddress {
+				fromAddress = string(from.AddressPkh[:])
+			}
+			address := ""
+			if output.Data.HasAddress {
+				address = string(output.Data.AddressPkh[:])
+			}
+
+			operation := model.NFT_OP_TRANSFER
+			if sell, ok := sellIn[key]; ok {
+				if bytes.Equal(sell.AddressPkh[:], output.Data.AddressPkh[:]) {
+					operation = model.NFT_OP_SELL_CANCEL // 退回卖家
+				} else if isNFTSellPaid(tx, sell) {
+					operation = model.NFT_OP_SOLD
+					syncNFTSellTrade(block, txIdx, tx, output.Data, sell)
+				}
+			} else if auction := findNFTAuction(auctionIn, output.Data); auction != nil {
+				if bytes.Equal(auction.NFTAuction.SenderAddressPkh[:], output.Data.AddressPkh[:]) {
+					operation = model.NFT_OP_AUCTION_CANCEL // 退回发起人
+				} else {
+					operation = model.NFT_OP_AUCTION_SETTLE
+				}
+			} else if _, ok := sellOut[key]; ok {
+				operation = model.NFT_OP_SELL_LIST
+			} else if findNFTAuction(auctionOut, output.Data) != nil {
+				operation = model.NFT_OP_AUCTION_LIST
+			} else if !hasFrom {
+				operation = model.NFT_OP_MINT
+			}
+
+			if _, err := store.SyncStmtNFTTransfer.Exec(
+				uint32(block.Height),
+				uint64(txIdx),
+				string(tx.TxId),
+				uint32(vout),
+				string(output.Data.CodeHash[:]),
+				string(output.Data.GenesisId[:output.Data.GenesisIdLen]),
+				output.Data.NFT.TokenIndex,
+				fromAddress,
+				address,
+				uint32(operation),
+				string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-nft-transfer-err",
+					zap.String("txid", tx.TxIdHex),
+					zap.Int("vout", vout),
+					zap.String("err", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// syncNFTSellTrade 记录出售合约成交
+func syncNFTSellTrade(block *model.Block, txIdx int, tx *model.Tx, nft, sell *scriptDecoder.TxoData) {
+	if _, err := store.SyncStmtNFTTrade.Exec(
+		uint32(block.Height),
+		block.BlockTime,
+		uint64(txIdx),
+		string(tx.TxId),
+		string(nft.CodeHash[:]),
+		string(nft.GenesisId[:nft.GenesisIdLen]),
+		nft.NFT.TokenIndex,
+		string(sell.AddressPkh[:]),
+		string(nft.AddressPkh[:]),
+		nftSellPrice(sell),
+		string(block.Hash),
+	); err != nil {
+		logger.Log.Info("sync-nft-trade-err",
+			zap.String("txid", tx.TxIdHex),
+			zap.String("err", err.Error()),
+		)
+	}
+}
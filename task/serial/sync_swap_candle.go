@@ -0,0 +1,104 @@
+package serial
+
+import (
+	"context"
+	"sensibled/logger"
+	"sensibled/model"
+	"sensibled/store"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// SyncBlockSwapCandle 统计区块内各swap池的K线，需要依赖txin的utxo信息
+// 同一区块内的tx blocktime相同，每个池在各周期只产生一条记录
+func SyncBlockSwapCandle(block *model.Block) {
+	getSpentTxo := func(outpointKey string) *model.TxoData {
+		return block.ParseData.SpentUtxoDataMap[outpointKey]
+	}
+
+	pools := make([]string, 0)
+	candles := make(map[string]*model.SwapCandle, 0)
+	for txIdx, tx := range block.Txs {
+		if txIdx == 0 { // skip coinbase
+			continue
+		}
+		swapIn, swapOut, operation := model.ParseSwapTx(tx, getSpentTxo)
+		if swapIn == nil {
+			continue
+		}
+		key := string(swapOut.CodeHash[:]) + string(swapOut.GenesisId[:swapOut.GenesisIdLen])
+		candle, ok := candles[key]
+		if !ok {
+			candle = model.NewSwapCandle(swapIn, swapOut)
+			candle.Height = uint32(block.Height)
+			candles[key] = candle
+			pools = append(pools, key)
+		}
+		candle.AddSwap(swapIn, swapOut, operation, uint64(txIdx), tx.TxId)
+	}
+
+	for _, key := range pools {
+		candle := candles[key]
+		for _, period := range model.SwapCandlePeriods {
+			if _, err := store.SyncStmtSwapCandle.Exec(
+				uint32(block.Height),
+				period,
+				block.BlockTime-block.BlockTime%period,
+				string(candle.CodeHash),
+				string(candle.GenesisId),
+				candle.Open,
+				candle.High,
+				candle.Low,
+				candle.Close,
+				candle.Volume1,
+				candle.Volume2,
+				candle.Trades,
+				candle.Reserve1,
+				candle.Reserve2,
+				candle.Lp,
+				candle.TxIdx,
+				string(candle.TxId),
+				string(block.Hash),
+			); err != nil {
+				logger.Log.Info("sync-swap-candle-err",
+					zap.Int("height", block.Height),
+					zap.String("err", err.Error()),
+				)
+			}
+		}
+		model.GlobalSwapReserveMap[key] = candle
+	}
+}
+
+// SetSwapReserve 更新swap池当前储备
+// swr<codehash><genesis>: token1, token2, lp, price, height, txid
+func SetSwapReserve(pipe redis.Pipeliner, key string, candle *model.SwapCandle) {
+	ctx := context.Background()
+	pipe.HSet(ctx, key,
+		"token1", candle.Reserve1,
+		"token2", candle.Reserve2,
+		"lp", candle.Lp,
+		"price", candle.Close,
+		"height", candle.Height,
+		"txid", candle.TxId,
+	)
+}
+
+// UpdateSwapReserveInRedis 更新区块内swap池的最新储备
+func UpdateSwapReserveInRedis(pipe redis.Pipeliner, reserveMap map[string]*model.SwapCandle) {
+	for key, candle := range reserveMap {
+		SetSwapReserve(pipe, "swr"+key, candle)
+	}
+}
+
+// RestoreSwapReserveInRedis 回滚区块重组影响的swap池储备，没有之前记录的池直接删除
+func RestoreSwapReserveInRedis(pipe redis.Pipeliner, pools []string, reserveMap map[string]*model.SwapCandle) {
+	ctx := context.Background()
+	for _, key := range pools {
+		pipe.Del(ctx, "swr"+key)
+		if candle, ok := reserveMap[key]; ok {
+			SetSwapReserve(pipe, "swr"+key, candle)
+		}
+	}
+}
@@ -13,6 +13,9 @@ import (
 // SyncBlockTx all tx in block height
 func SyncBlockTx(block *model.Block) {
 	for txIdx, tx := range block.Txs {
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
 		// keep sensible rawtx only
 		// prune txraw
 		txraw := ""
@@ -30,6 +33,7 @@ func SyncBlockTx(block *model.Block) {
 			txraw,
 			uint32(block.Height),
 			uint64(txIdx),
+			string(block.Hash),
 		); err != nil {
 			logger.Log.Info("sync-tx-err",
 				zap.String("txid", tx.TxIdHex),
@@ -43,12 +47,20 @@ func SyncBlockTx(block *model.Block) {
 func MarkConfirmedBlockTx(block *model.Block) {
 	model.GlobalConfirmedBlkMap[block.HashHex] = struct{}{}
 	model.GlobalConfirmedBlkMap[block.ParentHex] = struct{}{}
-	for _, tx := range block.Txs {
+	for txIdx, tx := range block.Txs {
 		for model.NeedPauseStage < 1 {
 			logger.Log.Info("MarkConfirmedBlockTx pause ...")
 			time.Sleep(5 * time.Second)
 		}
 
 		model.GlobalConfirmedTxMap[tx.TxIdHex] = struct{}{}
+		if txIdx == 0 {
+			continue
+		}
+		// 记录区块内花费的utxo，以便识别内存池中的冲突tx
+		spent := &model.SpentByTx{TxId: tx.TxId, Height: uint32(block.Height)}
+		for _, input := range tx.TxIns {
+			model.GlobalConfirmedSpentUtxoMap[input.InputOutpointKey] = spent
+		}
 	}
 }
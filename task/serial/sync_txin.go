@@ -1,7 +1,7 @@
 package serial
 
 import (
-	"encoding/binary"
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/model"
 	"sensibled/prune"
@@ -26,6 +26,11 @@ func SyncBlockTxInputDetail(block *model.Block) {
 			time.Sleep(5 * time.Second)
 		}
 
+		// 只索引token时，跳过无关tx，其记录不写入db
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
+
 		isCoinbase := (txIdx == 0)
 
 		for vin, input := range tx.TxIns {
@@ -76,36 +81,16 @@ func SyncBlockTxInputDetail(block *model.Block) {
 
 			codehash := ""
 			genesis := ""
-			if objData.Data.CodeType != scriptDecoder.CodeType_NONE && objData.Data.CodeType != scriptDecoder.CodeType_SENSIBLE {
-				codehash = string(objData.Data.CodeHash[:])                          // 20 bytes
-				genesis = string(objData.Data.GenesisId[:objData.Data.GenesisIdLen]) // 20/36/40 bytes
-			}
-
 			var dataValue uint64
-			var tokenIndex uint64
-			var decimal uint8
 			// token summary
-			if objData.Data.CodeType != scriptDecoder.CodeType_NONE && objData.Data.CodeType != scriptDecoder.CodeType_SENSIBLE {
-				buf := make([]byte, 12, 12+20+40)
-				binary.LittleEndian.PutUint32(buf, objData.Data.CodeType)
-
-				if objData.Data.CodeType == scriptDecoder.CodeType_NFT {
-					binary.LittleEndian.PutUint64(buf[4:], objData.Data.NFT.TokenIndex)
-					tokenIndex = objData.Data.NFT.TokenIndex
-					dataValue = tokenIndex
-				} else if objData.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-					binary.LittleEndian.PutUint64(buf[4:], objData.Data.NFTSell.TokenIndex)
-					tokenIndex = objData.Data.NFTSell.TokenIndex
-					dataValue = tokenIndex
-				} else if objData.Data.CodeType == scriptDecoder.CodeType_FT {
-					decimal = objData.Data.FT.Decimal
-					dataValue = objData.Data.FT.Amount
-				}
-
-				buf = append(buf, objData.Data.CodeHash[:]...)
-				buf = append(buf, objData.Data.GenesisId[:objData.Data.GenesisIdLen]...)
+			if contract.IsToken(objData.Data) {
+				codehash = string(objData.Data.CodeHash[:])                          // 20 bytes
+				genesis = string(objData.Data.GenesisId[:objData.Data.GenesisIdLen]) // 20/36/40 bytes
 
-				tokenKey := string(buf)
+				c := contract.Get(objData.Data.CodeType)
+				dataValue = c.DataValue(objData.Data)
+				tokenIndex, decimal, summaryValue := c.TokenSummary(objData.Data)
+				tokenKey := contract.TokenSummaryKey(objData.Data, tokenIndex)
 
 				tokenSummary, ok := block.ParseData.TokenSummaryMap[tokenKey]
 				if !ok {
@@ -120,7 +105,7 @@ func SyncBlockTxInputDetail(block *model.Block) {
 				}
 
 				tokenSummary.InSatoshi += objData.Satoshi
-				tokenSummary.InDataValue += 1
+				tokenSummary.InDataValue += summaryValue
 			}
 
 			if _, err := store.SyncStmtTxIn.Exec(
@@ -143,6 +128,7 @@ func SyncBlockTxInputDetail(block *model.Block) {
 				objData.Satoshi,
 				string(objData.ScriptType),
 				pkscript,
+				string(block.Hash),
 			); err != nil {
 				logger.Log.Info("sync-txin-full-err",
 					zap.String("sync", "txin full err"),
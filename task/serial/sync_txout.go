@@ -1,6 +1,7 @@
 package serial
 
 import (
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/model"
 	"sensibled/prune"
@@ -27,6 +28,11 @@ func SyncBlockTxOutputInfo(block *model.Block) {
 			}
 		}
 
+		// 只索引token时，跳过无关tx
+		if prune.IsTokenOnly && !tx.IsIndexed {
+			continue
+		}
+
 		for vout, output := range tx.TxOuts {
 			// prune string(output.Pkscript),
 			pkscript := ""
@@ -45,18 +51,11 @@ func SyncBlockTxOutputInfo(block *model.Block) {
 			if output.Data.HasAddress {
 				address = string(output.Data.AddressPkh[:]) // 20 bytes
 			}
-			if output.Data.CodeType != scriptDecoder.CodeType_NONE && output.Data.CodeType != scriptDecoder.CodeType_SENSIBLE {
+			var dataValue uint64
+			if contract.IsToken(output.Data) {
 				codehash = string(output.Data.CodeHash[:])                         // 20 bytes
 				genesis = string(output.Data.GenesisId[:output.Data.GenesisIdLen]) // 20/36/40 bytes
-			}
-
-			var dataValue uint64
-			if output.Data.CodeType == scriptDecoder.CodeType_NFT {
-				dataValue = output.Data.NFT.TokenIndex
-			} else if output.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-				dataValue = output.Data.NFTSell.TokenIndex
-			} else if output.Data.CodeType == scriptDecoder.CodeType_FT {
-				dataValue = output.Data.FT.Amount
+				dataValue = contract.Get(output.Data.CodeType).DataValue(output.Data)
 			}
 			if _, err := store.SyncStmtTxOut.Exec(
 				string(tx.TxId),
@@ -71,6 +70,7 @@ func SyncBlockTxOutputInfo(block *model.Block) {
 				pkscript,
 				uint32(block.Height),
 				uint64(txIdx),
+				string(block.Hash),
 			); err != nil {
 				logger.Log.Info("sync-txout-err",
 					zap.String("sync", "txout err"),
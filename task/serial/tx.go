@@ -3,10 +3,11 @@ package serial
 import (
 	"context"
 	"encoding/hex"
+	"sensibled/contract"
 	"sensibled/logger"
 	"sensibled/model"
+	"sensibled/prune"
 	"sensibled/rdb"
-	"strconv"
 	"time"
 
 	redis "github.com/go-redis/redis/v8"
@@ -18,11 +19,7 @@ import (
 // 部分utxo信息在程序内存，missing的utxo将从redis查询
 // 区块同步结束时会批量更新缓存的utxo到redis
 func ParseGetSpentUtxoDataFromRedisSerial(block *model.ProcessBlock) {
-	pipe := rdb.RdbUtxoClient.Pipeline()
-	m := map[string]*redis.StringCmd{}
-	needExec := false
-	ctx := context.Background()
-
+	outpointKeys := make([]string, 0)
 	for outpointKey := range block.SpentUtxoKeysMap {
 		for model.NeedPauseStage < 2 {
 			logger.Log.Info("ParseGetSpentUtxoDataFromRedisSerial(1/2) pause ...")
@@ -36,47 +33,69 @@ func ParseGetSpentUtxoDataFromRedisSerial(block *model.ProcessBlock) {
 			continue
 		}
 		// 检查是否在本地全局缓存
-		if data, ok := model.GlobalNewUtxoDataMap[outpointKey]; ok {
+		if data, ok := model.GlobalNewUtxoDataMap.Get(outpointKey); ok {
 			block.SpentUtxoDataMap[outpointKey] = data
-			delete(model.GlobalNewUtxoDataMap, outpointKey)
+			model.GlobalNewUtxoDataMap.Delete(outpointKey)
 			continue
 		}
-		// 剩余utxo需要查询redis
-		needExec = true
-		m[outpointKey] = pipe.Get(ctx, "u"+outpointKey)
+		// 剩余utxo需要查询全局utxo存储
+		outpointKeys = append(outpointKeys, outpointKey)
 	}
 
-	if !needExec {
+	if len(outpointKeys) == 0 {
 		return
 	}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
+	utxoBufs, err := rdb.UtxoDB.Get(outpointKeys)
+	if err != nil {
 		panic(err)
 	}
-	for outpointKey, v := range m {
+	for _, outpointKey := range outpointKeys {
 		for model.NeedPauseStage < 2 {
 			logger.Log.Info("ParseGetSpentUtxoDataFromRedisSerial(2/2) pause ...")
 			time.Sleep(5 * time.Second)
 		}
 
-		res, err := v.Result()
-		if err == redis.Nil {
+		res, ok := utxoBufs[outpointKey]
+		if !ok {
 			logger.Log.Error("parse block, but missing utxo from redis",
 				zap.String("outpoint", hex.EncodeToString([]byte(outpointKey))))
 			continue
-		} else if err != nil {
-			panic(err)
 		}
 		d := &model.TxoData{}
-		d.Unmarshal([]byte(res))
+		d.Unmarshal(res)
 
 		// 从redis获取utxo的script，解码以备程序使用
 		d.ScriptType = scriptDecoder.GetLockingScriptType(d.PkScript)
 		d.Data = scriptDecoder.ExtractPkScriptForTxo(d.PkScript, d.ScriptType)
 
 		block.SpentUtxoDataMap[outpointKey] = d
-		model.GlobalSpentUtxoDataMap[outpointKey] = d
+		model.GlobalSpentUtxoDataMap.Set(outpointKey, d)
+	}
+}
+
+// MarkIndexedTxSerial 只索引token时，标记涉及sensible合约或关注地址的tx，并记录这些tx输出的address历史。
+// 依赖从redis查来的utxo
+func MarkIndexedTxSerial(block *model.Block) {
+	for txIdx, tx := range block.Txs {
+		tx.IsIndexed = prune.IsTxOutputsIndexed(tx)
+		if !tx.IsIndexed && txIdx > 0 {
+			for _, input := range tx.TxIns {
+				if obj, ok := block.ParseData.SpentUtxoDataMap[input.InputOutpointKey]; ok && prune.IsTxoIndexed(obj.Data) {
+					tx.IsIndexed = true
+					break
+				}
+			}
+		}
+		if !tx.IsIndexed || prune.IsHistoryPrune {
+			continue
+		}
+		for _, output := range tx.TxOuts {
+			if output.Data.HasAddress {
+				address := string(output.Data.AddressPkh[:])
+				block.ParseData.AddrPkhInTxMap[address] = append(block.ParseData.AddrPkhInTxMap[address], txIdx)
+			}
+		}
 	}
 }
 
@@ -89,7 +108,7 @@ func UpdateUtxoInMapSerial(block *model.ProcessBlock) {
 			time.Sleep(5 * time.Second)
 		}
 
-		model.GlobalNewUtxoDataMap[outpointKey] = data
+		model.GlobalNewUtxoDataMap.Set(outpointKey, data)
 	}
 }
 
@@ -108,176 +127,140 @@ func UpdateUtxoInRedis(pipe redis.Pipeliner, blocksTotal int, addressBalanceCmds
 	)
 
 	for outpointKey, data := range utxoToRestore {
-		strAddressPkh := string(data.Data.AddressPkh[:])
-		strCodeHash := string(data.Data.CodeHash[:])
-		strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
-
-		// redis有序utxo数据成员
-		member := &redis.Z{Score: float64(data.BlockHeight)*1000000000 + float64(data.TxIdx), Member: outpointKey}
-
-		// 非合约信息记录
-		if data.Data.CodeType == scriptDecoder.CodeType_NONE {
-			if !data.Data.HasAddress {
-				// 无法识别地址，暂不记录utxo
-				// pipe.ZAdd(ctx, "utxo", member)
-				continue
-			}
-			// 识别地址，只记录utxo和balance
-			pipe.ZAdd(ctx, "{au"+strAddressPkh+"}", member)           // 有序address utxo数据添加
-			pipe.IncrBy(ctx, "bl"+strAddressPkh, int64(data.Satoshi)) // balance of address
-			continue
-		}
-
-		// 合约信息记录
-		// contract satoshi balance of address
-		pipe.IncrBy(ctx, "cb"+strAddressPkh, int64(data.Satoshi))
-
-		// 有序genesis utxo数据添加
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			// nftIdx as score
-			member.Score = float64(data.Data.NFT.TokenIndex)
-			pipe.ZAdd(ctx, "{nu"+strAddressPkh+"}"+strCodeHash+strGenesisId, member) // nft:utxo
-			pipe.ZAdd(ctx, "nd"+strCodeHash+strGenesisId, member)                    // nft:utxo-detail
-			pipe.ZIncrBy(ctx, "{no"+strGenesisId+strCodeHash+"}", 1, strAddressPkh)  // nft:owners
-			pipe.ZIncrBy(ctx, "{ns"+strAddressPkh+"}", 1, strCodeHash+strGenesisId)  // nft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
-			pipe.ZAdd(ctx, "{nau"+strAddressPkh+"}"+strCodeHash, member) // nft:auction:utxo
-			pipe.ZAdd(ctx, "nad"+strCodeHash+strGenesisId, member)       // nft:auction:utxo-detail
-			pipe.ZIncrBy(ctx, "{nas"+strAddressPkh+"}", 1, strCodeHash)  // nft:auction:sender-summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			pipe.ZAdd(ctx, "{sut}", member)                              // nft:sell:all:utxo, sort by time
-			pipe.ZAdd(ctx, "{suta"+strAddressPkh+"}", member)            // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, "{sutc"+strGenesisId+strCodeHash+"}", member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.Price)
-			pipe.ZAdd(ctx, "{sup}", member)                              // nft:sell:all:utxo, sort by price
-			pipe.ZAdd(ctx, "{supa"+strAddressPkh+"}", member)            // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, "{supc"+strGenesisId+strCodeHash+"}", member) // nft:sell
-
-			member.Score = float64(data.Data.NFTSell.TokenIndex)
-			pipe.ZAdd(ctx, "{sui}", member)                              // nft:sell:all:utxo, sort by token index
-			pipe.ZAdd(ctx, "{suia"+strAddressPkh+"}", member)            // nft:sell:seller-address:utxo
-			pipe.ZAdd(ctx, "{suic"+strGenesisId+strCodeHash+"}", member) // nft:sell
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			pipe.ZAdd(ctx, "{fu"+strAddressPkh+"}"+strCodeHash+strGenesisId, member)                           // ft:utxo
-			pipe.ZIncrBy(ctx, "{fb"+strGenesisId+strCodeHash+"}", float64(data.Data.FT.Amount), strAddressPkh) // ft:balance
-			pipe.ZIncrBy(ctx, "{fs"+strAddressPkh+"}", float64(data.Data.FT.Amount), strCodeHash+strGenesisId) // ft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			pipe.ZAdd(ctx, "{fu"+strAddressPkh+"}"+strCodeHash+strGenesisId, member) // uniq:utxo
+		// 未关注的地址、genesis，以及只索引token时的无关输出不记录索引
+		if prune.IsTxoWatched(data.Data) {
+			addUtxoIndexesInRedis(ctx, pipe, outpointKey, data)
 		}
 
 		// skip if reorg
-		if isReorg {
+		if isReorg || data.Data.CodeType == scriptDecoder.CodeType_NONE {
 			continue
 		}
 
 		// update token info
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			pipe.HSet(ctx, "nI"+strCodeHash+strGenesisId+strconv.Itoa(int(data.Data.NFT.TokenIndex)),
-				"metatxid", data.Data.NFT.MetaTxId[:],
-				"metavout", data.Data.NFT.MetaOutputIndex,
-				"supply", data.Data.NFT.TokenSupply,
-				"sensibleid", data.Data.NFT.SensibleId,
-			)
-			pipe.HSet(ctx, "ni"+strCodeHash+strGenesisId,
-				"supply", data.Data.NFT.TokenSupply,
-				"sensibleid", data.Data.NFT.SensibleId,
-			)
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			pipe.HSet(ctx, "fi"+strCodeHash+strGenesisId,
-				"decimal", data.Data.FT.Decimal,
-				"name", data.Data.FT.Name,
-				"symbol", data.Data.FT.Symbol,
-				"sensibleid", data.Data.FT.SensibleId,
-			)
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			pipe.HSet(ctx, "fi"+strCodeHash+strGenesisId,
-				"sensibleid", data.Data.Uniq.SensibleId,
-			)
-		}
+		contract.Get(data.Data.CodeType).UpdateInfo(ctx, pipe, data.Data)
 	}
 
-	addrToRemove := make(map[string]struct{}, 1)
-	tokenToRemove := make(map[string]struct{}, 1)
+	counterToClean := make(map[string]struct{}, 1)
 	for outpointKey, data := range utxoToRemove {
-		strAddressPkh := string(data.Data.AddressPkh[:])
-		strCodeHash := string(data.Data.CodeHash[:])
-		strGenesisId := string(data.Data.GenesisId[:data.Data.GenesisIdLen])
-
-		// 非合约信息清理
-		if data.Data.CodeType == scriptDecoder.CodeType_NONE {
-			// redis有序utxo数据清除
-			if !data.Data.HasAddress {
-				// 无法识别地址，暂不记录utxo
-				// pipe.ZRem(ctx, "utxo", outpointKey)
-				continue
-			}
-			// 识别地址，只记录utxo和balance
-			pipe.ZRem(ctx, "{au"+strAddressPkh+"}", outpointKey)                                               // 有序address utxo数据清除
-			addressBalanceCmds["bl"+strAddressPkh] = pipe.DecrBy(ctx, "bl"+strAddressPkh, int64(data.Satoshi)) // balance of address
+		if !prune.IsTxoWatched(data.Data) {
 			continue
 		}
+		// 记录key以备删除
+		for _, key := range removeUtxoIndexesInRedis(ctx, pipe, addressBalanceCmds, outpointKey, data) {
+			counterToClean[key] = struct{}{}
+		}
+	}
+
+	// 删除balance、summary 为0的记录
+	for key := range counterToClean {
+		pipe.ZRemRangeByScore(ctx, key, "0", "0")
+	}
+
+	logger.Log.Info("UpdateUtxoInRedis finished")
+}
 
-		// 非合约信息清理
-		// contract satoshi balance of address
-		addressBalanceCmds["cb"+strAddressPkh] = pipe.DecrBy(ctx, "cb"+strAddressPkh, int64(data.Satoshi))
-
-		// redis有序genesis utxo数据清除
-		if data.Data.CodeType == scriptDecoder.CodeType_NFT {
-			pipe.ZRem(ctx, "{nu"+strAddressPkh+"}"+strCodeHash+strGenesisId, outpointKey) // nft:utxo
-			pipe.ZRem(ctx, "nd"+strCodeHash+strGenesisId, outpointKey)                    // nft:utxo-detail
-			pipe.ZIncrBy(ctx, "{no"+strGenesisId+strCodeHash+"}", -1, strAddressPkh)      // nft:owners
-			pipe.ZIncrBy(ctx, "{ns"+strAddressPkh+"}", -1, strCodeHash+strGenesisId)      // nft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_AUCTION {
-			pipe.ZRem(ctx, "{nau"+strAddressPkh+"}"+strCodeHash, outpointKey) // nft:auction:utxo
-			pipe.ZRem(ctx, "nad"+strCodeHash+strGenesisId, outpointKey)       // nft:auction:utxo-detail
-			pipe.ZIncrBy(ctx, "{nas"+strAddressPkh+"}", -1, strCodeHash)      // nft:auction:sender-summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_NFT_SELL {
-			pipe.ZRem(ctx, "{sut}", outpointKey)                              // nft:sell:all:utxo, sort by time
-			pipe.ZRem(ctx, "{suta"+strAddressPkh+"}", outpointKey)            // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, "{sutc"+strGenesisId+strCodeHash+"}", outpointKey) // nft:sell
-
-			pipe.ZRem(ctx, "{sup}", outpointKey)                              // nft:sell:all:utxo, sort by price
-			pipe.ZRem(ctx, "{supa"+strAddressPkh+"}", outpointKey)            // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, "{supc"+strGenesisId+strCodeHash+"}", outpointKey) // nft:sell
-
-			pipe.ZRem(ctx, "{sui}", outpointKey)                              // nft:sell:all:utxo, sort by token index
-			pipe.ZRem(ctx, "{suia"+strAddressPkh+"}", outpointKey)            // nft:sell:seller-address:utxo
-			pipe.ZRem(ctx, "{suic"+strGenesisId+strCodeHash+"}", outpointKey) // nft:sell
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_FT {
-			pipe.ZRem(ctx, "{fu"+strAddressPkh+"}"+strCodeHash+strGenesisId, outpointKey)                       // ft:utxo
-			pipe.ZIncrBy(ctx, "{fb"+strGenesisId+strCodeHash+"}", -float64(data.Data.FT.Amount), strAddressPkh) // ft:balance
-			pipe.ZIncrBy(ctx, "{fs"+strAddressPkh+"}", -float64(data.Data.FT.Amount), strCodeHash+strGenesisId) // ft:summary
-
-		} else if data.Data.CodeType == scriptDecoder.CodeType_UNIQUE {
-			pipe.ZRem(ctx, "{fu"+strAddressPkh+"}"+strCodeHash+strGenesisId, outpointKey) // uniq:utxo
+// addUtxoIndexesInRedis 记录utxo的地址、合约索引
+func addUtxoIndexesInRedis(ctx context.Context, pipe redis.Pipeliner, outpointKey string, data *model.TxoData) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+
+	// redis有序utxo数据成员
+	member := &redis.Z{Score: float64(data.BlockHeight)*1000000000 + float64(data.TxIdx), Member: outpointKey}
+
+	// 非合约信息记录
+	if data.Data.CodeType == scriptDecoder.CodeType_NONE {
+		if !data.Data.HasAddress {
+			// 无法识别地址，暂不记录utxo
+			// pipe.ZAdd(ctx, "utxo", member)
+			return
 		}
+		// 识别地址，只记录utxo和balance
+		pipe.ZAdd(ctx, "{au"+strAddressPkh+"}", member)           // 有序address utxo数据添加
+		pipe.IncrBy(ctx, "bl"+strAddressPkh, int64(data.Satoshi)) // balance of address
+		return
+	}
 
-		// 记录key以备删除
-		tokenToRemove[strGenesisId+strCodeHash] = struct{}{}
-		addrToRemove[strAddressPkh] = struct{}{}
+	// 合约信息记录
+	// contract satoshi balance of address
+	pipe.IncrBy(ctx, "cb"+strAddressPkh, int64(data.Satoshi))
+
+	// 有序genesis utxo数据添加
+	contract.AddUtxoIndexes(ctx, pipe, outpointKey, data, member.Score, "", "", 1)
+}
+
+// removeUtxoIndexesInRedis 清除utxo的地址、合约索引，返回需要清理为0记录的key
+func removeUtxoIndexesInRedis(ctx context.Context, pipe redis.Pipeliner, addressBalanceCmds map[string]*redis.IntCmd,
+	outpointKey string, data *model.TxoData) (counterKeys []string) {
+	strAddressPkh := string(data.Data.AddressPkh[:])
+
+	// 非合约信息清理
+	if data.Data.CodeType == scriptDecoder.CodeType_NONE {
+		// redis有序utxo数据清除
+		if !data.Data.HasAddress {
+			// 无法识别地址，暂不记录utxo
+			// pipe.ZRem(ctx, "utxo", outpointKey)
+			return nil
+		}
+		// 识别地址，只记录utxo和balance
+		pipe.ZRem(ctx, "{au"+strAddressPkh+"}", outpointKey)                                               // 有序address utxo数据清除
+		addressBalanceCmds["bl"+strAddressPkh] = pipe.DecrBy(ctx, "bl"+strAddressPkh, int64(data.Satoshi)) // balance of address
+		return nil
+	}
+
+	// 非合约信息清理
+	// contract satoshi balance of address
+	addressBalanceCmds["cb"+strAddressPkh] = pipe.DecrBy(ctx, "cb"+strAddressPkh, int64(data.Satoshi))
+
+	// redis有序genesis utxo数据清除
+	_, counterKeys = contract.RemoveUtxoIndexes(ctx, pipe, outpointKey, data, "", "", -1)
+	return counterKeys
+}
+
+// UpdateWatchedUtxoInRedis 关注列表变化后，为新关注的utxo补全索引，清除取消关注的utxo索引
+func UpdateWatchedUtxoInRedis(pipe redis.Pipeliner, addressBalanceCmds map[string]*redis.IntCmd, utxoToAdd, utxoToRemove map[string]*model.TxoData) {
+	logger.Log.Info("UpdateWatchedUtxoInRedis",
+		zap.Int("add", len(utxoToAdd)),
+		zap.Int("del", len(utxoToRemove)))
+
+	ctx := context.Background()
+	for outpointKey, data := range utxoToAdd {
+		addUtxoIndexesInRedis(ctx, pipe, outpointKey, data)
 	}
 
-	// 删除balance 为0的记录
-	for codeKey := range tokenToRemove {
-		pipe.ZRemRangeByScore(ctx, "{no"+codeKey+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "{fb"+codeKey+"}", "0", "0")
+	counterToClean := make(map[string]struct{}, 1)
+	for outpointKey, data := range utxoToRemove {
+		for _, key := range removeUtxoIndexesInRedis(ctx, pipe, addressBalanceCmds, outpointKey, data) {
+			counterToClean[key] = struct{}{}
+		}
+	}
+	for key := range counterToClean {
+		pipe.ZRemRangeByScore(ctx, key, "0", "0")
 	}
+}
 
-	// 删除summary 为0的记录
-	for addr := range addrToRemove {
-		pipe.ZRemRangeByScore(ctx, "{ns"+addr+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "{fs"+addr+"}", "0", "0")
-		pipe.ZRemRangeByScore(ctx, "{nas"+addr+"}", "0", "0")
+// UpdateUtxoCacheInRedis 批量更新当前批次的utxo缓存到redis
+// 余额为增量更新，增量同步时全部写入pipe，与其他更新在一个事务内提交，避免中断后重新同步重复累加。
+// 全量同步前已清空redis，中断后需重新全量同步，缓存已溢出到磁盘时分块提交，避免pipeline占用过多内存
+func UpdateUtxoCacheInRedis(pipe redis.Pipeliner, blocksTotal int, addressBalanceCmds map[string]*redis.IntCmd, isFull bool) bool {
+	spilled := model.GlobalNewUtxoDataMap.IsSpilled() || model.GlobalSpentUtxoDataMap.IsSpilled()
+	if !isFull || !spilled {
+		return model.RangeUtxoChunks(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap, model.UtxoCacheChunkSize,
+			func(utxoToRestore, utxoToRemove map[string]*model.TxoData) bool {
+				UpdateUtxoInRedis(pipe, blocksTotal, addressBalanceCmds, utxoToRestore, utxoToRemove, false)
+				return true
+			})
 	}
 
-	logger.Log.Info("UpdateUtxoInRedis finished")
+	ctx := context.Background()
+	return model.RangeUtxoChunks(model.GlobalNewUtxoDataMap, model.GlobalSpentUtxoDataMap, model.UtxoCacheChunkSize,
+		func(utxoToRestore, utxoToRemove map[string]*model.TxoData) bool {
+			chunkPipe := rdb.RdbBalanceClient.TxPipeline()
+			chunkBalanceCmds := make(map[string]*redis.IntCmd, 0)
+			UpdateUtxoInRedis(chunkPipe, blocksTotal, chunkBalanceCmds, utxoToRestore, utxoToRemove, false)
+			if _, err := chunkPipe.Exec(ctx); err != nil {
+				logger.Log.Error("redis exec failed", zap.Error(err))
+				return false
+			}
+			return DeleteKeysWhitchAddressBalanceZero(chunkBalanceCmds)
+		})
 }
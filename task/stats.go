@@ -0,0 +1,60 @@
+package task
+
+import (
+	"sensibled/loader"
+	"sensibled/logger"
+	"sensibled/store"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	StatsInterval int // 每隔多少区块统计一次，0为不统计
+	StatsTopN     int // 排行榜数量
+
+	statsLock sync.Mutex // 统计进行中，重组需等待统计结束
+)
+
+// RefreshStats 区块提交后触发统计，后台执行，上次统计未结束则跳过
+func RefreshStats(height int) {
+	if StatsInterval <= 0 {
+		return
+	}
+	if !statsLock.TryLock() {
+		return
+	}
+	go func() {
+		defer statsLock.Unlock()
+
+		lastStats, err := loader.GetAddressStats()
+		if err != nil {
+			// 旧数据库可能尚无此表
+			logger.Log.Info("get last stats failed", zap.Error(err))
+		}
+		dayStartHeight := 0
+		if lastStats != nil {
+			lastHeight := int(lastStats.Height)
+			if height >= lastHeight && height < lastHeight+StatsInterval {
+				return
+			}
+			if lastHeight < height {
+				dayStartHeight, err = loader.GetDayStartHeight(lastHeight)
+				if err != nil {
+					return
+				}
+			}
+		}
+		if ok := store.RefreshStatsCk(height, dayStartHeight, StatsTopN); !ok {
+			logger.Log.Error("refresh stats failed", zap.Int("height", height))
+			return
+		}
+		logger.Log.Info("refresh stats done", zap.Int("height", height))
+	}()
+}
+
+// waitStats 等待进行中的统计结束
+func waitStats() {
+	statsLock.Lock()
+	statsLock.Unlock()
+}
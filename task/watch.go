@@ -0,0 +1,290 @@
+package task
+
+import (
+	"encoding/binary"
+	"sensibled/loader"
+	"sensibled/logger"
+	memTask "sensibled/mempool/task"
+	"sensibled/model"
+	"sensibled/prune"
+	"sensibled/rdb"
+	"sensibled/store"
+	"sensibled/task/serial"
+	"sort"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// 已生效的关注列表，首次更新时从db读取
+var appliedWatchList *prune.WatchList
+
+// redis中地址索引已生效的关注列表，每项为hash的一个field，与地址索引在同一事务内更新。
+// 固定包含watchListMarker，以区分列表为空和尚未记录
+const (
+	redisWatchListKey = "watchlist"
+	watchListMarker   = "#"
+)
+
+// ResetWatchList 全量同步时按当前关注列表写入，记录为已生效。未设置关注列表则清除记录
+func ResetWatchList() bool {
+	if !prune.IsWatchMode {
+		return store.DropWatchListCk()
+	}
+	if w := prune.TakePendingWatchList(); w != nil {
+		prune.SetWatchList(w)
+	}
+	if !store.SaveWatchListCk(prune.GetWatchList()) {
+		return false
+	}
+	pipe := rdb.RdbBalanceClient.TxPipeline()
+	pipe.Del(ctx, redisWatchListKey)
+	saveRedisWatchList(pipe, prune.GetWatchList().Items, nil)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Error("redis exec failed", zap.Error(err))
+		return false
+	}
+	appliedWatchList = prune.GetWatchList()
+	return true
+}
+
+// UpdateWatchList 关注列表有变化时，为新关注的地址、genesis补全utxo索引和tx历史，清除取消关注的部分，
+// 需在区块、内存池数据提交后执行。之后内存池需要全量重新同步。
+// 只索引token时，新关注地址之前的无关tx未写入db，先由backfill从blk文件补全
+func UpdateWatchList(mempool *memTask.Mempool, backfill func(addresses []string) bool) bool {
+	if !prune.IsWatchMode {
+		return true
+	}
+	if appliedWatchList == nil {
+		w, err := loader.GetWatchList()
+		if err != nil {
+			// 未记录说明之前未设置关注列表，地址相关的索引是完整的，需要全量同步
+			logger.Log.Error("load applied watch list failed, full sync required", zap.Error(err))
+			return false
+		}
+		appliedWatchList = w
+	}
+	if w := prune.TakePendingWatchList(); w != nil {
+		prune.SetWatchList(w)
+	}
+	watchList := prune.GetWatchList()
+	if watchList.Equal(appliedWatchList) {
+		return true
+	}
+
+	addresses := diffWatchKeys(appliedWatchList.Addresses, watchList.Addresses)
+	genesis := diffWatchKeys(appliedWatchList.Genesis, watchList.Genesis)
+	logger.Log.Info("update watch list",
+		zap.Int("nAddress", len(addresses)),
+		zap.Int("nGenesis", len(genesis)))
+
+	// db tx、txin、txout
+	if prune.IsTokenOnly {
+		var addressesToAdd []string
+		for _, strAddressPkh := range addresses {
+			if watchList.IsAddressWatched(strAddressPkh) {
+				addressesToAdd = append(addressesToAdd, strAddressPkh)
+			}
+		}
+		if len(addressesToAdd) > 0 && !backfill(addressesToAdd) {
+			logger.Log.Error("backfill watch address tx failed")
+			return false
+		}
+	}
+
+	// redis utxo索引
+	if !updateWatchedUtxo(watchList) {
+		logger.Log.Error("update watch utxo failed")
+		return false
+	}
+
+	// pika address tx历史
+	if !prune.IsHistoryPrune {
+		if ok := store.SplitWatchKeys(addresses, nil, func(addresses, _ []string) bool {
+			var addressesToAdd, addressesToRemove []string
+			for _, strAddressPkh := range addresses {
+				if watchList.IsAddressWatched(strAddressPkh) {
+					addressesToAdd = append(addressesToAdd, strAddressPkh)
+				} else {
+					addressesToRemove = append(addressesToRemove, strAddressPkh)
+				}
+			}
+			var addressTxs []*model.AddressTxDO
+			if len(addressesToAdd) > 0 {
+				var err error
+				if addressTxs, err = loader.GetAddressTxHistory(addressesToAdd); err != nil {
+					logger.Log.Error("get address history failed", zap.Error(err))
+					return false
+				}
+			}
+			return serial.UpdateWatchedAddressHistoryInPika(addressTxs, addressesToRemove)
+		}); !ok {
+			logger.Log.Error("update watch address history failed")
+			return false
+		}
+	}
+
+	// db *_genesis_height索引，记录为已生效
+	if !store.SaveWatchListCk(watchList) || !store.UpdateWatchGenesisHeightCk(addresses, genesis) {
+		logger.Log.Error("update watch genesis height failed")
+		return false
+	}
+	appliedWatchList = watchList
+
+	// 内存池数据按新的关注列表重新生成
+	mempool.NeedFullReload = true
+	logger.Log.Info("update watch list finished")
+	return true
+}
+
+// updateWatchedUtxo 从redis中已生效的关注列表开始，分批补全、清除utxo索引。
+// 余额为增量更新，每批与生效进度在同一事务内提交，中断后从未完成的批次继续，不会重复累加
+func updateWatchedUtxo(watchList *prune.WatchList) bool {
+	applied, err := loadRedisWatchList()
+	if err != nil {
+		logger.Log.Error("load redis watch list failed", zap.Error(err))
+		return false
+	}
+	if applied == nil {
+		applied = appliedWatchList
+	}
+	addresses := diffWatchKeys(applied.Addresses, watchList.Addresses)
+	genesis := diffWatchKeys(applied.Genesis, watchList.Genesis)
+
+	return store.SplitWatchKeys(addresses, genesis, func(addresses, genesis []string) bool {
+		next, itemsToAdd, itemsToRemove := applied.Apply(watchList, addresses, genesis)
+
+		utxos, err := loader.GetWatchUTXO(addresses, genesis)
+		if err != nil {
+			logger.Log.Error("get watch utxo failed", zap.Error(err))
+			return false
+		}
+		// 同时涉及多个批次的地址、genesis的utxo，只在第一次关注状态变化时处理
+		utxoToAdd := make(map[string]*model.TxoData)
+		utxoToRemove := make(map[string]*model.TxoData)
+		for outpointKey, data := range utxos {
+			wasWatched := applied.IsTxoWatched(data.Data)
+			isWatched := next.IsTxoWatched(data.Data)
+			if isWatched && !wasWatched {
+				utxoToAdd[outpointKey] = data
+			} else if wasWatched && !isWatched {
+				utxoToRemove[outpointKey] = data
+			}
+		}
+
+		rdsPipe := rdb.RdbBalanceClient.TxPipeline()
+		addressBalanceCmds := make(map[string]*redis.IntCmd, 0)
+		serial.UpdateWatchedUtxoInRedis(rdsPipe, addressBalanceCmds, utxoToAdd, utxoToRemove)
+		saveRedisWatchList(rdsPipe, itemsToAdd, itemsToRemove)
+		if _, err := rdsPipe.Exec(ctx); err != nil {
+			logger.Log.Error("redis exec failed", zap.Error(err))
+			return false
+		}
+		applied = next
+		return serial.DeleteKeysWhitchAddressBalanceZero(addressBalanceCmds)
+	})
+}
+
+// loadRedisWatchList redis中地址索引已生效的关注列表，未记录则返回nil
+func loadRedisWatchList() (*prune.WatchList, error) {
+	entries, err := rdb.RdbBalanceClient.HKeys(ctx, redisWatchListKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return prune.NewWatchList(entries)
+}
+
+// saveRedisWatchList 记录redis中地址索引已生效的关注列表变化
+func saveRedisWatchList(pipe redis.Pipeliner, itemsToAdd, itemsToRemove []prune.WatchItem) {
+	values := []interface{}{watchListMarker, 1}
+	for _, item := range itemsToAdd {
+		values = append(values, item.Entry, 1)
+	}
+	pipe.HSet(ctx, redisWatchListKey, values...)
+	if len(itemsToRemove) > 0 {
+		entries := make([]string, len(itemsToRemove))
+		for idx, item := range itemsToRemove {
+			entries[idx] = item.Entry
+		}
+		pipe.HDel(ctx, redisWatchListKey, entries...)
+	}
+}
+
+// BackfillWatchedBlock 只索引token时，从blk文件补全新关注地址之前未索引的tx。
+// 涉及地址输出、或花费已补全tx输出的tx写入补全暂存表，txos记录这些tx的输出，作为之后输入的来源，区块需按高度顺序处理
+func BackfillWatchedBlock(block *model.Block, addresses map[string]struct{}, txos map[string]*model.TxoData) {
+	block.ParseData = &model.ProcessBlock{
+		Height:           uint32(block.Height),
+		AddrPkhInTxMap:   make(map[string][]int, 1),
+		SpentUtxoDataMap: make(map[string]*model.TxoData, 1),
+		TokenSummaryMap:  make(map[string]*model.TokenData, 1),
+	}
+	for txIdx, tx := range block.Txs {
+		tx.IsIndexed = false
+		for _, output := range tx.TxOuts {
+			output.ScriptType = scriptDecoder.GetLockingScriptType(output.PkScript)
+			output.Data = scriptDecoder.ExtractPkScriptForTxo(output.PkScript, output.ScriptType)
+			if output.Data.HasAddress {
+				if _, ok := addresses[string(output.Data.AddressPkh[:])]; ok {
+					tx.IsIndexed = true
+				}
+			}
+		}
+		if txIdx > 0 {
+			for _, input := range tx.TxIns {
+				if d, ok := txos[input.InputOutpointKey]; ok {
+					block.ParseData.SpentUtxoDataMap[input.InputOutpointKey] = d
+					delete(txos, input.InputOutpointKey)
+					tx.IsIndexed = true
+				}
+			}
+		}
+		if !tx.IsIndexed {
+			continue
+		}
+		for vout, output := range tx.TxOuts {
+			if scriptDecoder.IsFalseOpreturn(output.ScriptType) {
+				continue
+			}
+			outpointKey := make([]byte, 36)
+			copy(outpointKey, tx.TxId)
+			binary.LittleEndian.PutUint32(outpointKey[32:], uint32(vout))
+			txos[string(outpointKey)] = &model.TxoData{
+				BlockHeight: block.ParseData.Height,
+				TxIdx:       uint64(txIdx),
+				Satoshi:     output.Satoshi,
+				ScriptType:  output.ScriptType,
+				PkScript:    output.PkScript,
+				Data:        output.Data,
+			}
+		}
+	}
+
+	// 未标记的tx被跳过。来源不在txos中的输入(花费无关tx或已索引tx的输出)金额、地址为空
+	serial.SyncBlockTxOutputInfo(block)
+	serial.SyncBlockTxInputDetail(block)
+	serial.SyncBlockTx(block)
+
+	block.Txs = nil
+	block.ParseData = nil
+}
+
+// diffWatchKeys 只在其中一个列表中的key
+func diffWatchKeys(a, b map[string]struct{}) (keys []string) {
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -39,7 +39,7 @@ func init() {
 	flag.Parse()
 
 	rdb.RdbBalanceClient = rdb.Init("conf/rdb_balance.yaml")
-	rdb.RdbUtxoClient = rdb.Init("conf/rdb_utxo.yaml")
+	rdb.InitUtxoStore("conf/rdb_utxo.yaml")
 }
 
 func main() {
@@ -84,17 +84,12 @@ func main() {
 		return
 	}
 
-	pipeUtxo := rdb.RdbUtxoClient.Pipeline()
-	m := map[string]*redis.IntCmd{}
-	for _, utxo := range utxoOutpoints {
-		m[utxo] = pipeUtxo.Exists(ctx, "u"+utxo)
-	}
-
-	if _, err := pipeUtxo.Exec(ctx); err != nil && err != redis.Nil {
+	existUtxos, err := rdb.UtxoDB.Exists(utxoOutpoints)
+	if err != nil {
 		panic(err)
 	}
-	for utxo, v := range m {
-		if _, err := v.Result(); err == redis.Nil {
+	for _, utxo := range utxoOutpoints {
+		if _, ok := existUtxos[utxo]; !ok {
 			logger.Log.Info("missing utxo",
 				zap.String("txid", hex.EncodeToString(utils.ReverseBytes([]byte(utxo[:32])))),
 				zap.String("utxo", hex.EncodeToString([]byte(utxo))))
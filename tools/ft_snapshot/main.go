@@ -0,0 +1,202 @@
+// go build -v sensibled/tools/ft_snapshot
+// ./ft_snapshot -codehash <hex> -genesis <hex> -height 750000 -format csv -out holders.csv
+// ./ft_snapshot -codehash <hex> -genesis <hex> -interval 1000 -save
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sensibled/loader"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/store"
+	"sensibled/utils"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+var (
+	codeHashHex  string
+	genesisIdHex string
+	height       int
+	format       string
+	outPath      string
+
+	save     bool
+	interval int
+)
+
+type ftHolder struct {
+	Address    string `json:"address"`
+	AddressPkh string `json:"addressPkh"`
+	Balance    uint64 `json:"balance"`
+}
+
+type ftSnapshot struct {
+	CodeHash  string      `json:"codehash"`
+	GenesisId string      `json:"genesis"`
+	Height    int         `json:"height"`
+	Holders   []*ftHolder `json:"holders"`
+}
+
+func init() {
+	flag.StringVar(&codeHashHex, "codehash", "", "ft codehash")
+	flag.StringVar(&genesisIdHex, "genesis", "", "ft genesis")
+	flag.IntVar(&height, "height", -1, "snapshot block height, default latest block")
+	flag.StringVar(&format, "format", "csv", "output format: csv/json/none")
+	flag.StringVar(&outPath, "out", "", "output file, default stdout")
+
+	flag.BoolVar(&save, "save", false, "save snapshot at height into ck")
+	flag.IntVar(&interval, "interval", 0, "save snapshots every interval blocks up to height")
+	flag.Parse()
+
+	clickhouse.Init()
+}
+
+func main() {
+	defer logger.SyncLog()
+
+	codeHash, err := hex.DecodeString(codeHashHex)
+	if err != nil || len(codeHash) != 20 {
+		logger.Log.Error("invalid codehash", zap.String("codehash", codeHashHex))
+		return
+	}
+	genesisId, err := hex.DecodeString(genesisIdHex)
+	if err != nil || len(genesisId) == 0 {
+		logger.Log.Error("invalid genesis", zap.String("genesis", genesisIdHex))
+		return
+	}
+
+	lastBlock, err := loader.GetLatestBlockFromDB()
+	if err != nil {
+		logger.Log.Error("get latest block failed", zap.Error(err))
+		return
+	}
+	if height < 0 || height > int(lastBlock.Height) {
+		height = int(lastBlock.Height)
+	}
+
+	// 定期快照，从上次快照开始，每interval个区块保存一次
+	if interval > 0 {
+		snapshotHeight, err := loader.GetFTSnapshotHeight(codeHash, genesisId, height)
+		if err != nil {
+			snapshotHeight = -1
+		}
+		for h := (snapshotHeight/interval + 1) * interval; h <= height; h += interval {
+			if !saveSnapshot(codeHash, genesisId, h) {
+				return
+			}
+		}
+	}
+
+	holders, err := loader.GetFTHoldersAtHeight(codeHash, genesisId, height)
+	if err != nil {
+		logger.Log.Error("get ft holders failed", zap.Error(err))
+		return
+	}
+	if save && !store.SaveFTSnapshotCk(codeHash, genesisId, height, holders) {
+		return
+	}
+	logger.Log.Info("ft snapshot",
+		zap.Int("height", height),
+		zap.Int("nHolder", len(holders)))
+
+	if format == "none" {
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			logger.Log.Error("create output failed", zap.Error(err))
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	snapshot := &ftSnapshot{
+		CodeHash:  codeHashHex,
+		GenesisId: genesisIdHex,
+		Height:    height,
+		Holders:   sortHolders(holders),
+	}
+	if format == "json" {
+		err = writeJson(out, snapshot)
+	} else {
+		err = writeCsv(out, snapshot)
+	}
+	if err != nil {
+		logger.Log.Error("write snapshot failed", zap.Error(err))
+	}
+}
+
+func saveSnapshot(codeHash, genesisId []byte, h int) bool {
+	holders, err := loader.GetFTHoldersAtHeight(codeHash, genesisId, h)
+	if err != nil {
+		logger.Log.Error("get ft holders failed", zap.Int("height", h), zap.Error(err))
+		return false
+	}
+	if !store.SaveFTSnapshotCk(codeHash, genesisId, h, holders) {
+		return false
+	}
+	logger.Log.Info("save ft snapshot", zap.Int("height", h), zap.Int("nHolder", len(holders)))
+	return true
+}
+
+// sortHolders 按余额从大到小排序
+func sortHolders(holders map[string]uint64) []*ftHolder {
+	pkhs := make([]string, 0, len(holders))
+	for strAddressPkh := range holders {
+		pkhs = append(pkhs, strAddressPkh)
+	}
+	sort.Slice(pkhs, func(i, j int) bool {
+		if holders[pkhs[i]] != holders[pkhs[j]] {
+			return holders[pkhs[i]] > holders[pkhs[j]]
+		}
+		return bytes.Compare([]byte(pkhs[i]), []byte(pkhs[j])) < 0
+	})
+
+	result := make([]*ftHolder, 0, len(pkhs))
+	for _, strAddressPkh := range pkhs {
+		result = append(result, &ftHolder{
+			Address:    utils.EncodeAddress([]byte(strAddressPkh), utils.PubKeyHashAddrID),
+			AddressPkh: hex.EncodeToString([]byte(strAddressPkh)),
+			Balance:    holders[strAddressPkh],
+		})
+	}
+	return result
+}
+
+func writeCsv(out io.Writer, snapshot *ftSnapshot) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"address", "address_pkh", "balance"}); err != nil {
+		return err
+	}
+	for _, holder := range snapshot.Holders {
+		if err := w.Write([]string{
+			holder.Address,
+			holder.AddressPkh,
+			strconv.FormatUint(holder.Balance, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeJson(out io.Writer, snapshot *ftSnapshot) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snapshot)
+}
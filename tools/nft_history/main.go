@@ -0,0 +1,114 @@
+// go build -v sensibled/tools/nft_history
+// ./nft_history -codehash <hex> -genesis <hex> -index 0
+// ./nft_history -codehash <hex> -genesis <hex> -stats
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"sensibled/loader"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/rdb"
+	"sensibled/utils"
+
+	"go.uber.org/zap"
+)
+
+var (
+	codeHashHex  string
+	genesisIdHex string
+	tokenIndex   uint64
+	stats        bool
+
+	operationName = []string{
+		"mint",
+		"transfer",
+		"sell_list",
+		"sell_cancel",
+		"sold",
+		"auction_list",
+		"auction_settle",
+		"auction_cancel",
+	}
+)
+
+type nftTransfer struct {
+	Height      uint32 `json:"height"`
+	TxIdx       uint64 `json:"txidx"`
+	TxId        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	FromAddress string `json:"from"`
+	Address     string `json:"to"`
+	Operation   string `json:"operation"`
+}
+
+func init() {
+	flag.StringVar(&codeHashHex, "codehash", "", "nft codehash")
+	flag.StringVar(&genesisIdHex, "genesis", "", "nft genesis")
+	flag.Uint64Var(&tokenIndex, "index", 0, "nft token index")
+	flag.BoolVar(&stats, "stats", false, "show sell trade stats of genesis")
+	flag.Parse()
+
+	rdb.RdbBalanceClient = rdb.Init("conf/rdb_balance.yaml")
+	clickhouse.Init()
+}
+
+func encodeAddress(addressPkh []byte) string {
+	if len(addressPkh) == 0 {
+		return ""
+	}
+	return utils.EncodeAddress(addressPkh, utils.PubKeyHashAddrID)
+}
+
+func main() {
+	defer logger.SyncLog()
+
+	codeHash, _ := hex.DecodeString(codeHashHex)
+	genesisId, _ := hex.DecodeString(genesisIdHex)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if stats {
+		sellStats, err := loader.GetNFTSellStats(codeHash, genesisId)
+		if err != nil {
+			logger.Log.Error("get nft sell stats failed", zap.Error(err))
+			return
+		}
+		if err := enc.Encode(sellStats); err != nil {
+			logger.Log.Error("write nft sell stats failed", zap.Error(err))
+		}
+		return
+	}
+
+	transfers, err := loader.GetNFTTransferHistory(codeHash, genesisId, tokenIndex)
+	if err != nil {
+		logger.Log.Error("get nft transfer history failed", zap.Error(err))
+		return
+	}
+
+	result := make([]*nftTransfer, 0, len(transfers))
+	for _, transfer := range transfers {
+		operation := ""
+		if int(transfer.Operation) < len(operationName) {
+			operation = operationName[transfer.Operation]
+		}
+		result = append(result, &nftTransfer{
+			Height:      transfer.Height,
+			TxIdx:       transfer.TxIdx,
+			TxId:        utils.HashString(transfer.TxId),
+			Vout:        transfer.Vout,
+			FromAddress: encodeAddress(transfer.FromAddress),
+			Address:     encodeAddress(transfer.Address),
+			Operation:   operation,
+		})
+	}
+
+	if err := enc.Encode(result); err != nil {
+		logger.Log.Error("write nft transfer history failed", zap.Error(err))
+	}
+}
@@ -26,7 +26,7 @@ func init() {
 	flag.IntVar(&startBlockHeight, "start", -1, "start block height")
 	flag.Parse()
 
-	rdb.RdbUtxoClient = rdb.Init("conf/rdb_utxo.yaml")
+	rdb.InitUtxoStore("conf/rdb_utxo.yaml")
 
 	clickhouse.Init()
 }
@@ -0,0 +1,146 @@
+// go build -v sensibled/tools/stats
+// ./stats -limit 100
+// ./stats -codehash <hex> -genesis <hex> -limit 100
+// ./stats -refresh <height>
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"sensibled/loader"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"sensibled/store"
+	"sensibled/utils"
+
+	"go.uber.org/zap"
+)
+
+var (
+	codeHashHex  string
+	genesisIdHex string
+	limit        int
+	days         int
+	refresh      int
+)
+
+type holder struct {
+	Address         string `json:"address"`
+	Balance         uint64 `json:"balance"`
+	ContractBalance uint64 `json:"contractBalance,omitempty"`
+}
+
+type bucket struct {
+	MinUtxos  uint64 `json:"minUtxos"`
+	Addresses uint64 `json:"addresses"`
+}
+
+type activeDay struct {
+	Day       string `json:"day"`
+	Addresses uint64 `json:"addresses"`
+}
+
+type stats struct {
+	Height           uint32       `json:"height"`
+	Addresses        uint64       `json:"addresses"`
+	Utxos            uint64       `json:"utxos"`
+	RichList         []*holder    `json:"richList"`
+	UtxoDistribution []*bucket    `json:"utxoDistribution"`
+	ActiveAddresses  []*activeDay `json:"activeAddresses"`
+}
+
+func init() {
+	flag.StringVar(&codeHashHex, "codehash", "", "show top holders of token codehash")
+	flag.StringVar(&genesisIdHex, "genesis", "", "show top holders of token genesis")
+	flag.IntVar(&limit, "limit", 100, "top N")
+	flag.IntVar(&days, "days", 30, "active addresses of recent days")
+	flag.IntVar(&refresh, "refresh", -1, "refresh stats at height (full recount)")
+	flag.Parse()
+
+	clickhouse.Init()
+}
+
+func encodeAddress(addressPkh []byte) string {
+	return utils.EncodeAddress(addressPkh, utils.PubKeyHashAddrID)
+}
+
+func main() {
+	defer logger.SyncLog()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if refresh >= 0 {
+		if ok := store.RefreshStatsCk(refresh, 0, limit); !ok {
+			logger.Log.Error("refresh stats failed")
+		}
+		return
+	}
+
+	if codeHashHex != "" {
+		codeHash, _ := hex.DecodeString(codeHashHex)
+		genesisId, _ := hex.DecodeString(genesisIdHex)
+		holders, err := loader.GetGenesisTopHolders(codeHash, genesisId, limit)
+		if err != nil {
+			logger.Log.Error("get top holders failed", zap.Error(err))
+			return
+		}
+		result := make([]*holder, 0, len(holders))
+		for _, h := range holders {
+			result = append(result, &holder{Address: encodeAddress(h.AddressPkh), Balance: h.Balance})
+		}
+		if err := enc.Encode(result); err != nil {
+			logger.Log.Error("write top holders failed", zap.Error(err))
+		}
+		return
+	}
+
+	addressStats, err := loader.GetAddressStats()
+	if err != nil || addressStats == nil {
+		logger.Log.Error("no stats", zap.Error(err))
+		return
+	}
+	result := &stats{
+		Height:    addressStats.Height,
+		Addresses: addressStats.Addresses,
+		Utxos:     addressStats.Utxos,
+	}
+
+	richList, err := loader.GetRichList(limit)
+	if err != nil {
+		logger.Log.Error("get rich list failed", zap.Error(err))
+		return
+	}
+	for _, r := range richList {
+		result.RichList = append(result.RichList, &holder{
+			Address:         encodeAddress(r.AddressPkh),
+			Balance:         r.Balance,
+			ContractBalance: r.ContractBalance,
+		})
+	}
+
+	buckets, err := loader.GetUtxoDistribution()
+	if err != nil {
+		logger.Log.Error("get utxo distribution failed", zap.Error(err))
+		return
+	}
+	for _, b := range buckets {
+		result.UtxoDistribution = append(result.UtxoDistribution, &bucket{MinUtxos: b.Bucket, Addresses: b.Addresses})
+	}
+
+	active, err := loader.GetActiveAddresses(days)
+	if err != nil {
+		logger.Log.Error("get active addresses failed", zap.Error(err))
+		return
+	}
+	for _, a := range active {
+		result.ActiveAddresses = append(result.ActiveAddresses, &activeDay{Day: a.Day, Addresses: a.Addresses})
+	}
+
+	if err := enc.Encode(result); err != nil {
+		logger.Log.Error("write stats failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,58 @@
+// go build -v sensibled/tools/swap_candle
+// ./swap_candle -codehash <hex> -genesis <hex> -period 3600 -start 1640995200 -end 1643673600
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"sensibled/loader"
+	"sensibled/loader/clickhouse"
+	"sensibled/logger"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	codeHashHex  string
+	genesisIdHex string
+	period       uint
+	startTs      uint
+	endTs        uint
+)
+
+func init() {
+	flag.StringVar(&codeHashHex, "codehash", "", "swap pool codehash")
+	flag.StringVar(&genesisIdHex, "genesis", "", "swap pool genesis")
+	flag.UintVar(&period, "period", 3600, "candle period in seconds: 60/3600/86400")
+	flag.UintVar(&startTs, "start", 0, "start timestamp")
+	flag.UintVar(&endTs, "end", 0, "end timestamp, default now")
+	flag.Parse()
+
+	clickhouse.Init()
+}
+
+func main() {
+	defer logger.SyncLog()
+
+	codeHash, _ := hex.DecodeString(codeHashHex)
+	genesisId, _ := hex.DecodeString(genesisIdHex)
+	if endTs == 0 {
+		endTs = uint(time.Now().Unix()) + 1
+	}
+
+	candles, err := loader.GetSwapCandles(codeHash, genesisId, uint32(period), uint32(startTs), uint32(endTs))
+	if err != nil {
+		logger.Log.Error("get swap candles failed", zap.Error(err))
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(candles); err != nil {
+		logger.Log.Error("write swap candles failed", zap.Error(err))
+	}
+}